@@ -0,0 +1,157 @@
+// Package apitest provides an in-process stand-in for the remote API, for
+// trying out and testing code that uses the api package without network
+// access. It is built on net/http/httptest.
+package apitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"go_for_devops/api"
+)
+
+// DefaultPerPage is the page size if the request has no per_page parameter.
+const DefaultPerPage = 2
+
+// Server serves collections of JSON items, paginated with the page and
+// per_page query parameters and Link headers:
+//
+//	GET /{collection}        a page of the collection
+//	GET /{collection}/{i}    the item at index i
+//
+// Every request must carry the API key in the api.KeyHeader header.
+type Server struct {
+	*httptest.Server
+
+	// Key is the expected API key.
+	Key string
+
+	mu          sync.Mutex
+	collections map[string][]any
+
+	// failNext makes the next requests fail with 503.
+	failNext atomic.Int32
+	requests atomic.Int32
+}
+
+// NewServer starts a server that expects the given API key.
+func NewServer(key string) *Server {
+	s := &Server{Key: key, collections: map[string][]any{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{collection}", s.list)
+	mux.HandleFunc("GET /{collection}/{index}", s.get)
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// Add appends items to a collection.
+func (s *Server) Add(collection string, items ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections[collection] = append(s.collections[collection], items...)
+}
+
+// FailNext makes the next n requests fail with 503 Service Unavailable,
+// to exercise retries.
+func (s *Server) FailNext(n int) {
+	s.failNext.Store(int32(n))
+}
+
+// Requests returns the number of requests the server has received.
+func (s *Server) Requests() int {
+	return int(s.requests.Load())
+}
+
+// middleware counts requests, injects failures and checks the API key.
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.takeFailure() {
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get(api.KeyHeader) != s.Key {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid API key"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// takeFailure reports whether the current request should fail, and counts
+// down the injected failures.
+func (s *Server) takeFailure() bool {
+	for {
+		n := s.failNext.Load()
+		if n <= 0 {
+			return false
+		}
+		if s.failNext.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// list handles GET /{collection}.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	items, ok := s.collection(r.PathValue("collection"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such collection"})
+		return
+	}
+	page, err1 := intQuery(r, "page", 1)
+	perPage, err2 := intQuery(r, "per_page", DefaultPerPage)
+	if err1 != nil || err2 != nil || page < 1 || perPage < 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "page and per_page must be positive numbers"})
+		return
+	}
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	if end < len(items) {
+		// Relative links work, because the client resolves them
+		// against the URL of the page.
+		w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d&per_page=%d>; rel="next"`, r.URL.Path, page+1, perPage))
+	}
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+// get handles GET /{collection}/{index}.
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	items, ok := s.collection(r.PathValue("collection"))
+	i, err := strconv.Atoi(r.PathValue("index"))
+	if !ok || err != nil || i < 0 || i >= len(items) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, items[i])
+}
+
+// collection returns a copy of the items of a collection.
+func (s *Server) collection(name string) ([]any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, ok := s.collections[name]
+	return append([]any(nil), items...), ok
+}
+
+// intQuery parses an integer query parameter.
+func intQuery(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,259 @@
+// Package api is a client for the remote API configured in the api section
+// of config.json.
+//
+// The client sends the API key with every request to the host of the base
+// URL (and never to other hosts), applies the configured timeout, retries
+// failed requests through a fetch.Fetcher and decodes JSON responses into
+// types provided by the caller:
+//
+//	var user User
+//	err := client.Get(ctx, "/users/1", nil, &user)
+//
+// Collections are paginated with Link headers (RFC 8288), as done by e.g.
+// GitHub: every page is a JSON array, and the Link header of a response
+// points to the next page. List and All follow these links.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go_for_devops/config"
+	"go_for_devops/fetch"
+)
+
+// KeyHeader is the request header that carries the API key.
+const KeyHeader = "X-API-Key"
+
+// ErrNoBaseURL is returned by New if the configuration has no base URL.
+var ErrNoBaseURL = errors.New("api.baseUrl is not set")
+
+// Client sends requests to the API.
+type Client struct {
+	base    *url.URL
+	key     string
+	fetcher *fetch.Fetcher
+}
+
+// New creates a client for the API configuration. By default, requests time
+// out after api.timeout and are retried with fetch.DefaultRetryPolicy. opts
+// are applied after these defaults, so they can override them or add e.g. a
+// circuit breaker. A client set with fetch.WithClient replaces the default
+// one, which removes the API key from redirects to other hosts, so it needs
+// a CheckRedirect that does the same.
+func New(cfg config.API, opts ...fetch.Option) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, ErrNoBaseURL
+	}
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api.baseUrl: %w", err)
+	}
+	// Without a trailing slash, ResolveReference would replace the last
+	// segment of the base path instead of appending to it.
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	c := &Client{base: base, key: cfg.APIKey}
+	timeout := fetch.DefaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = cfg.TimeoutDuration()
+	}
+	defaults := []fetch.Option{
+		fetch.WithClient(&http.Client{Timeout: timeout, CheckRedirect: c.checkRedirect}),
+		fetch.WithRetry(fetch.DefaultRetryPolicy()),
+		fetch.WithHeader("Accept", "application/json"),
+	}
+	c.fetcher = fetch.New(append(defaults, opts...)...)
+	return c, nil
+}
+
+// maxRedirects is the number of redirects followed by http.Client by default.
+const maxRedirects = 10
+
+// checkRedirect removes the API key from redirects to other hosts. The
+// http.Client copies all headers of the first request to the redirects,
+// and only drops its own credential headers, such as Authorization.
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !sameOrigin(req.URL, c.base) {
+		req.Header.Del(KeyHeader)
+	}
+	return nil
+}
+
+// URL resolves a path such as "/users" or "users?page=2" against the base
+// URL. Paths are always relative to the base URL, so a base URL of
+// https://api.example.com/v1 and the path /users give
+// https://api.example.com/v1/users.
+func (c *Client) URL(path string, query url.Values) (string, error) {
+	ref, err := url.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return "", err
+	}
+	u := c.base.ResolveReference(ref)
+	if len(query) > 0 {
+		q := u.Query()
+		for k, vs := range query {
+			q[k] = append(q[k], vs...)
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// Get sends a GET request and decodes the JSON response into out, which
+// may be nil to ignore the body.
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	_, err := c.Do(ctx, http.MethodGet, path, query, nil, out)
+	return err
+}
+
+// Do sends a request with in encoded as the JSON body (unless it is nil)
+// and decodes the JSON response into out (unless it is nil). It returns
+// the response, e.g. to read its headers.
+//
+// Note that the fetcher also retries requests that are not idempotent,
+// such as POST, if the server fails with a 5xx status code.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, in, out any) (*fetch.Response, error) {
+	u, err := c.URL(path, query)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, method, u, in, out)
+}
+
+// do sends a request to an absolute URL.
+func (c *Client) do(ctx context.Context, method, u string, in, out any) (*fetch.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		// A bytes.Reader lets http.NewRequest set GetBody, so the
+		// fetcher can send the body again on a retry.
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// The key is set per request rather than on the fetcher, so it is only
+	// sent to the API itself, not to an absolute URL on another host.
+	if c.key != "" && sameOrigin(req.URL, c.base) {
+		req.Header.Set(KeyHeader, c.key)
+	}
+
+	resp, err := c.fetcher.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(resp.Body) > 0 {
+		if err := json.Unmarshal(resp.Body, out); err != nil {
+			return resp, fmt.Errorf("%s %s: decoding response: %w", method, u, err)
+		}
+	}
+	return resp, nil
+}
+
+// List calls fn for every item of a paginated collection, following the
+// Link headers from page to page, until fn returns an error or there are
+// no more pages.
+func List[T any](ctx context.Context, c *Client, path string, query url.Values, fn func(T) error) error {
+	u, err := c.URL(path, query)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for u != "" {
+		// A server that links a page to itself would loop forever.
+		if seen[u] {
+			return fmt.Errorf("pagination loop at %s", u)
+		}
+		seen[u] = true
+
+		var page []T
+		resp, err := c.do(ctx, http.MethodGet, u, nil, &page)
+		if err != nil {
+			return err
+		}
+		for _, item := range page {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		next := nextLink(resp.Header)
+		if next == "" {
+			return nil
+		}
+		// The link may be relative to the page it was found on.
+		ref, err := url.Parse(next)
+		if err != nil {
+			return fmt.Errorf("invalid next link %q: %w", next, err)
+		}
+		cur, _ := url.Parse(u)
+		nextURL := cur.ResolveReference(ref)
+		if !sameOrigin(nextURL, c.base) {
+			return fmt.Errorf("next link %s leaves the API at %s://%s", nextURL, c.base.Scheme, c.base.Host)
+		}
+		u = nextURL.String()
+	}
+	return nil
+}
+
+// sameOrigin reports whether u has the scheme and host (including the port)
+// of base.
+func sameOrigin(u, base *url.URL) bool {
+	return strings.EqualFold(u.Scheme, base.Scheme) && strings.EqualFold(u.Host, base.Host)
+}
+
+// All returns all items of a paginated collection.
+func All[T any](ctx context.Context, c *Client, path string, query url.Values) ([]T, error) {
+	items := []T{}
+	err := List(ctx, c, path, query, func(item T) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// nextLink returns the target of the rel="next" link of a Link header,
+// such as `<https://api.example.com/users?page=2>; rel="next"`.
+func nextLink(h http.Header) string {
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+				// rel may list several relation types.
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return strings.Trim(strings.TrimSpace(target), "<>")
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go_for_devops/api"
+	"go_for_devops/api/apitest"
+	"go_for_devops/config"
+	"go_for_devops/fetch"
+)
+
+// The tests are in package api_test, because apitest imports api.
+
+const key = "test-key"
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// fastRetry keeps retries from slowing down the tests.
+var fastRetry = fetch.WithRetry(fetch.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2})
+
+// noRetry makes every request a single attempt.
+var noRetry = fetch.WithRetry(fetch.RetryPolicy{MaxAttempts: 1})
+
+func newClient(t *testing.T, baseURL string, opts ...fetch.Option) *api.Client {
+	t.Helper()
+	c, err := api.New(config.API{BaseURL: baseURL, APIKey: key}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// recorder is a server that records the path and API key of every request.
+type recorder struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths []string
+	keys  []string
+}
+
+func newRecorder(t *testing.T, handler http.HandlerFunc) *recorder {
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.paths = append(r.paths, req.URL.RequestURI())
+		r.keys = append(r.keys, req.Header.Get(api.KeyHeader))
+		r.mu.Unlock()
+		handler(w, req)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestNewWithoutBaseURL(t *testing.T) {
+	if _, err := api.New(config.API{}); !errors.Is(err, api.ErrNoBaseURL) {
+		t.Errorf("got error %v, want ErrNoBaseURL", err)
+	}
+}
+
+func TestGetDecodesJSON(t *testing.T) {
+	srv := apitest.NewServer(key)
+	defer srv.Close()
+	srv.Add("users", user{1, "ada"}, user{2, "grace"})
+
+	var u user
+	if err := newClient(t, srv.URL).Get(context.Background(), "/users/1", nil, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{2, "grace"}) {
+		t.Errorf("got %+v", u)
+	}
+}
+
+func TestGetInvalidJSON(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "not a number"}`)
+	})
+	var u user
+	err := newClient(t, srv.URL).Get(context.Background(), "/users/1", nil, &u)
+	if err == nil || !strings.Contains(err.Error(), "decoding response") {
+		t.Errorf("got error %v, want a decoding error", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	srv := apitest.NewServer(key)
+	defer srv.Close()
+	srv.Add("users", user{1, "ada"})
+	ctx := context.Background()
+
+	if err := newClient(t, srv.URL).Get(ctx, "/users/0", nil, nil); err != nil {
+		t.Errorf("with the right key: %v", err)
+	}
+
+	c, _ := api.New(config.API{BaseURL: srv.URL, APIKey: "wrong"})
+	var se *fetch.StatusError
+	if err := c.Get(ctx, "/users/0", nil, nil); !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized {
+		t.Errorf("with a wrong key: %v, want 401", err)
+	}
+}
+
+func TestKeyNotSentToOtherHosts(t *testing.T) {
+	self := newRecorder(t, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "{}") })
+	other := newRecorder(t, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "{}") })
+
+	c := newClient(t, self.URL)
+	ctx := context.Background()
+	if err := c.Get(ctx, "/users", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// An absolute URL on another host is requested without the key.
+	if err := c.Get(ctx, other.URL+"/collect", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(self.keys) != 1 || self.keys[0] != key {
+		t.Errorf("API got keys %q, want the key", self.keys)
+	}
+	if len(other.keys) != 1 || other.keys[0] != "" {
+		t.Errorf("other host got keys %q, want none", other.keys)
+	}
+}
+
+func TestKeyNotSentOnRedirect(t *testing.T) {
+	other := newRecorder(t, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "{}") })
+	self := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/users", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, other.URL+"/collect", http.StatusFound)
+		default:
+			fmt.Fprint(w, "{}")
+		}
+	})
+
+	c := newClient(t, self.URL, noRetry)
+	ctx := context.Background()
+	// A redirect within the API keeps the key.
+	if err := c.Get(ctx, "/moved", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, "/away", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(self.keys, ",") != key+","+key+","+key {
+		t.Errorf("API got keys %q, want the key with every request", self.keys)
+	}
+	if len(other.keys) != 1 || other.keys[0] != "" {
+		t.Errorf("other host got keys %q, want none", other.keys)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "[]") })
+	c := newClient(t, srv.URL+"/v1")
+
+	if err := c.Get(context.Background(), "/users", map[string][]string{"q": {"a b"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.paths) != 1 || srv.paths[0] != "/v1/users?q=a+b" {
+		t.Errorf("requested %q, want /v1/users?q=a+b", srv.paths)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	c, err := api.New(config.API{BaseURL: srv.URL, Timeout: 50}, noRetry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = c.Get(context.Background(), "/slow", nil, nil)
+	if err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("request took %s with a 50ms timeout", d)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := apitest.NewServer(key)
+	defer srv.Close()
+	srv.Add("users", user{1, "ada"})
+	srv.FailNext(2)
+
+	var u user
+	if err := newClient(t, srv.URL, fastRetry).Get(context.Background(), "/users/0", nil, &u); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Requests() != 3 {
+		t.Errorf("server got %d requests, want 3", srv.Requests())
+	}
+}
+
+func TestAll(t *testing.T) {
+	srv := apitest.NewServer(key)
+	defer srv.Close()
+	for i := 1; i <= 5; i++ {
+		srv.Add("users", user{i, fmt.Sprint("user", i)})
+	}
+
+	users, err := api.All[user](context.Background(), newClient(t, srv.URL), "/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 5 || users[0] != (user{1, "user1"}) || users[4] != (user{5, "user5"}) {
+		t.Errorf("got %+v", users)
+	}
+	// Pages of two items: 1-2, 3-4 and 5.
+	if srv.Requests() != 3 {
+		t.Errorf("server got %d requests, want 3", srv.Requests())
+	}
+}
+
+func TestListStops(t *testing.T) {
+	srv := apitest.NewServer(key)
+	defer srv.Close()
+	for i := 1; i <= 5; i++ {
+		srv.Add("users", user{ID: i})
+	}
+
+	stop := errors.New("stop")
+	var seen int
+	err := api.List(context.Background(), newClient(t, srv.URL), "/users", nil, func(u user) error {
+		seen++
+		if u.ID == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || seen != 3 || srv.Requests() != 2 {
+		t.Errorf("got %v after %d items and %d requests, want stop after 3 items and 2 requests", err, seen, srv.Requests())
+	}
+}
+
+func TestListLoop(t *testing.T) {
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		// Page 2 links back to page 1.
+		next := "?page=2"
+		if r.URL.Query().Get("page") == "2" {
+			next = "/users"
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next))
+		fmt.Fprint(w, `[{"id": 1}]`)
+	})
+
+	_, err := api.All[user](context.Background(), newClient(t, srv.URL), "/users", nil)
+	if err == nil || !strings.Contains(err.Error(), "pagination loop") {
+		t.Errorf("got error %v, want a pagination loop", err)
+	}
+	if len(srv.paths) != 2 {
+		t.Errorf("requested %q, want two pages", srv.paths)
+	}
+}
+
+func TestListForeignNextLink(t *testing.T) {
+	other := newRecorder(t, func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "[]") })
+	srv := newRecorder(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", fmt.Sprintf(`<%s/steal>; rel="next"`, other.URL))
+		fmt.Fprint(w, `[{"id": 1}]`)
+	})
+
+	_, err := api.All[user](context.Background(), newClient(t, srv.URL), "/users", nil)
+	if err == nil || !strings.Contains(err.Error(), "leaves the API") {
+		t.Errorf("got error %v, want the next link refused", err)
+	}
+	if len(other.paths) != 0 {
+		t.Errorf("the other host got requests %q", other.paths)
+	}
+}
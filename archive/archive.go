@@ -0,0 +1,147 @@
+// Package archive creates, lists and extracts tar.gz and zip archives. The
+// files of a new archive are selected with the walk package, and archives
+// are read from any fs.FS, so an archive embedded into the binary with
+// embed.FS works like one on the disk:
+//
+//	f, _ := os.Create("handoff.tar.gz")
+//	n, err := archive.Create(f, archive.TarGz, os.DirFS("."), walk.Options{
+//		Include: []string{"/users_processed.txt", "csv_data/*", "json_data/*"},
+//	})
+//
+//	a, err := archive.Open(os.DirFS("."), "handoff.tar.gz")
+//	entries, err := a.Extract("handoff", archive.DefaultLimits)
+//
+// Archives come from other people, so Extract does not trust them: names
+// that would leave the target directory ("../../etc/passwd") are rejected,
+// and Limits caps the number and size of the extracted files, including
+// archives that claim small sizes but expand to huge files.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"go_for_devops/walk"
+)
+
+// Format is the format of an archive.
+type Format int
+
+const (
+	// TarGz is a gzip-compressed tar archive (.tar.gz or .tgz).
+	TarGz Format = iota
+	// Zip is a zip archive (.zip).
+	Zip
+)
+
+func (f Format) String() string {
+	switch f {
+	case TarGz:
+		return "tar.gz"
+	case Zip:
+		return "zip"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// FormatOf returns the format of an archive by the extension of its name.
+func FormatOf(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return TarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return Zip, nil
+	}
+	return 0, fmt.Errorf("%s: unknown archive format (must be .tar.gz, .tgz or .zip)", name)
+}
+
+// ErrNoFiles is returned by Create if no file matches the options.
+var ErrNoFiles = errors.New("no files to archive")
+
+// Create writes an archive of the regular files of fsys that match opts
+// to w. The files keep their paths, permissions and modification times. It
+// returns the number of files written.
+func Create(w io.Writer, format Format, fsys fs.FS, opts walk.Options) (int, error) {
+	var (
+		add    func(e walk.Entry, r io.Reader) error
+		finish func() error
+	)
+	switch format {
+	case TarGz:
+		gz := gzip.NewWriter(w)
+		tw := tar.NewWriter(gz)
+		add = func(e walk.Entry, r io.Reader) error {
+			hdr := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     e.Path,
+				Size:     e.Size,
+				Mode:     int64(e.Mode.Perm()),
+				ModTime:  e.ModTime,
+				Format:   tar.FormatPAX,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		}
+		finish = func() error {
+			if err := tw.Close(); err != nil {
+				return err
+			}
+			return gz.Close()
+		}
+	case Zip:
+		zw := zip.NewWriter(w)
+		add = func(e walk.Entry, r io.Reader) error {
+			hdr := &zip.FileHeader{Name: e.Path, Method: zip.Deflate, Modified: e.ModTime}
+			hdr.SetMode(e.Mode.Perm())
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(fw, r)
+			return err
+		}
+		finish = zw.Close
+	default:
+		return 0, fmt.Errorf("unknown archive format %s", format)
+	}
+
+	var n int
+	err := walk.Walk(fsys, ".", opts, func(e walk.Entry) error {
+		if !e.Mode.IsRegular() {
+			return nil
+		}
+		f, err := fsys.Open(e.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// The header has the size from the walk. If the file grows in the
+		// meantime, tar fails with ErrWriteTooLong rather than writing a
+		// broken archive.
+		if err := add(e, f); err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := finish(); err != nil {
+		return n, err
+	}
+	if n == 0 {
+		return 0, ErrNoFiles
+	}
+	return n, nil
+}
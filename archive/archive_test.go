@@ -0,0 +1,406 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go_for_devops/walk"
+)
+
+// testdata holds an archive of users.txt and csv_data/x.csv in every
+// format.
+//
+//go:embed testdata
+var testdata embed.FS
+
+// entry is an entry of a crafted archive.
+type entry struct {
+	name string
+	body string
+	// dir or symlink make a directory or a symbolic link to body.
+	dir, symlink bool
+}
+
+// craft writes an archive of the entries into a new directory and opens it.
+// Unlike Create, it writes the names as they are.
+func craft(t *testing.T, format Format, entries ...entry) *Archive {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case TarGz:
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, e := range entries {
+			hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+			switch {
+			case e.dir:
+				hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+			case e.symlink:
+				hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.body, 0
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				tw.Write([]byte(e.body))
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		gz.Close()
+	case Zip:
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			switch {
+			case e.dir:
+				hdr.SetMode(fs.ModeDir | 0755)
+			case e.symlink:
+				hdr.SetMode(fs.ModeSymlink | 0777)
+			default:
+				hdr.SetMode(0644)
+			}
+			w, err := zw.CreateHeader(hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !e.dir {
+				w.Write([]byte(e.body))
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return openBytes(t, format, buf.Bytes())
+}
+
+// openBytes writes an archive into a new directory and opens it.
+func openBytes(t *testing.T, format Format, data []byte) *Archive {
+	t.Helper()
+	dir := t.TempDir()
+	name := "crafted." + format.String()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(os.DirFS(dir), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// forEachFormat runs test as a subtest for every format.
+func forEachFormat(t *testing.T, test func(t *testing.T, format Format)) {
+	for _, format := range []Format{TarGz, Zip} {
+		t.Run(format.String(), func(t *testing.T) { test(t, format) })
+	}
+}
+
+// paths returns the paths of entries.
+func paths(entries []walk.Entry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Path)
+	}
+	return strings.Join(names, " ")
+}
+
+// checkMissing fails the test if a file exists at path.
+func checkMissing(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s was written: %v", path, err)
+	}
+}
+
+func TestCreateAndExtract(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"users.txt":      {Data: []byte("a:1\n"), Mode: 0600, ModTime: modTime},
+		"csv_data/x.csv": {Data: []byte("x,y\n"), Mode: 0644, ModTime: modTime},
+		"notes.md":       {Data: []byte("skipped"), Mode: 0644, ModTime: modTime},
+	}
+	forEachFormat(t, func(t *testing.T, format Format) {
+		var buf bytes.Buffer
+		n, err := Create(&buf, format, fsys, walk.Options{Exclude: []string{"*.md"}})
+		if err != nil || n != 2 {
+			t.Fatalf("Create = %d, %v", n, err)
+		}
+		a := openBytes(t, format, buf.Bytes())
+
+		entries, err := a.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(entries); got != "csv_data/x.csv users.txt" {
+			t.Errorf("List returned %s", got)
+		}
+
+		dir := filepath.Join(t.TempDir(), "out")
+		extracted, err := a.Extract(dir, DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(extracted); got != "csv_data/x.csv users.txt" {
+			t.Errorf("Extract returned %s", got)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "users.txt"))
+		if err != nil || string(data) != "a:1\n" {
+			t.Errorf("users.txt contains %q, %v", data, err)
+		}
+		info, _ := os.Stat(filepath.Join(dir, "users.txt"))
+		if info.Mode().Perm() != 0600 || !info.ModTime().Equal(modTime) {
+			t.Errorf("users.txt has mode %v and time %v", info.Mode(), info.ModTime())
+		}
+	})
+}
+
+func TestOpenEmbedded(t *testing.T) {
+	for _, name := range []string{"testdata/handoff.tar.gz", "testdata/handoff.zip"} {
+		t.Run(name, func(t *testing.T) {
+			a, err := Open(testdata, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := a.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(entries); got != "csv_data/x.csv users.txt" {
+				t.Errorf("List returned %s", got)
+			}
+
+			dir := t.TempDir()
+			if _, err := a.Extract(dir, DefaultLimits); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "users.txt"))
+			if err != nil || string(data) != "mario:1\nluigi:2\n" {
+				t.Errorf("users.txt contains %q, %v", data, err)
+			}
+		})
+	}
+	if _, err := Open(testdata, "testdata/missing.zip"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestCreateNoFiles(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Create(&buf, Zip, fstest.MapFS{}, walk.Options{}); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("got error %v, want ErrNoFiles", err)
+	}
+}
+
+func TestExtractUnsafePaths(t *testing.T) {
+	// An absolute path is safe to use in the test, as it is in a
+	// temporary directory.
+	outside := t.TempDir()
+	names := []string{
+		"../x",
+		"a/../../x",
+		"./../x",
+		filepath.ToSlash(filepath.Join(outside, "abs")),
+		"/abs",
+		`..\x`,
+		"",
+	}
+	forEachFormat(t, func(t *testing.T, format Format) {
+		for _, name := range names {
+			t.Run(fmt.Sprintf("%q", name), func(t *testing.T) {
+				parent := t.TempDir()
+				dir := filepath.Join(parent, "out")
+				a := craft(t, format, entry{name: "ok", body: "ok"}, entry{name: name, body: "evil"}, entry{name: "after", body: "after"})
+
+				extracted, err := a.Extract(dir, DefaultLimits)
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Fatalf("got error %v, want ErrUnsafePath", err)
+				}
+				// The entries before the bad one are kept, the ones after
+				// it are not extracted.
+				if got := paths(extracted); got != "ok" {
+					t.Errorf("extracted %s, want only ok", got)
+				}
+				checkMissing(t, filepath.Join(parent, "x"))
+				checkMissing(t, filepath.Join(outside, "abs"))
+				checkMissing(t, filepath.Join(dir, "after"))
+			})
+		}
+	})
+}
+
+func TestExtractSafeDotPaths(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		dir := t.TempDir()
+		a := craft(t, format,
+			entry{name: "./", dir: true},
+			entry{name: "./a/b/../c", body: "c"},
+			entry{name: "d/", dir: true},
+		)
+		extracted, err := a.Extract(dir, DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := paths(extracted); got != "a/c" {
+			t.Errorf("extracted %s", got)
+		}
+		if info, err := os.Stat(filepath.Join(dir, "d")); err != nil || !info.IsDir() {
+			t.Errorf("directory d was not created: %v", err)
+		}
+	})
+}
+
+func TestExtractSymlinkEntry(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		outside := t.TempDir()
+		dir := t.TempDir()
+		// The archive creates a link to a directory outside, then writes
+		// a file through it.
+		a := craft(t, format,
+			entry{name: "link", body: outside, symlink: true},
+			entry{name: "up", body: "..", symlink: true},
+			entry{name: "link/evil", body: "evil"},
+			entry{name: "up/evil", body: "evil"},
+		)
+		extracted, err := a.Extract(dir, DefaultLimits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The links are skipped, so the files land in real directories
+		// inside dir.
+		if got := paths(extracted); got != "link/evil up/evil" {
+			t.Errorf("extracted %s", got)
+		}
+		checkMissing(t, filepath.Join(outside, "evil"))
+		checkMissing(t, filepath.Join(filepath.Dir(dir), "evil"))
+		for _, name := range []string{"link", "up"} {
+			if info, err := os.Lstat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+				t.Errorf("%s is not a directory: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestExtractThroughExistingSymlink(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		outside := t.TempDir()
+		dir := t.TempDir()
+		if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+			t.Fatal(err)
+		}
+		a := craft(t, format, entry{name: "link/sub/evil", body: "evil"})
+		if _, err := a.Extract(dir, DefaultLimits); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("got error %v, want ErrUnsafePath", err)
+		}
+		checkMissing(t, filepath.Join(outside, "sub"))
+	})
+}
+
+func TestExtractReplacesSymlink(t *testing.T) {
+	forEachFormat(t, func(t *testing.T, format Format) {
+		outside := filepath.Join(t.TempDir(), "target")
+		os.WriteFile(outside, []byte("original"), 0644)
+		dir := t.TempDir()
+		if err := os.Symlink(outside, filepath.Join(dir, "file")); err != nil {
+			t.Fatal(err)
+		}
+		a := craft(t, format, entry{name: "file", body: "new"})
+		if _, err := a.Extract(dir, DefaultLimits); err != nil {
+			t.Fatal(err)
+		}
+		// The link is replaced, not written through.
+		if data, _ := os.ReadFile(outside); string(data) != "original" {
+			t.Errorf("the target of the link contains %q", data)
+		}
+		info, err := os.Lstat(filepath.Join(dir, "file"))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("file is not a regular file: %v", err)
+		}
+	})
+}
+
+func TestExtractLimits(t *testing.T) {
+	files := []entry{
+		{name: "a", body: strings.Repeat("a", 10)},
+		{name: "b", body: strings.Repeat("b", 10)},
+		{name: "c", body: strings.Repeat("c", 10)},
+	}
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string // files extracted before the error
+	}{
+		{"files", Limits{MaxFiles: 2}, "a b"},
+		{"file size", Limits{MaxFileSize: 9}, ""},
+		{"total size", Limits{MaxTotalSize: 25}, "a b"},
+		{"total size exactly", Limits{MaxTotalSize: 20}, "a b"},
+	}
+	forEachFormat(t, func(t *testing.T, format Format) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				extracted, err := craft(t, format, files...).Extract(dir, tt.limits)
+				if !errors.Is(err, ErrLimit) {
+					t.Fatalf("got error %v, want ErrLimit", err)
+				}
+				if got := paths(extracted); got != tt.want {
+					t.Errorf("extracted %q, want %q", got, tt.want)
+				}
+				checkMissing(t, filepath.Join(dir, "c"))
+			})
+		}
+
+		// Within the limits, everything is extracted.
+		limits := Limits{MaxFiles: 3, MaxFileSize: 10, MaxTotalSize: 30}
+		if _, err := craft(t, format, files...).Extract(t.TempDir(), limits); err != nil {
+			t.Errorf("extracting within the limits: %v", err)
+		}
+	})
+}
+
+func TestExtractUnderstatedSize(t *testing.T) {
+	// A zip entry whose header claims 1 byte, but that expands to 1000.
+	body := bytes.Repeat([]byte("z"), 1000)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "bomb",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(body),
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(body)
+	zw.Close()
+
+	dir := t.TempDir()
+	_, err = openBytes(t, Zip, buf.Bytes()).Extract(dir, Limits{MaxFileSize: 100})
+	// archive/zip stops reading at the claimed size already, otherwise the
+	// limit would.
+	if !errors.Is(err, zip.ErrFormat) && !errors.Is(err, ErrLimit) {
+		t.Errorf("got error %v, want zip.ErrFormat or ErrLimit", err)
+	}
+	checkMissing(t, filepath.Join(dir, "bomb"))
+	// No temporary file is left either.
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in the directory", len(entries))
+	}
+}
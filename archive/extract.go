@@ -0,0 +1,290 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go_for_devops/walk"
+)
+
+// Limits caps what Extract writes to the disk. A zero field means no limit.
+type Limits struct {
+	// MaxFiles is the number of files.
+	MaxFiles int
+	// MaxFileSize is the size of a single file in bytes.
+	MaxFileSize int64
+	// MaxTotalSize is the size of all files together in bytes.
+	MaxTotalSize int64
+}
+
+// DefaultLimits are generous for the hand-off archives of this program,
+// and still stop a "zip bomb" before it fills the disk.
+var DefaultLimits = Limits{MaxFiles: 10_000, MaxFileSize: 1 << 30, MaxTotalSize: 4 << 30}
+
+var (
+	// ErrUnsafePath is returned by Extract for entries with an absolute
+	// path or a path that leaves the target directory, and for paths that
+	// go through a symbolic link in the target directory.
+	ErrUnsafePath = errors.New("unsafe path")
+	// ErrLimit is returned by Extract if the archive exceeds the Limits.
+	ErrLimit = errors.New("archive exceeds the limits")
+)
+
+// Archive is an archive file in a file system.
+type Archive struct {
+	fsys   fs.FS
+	name   string
+	format Format
+}
+
+// Open returns the archive name in fsys. The format is detected by the
+// extension of name.
+func Open(fsys fs.FS, name string) (*Archive, error) {
+	format, err := FormatOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.Stat(fsys, name); err != nil {
+		return nil, err
+	}
+	return &Archive{fsys: fsys, name: name, format: format}, nil
+}
+
+// Format returns the format of the archive.
+func (a *Archive) Format() Format {
+	return a.format
+}
+
+// List returns the entries of the archive, in the order they are stored.
+func (a *Archive) List() ([]walk.Entry, error) {
+	var entries []walk.Entry
+	err := a.each(func(e walk.Entry, _ io.Reader) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// Extract writes the files of the archive into the directory dir, which is
+// created if it does not exist, and returns them. Existing files are
+// replaced. Only files and directories are extracted; symbolic links and
+// other special entries are skipped, so they cannot point outside of dir.
+// Extract stops at the first unsafe entry or exceeded limit; the files
+// extracted before it are kept and returned with the error.
+func (a *Archive) Extract(dir string, limits Limits) ([]walk.Entry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var (
+		extracted []walk.Entry
+		total     int64
+	)
+	err := a.each(func(e walk.Entry, r io.Reader) error {
+		// tar archives of "." start with the entry "./" for dir itself.
+		if e.Mode.IsDir() && path.Clean(e.Path) == "." {
+			return nil
+		}
+		name, err := localName(e.Path)
+		if err != nil {
+			return err
+		}
+		if err := checkParents(dir, name); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, name)
+
+		switch {
+		case e.Mode.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !e.Mode.IsRegular():
+			return nil
+		}
+
+		if limits.MaxFiles > 0 && len(extracted) >= limits.MaxFiles {
+			return fmt.Errorf("more than %d files: %w", limits.MaxFiles, ErrLimit)
+		}
+		// The size in the header is only a claim, so the limit is enforced
+		// on the bytes that are actually written.
+		limit := int64(-1)
+		if limits.MaxFileSize > 0 {
+			limit = limits.MaxFileSize
+		}
+		if limits.MaxTotalSize > 0 && (limit < 0 || limits.MaxTotalSize-total < limit) {
+			limit = limits.MaxTotalSize - total
+		}
+		n, err := writeFile(target, r, e, limit)
+		total += n
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+		e.Path = filepath.ToSlash(name)
+		e.Size = n
+		extracted = append(extracted, e)
+		return nil
+	})
+	return extracted, err
+}
+
+// localName checks the path of an entry and returns it in the OS format.
+func localName(name string) (string, error) {
+	clean := path.Clean(strings.TrimSuffix(name, "/"))
+	if strings.Contains(name, `\`) || !fs.ValidPath(clean) || clean == "." || !filepath.IsLocal(filepath.FromSlash(clean)) {
+		return "", fmt.Errorf("%q: %w", name, ErrUnsafePath)
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+// checkParents makes sure that none of the existing directories between dir
+// and name is a symbolic link. Otherwise an archive could first create a
+// link to /etc, and then write link/passwd. Extract never creates links,
+// but the target directory may already contain some.
+func checkParents(dir, name string) error {
+	p := dir
+	for _, elem := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if elem == "." {
+			break
+		}
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symbolic link: %w", p, ErrUnsafePath)
+		}
+	}
+	return nil
+}
+
+// writeFile writes the content of an entry to target, with the permissions
+// and modification time of the entry. It fails with ErrLimit if the content
+// is longer than limit bytes, unless limit is negative. It returns the
+// number of bytes written.
+func writeFile(target string, r io.Reader, e walk.Entry, limit int64) (int64, error) {
+	if limit >= 0 && e.Size > limit {
+		return 0, fmt.Errorf("%d bytes: %w", e.Size, ErrLimit)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	// Write under a temporary name and rename, which also replaces a
+	// symbolic link at target instead of writing to where it points.
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	if limit >= 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(f, r)
+	if err == nil && limit >= 0 && n > limit {
+		err = fmt.Errorf("more than %d bytes: %w", limit, ErrLimit)
+	}
+	if err != nil {
+		f.Close()
+		return n, err
+	}
+	if err := f.Close(); err != nil {
+		return n, err
+	}
+	// Keep only the permission bits, not setuid and the like.
+	if err := os.Chmod(f.Name(), e.Mode.Perm()); err != nil {
+		return n, err
+	}
+	if err := os.Chtimes(f.Name(), e.ModTime, e.ModTime); err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), target)
+}
+
+// each calls fn for every entry of the archive, with a reader for its
+// content.
+func (a *Archive) each(fn func(e walk.Entry, r io.Reader) error) error {
+	f, err := a.fsys.Open(a.name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch a.format {
+	case TarGz:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.name, err)
+		}
+		defer gz.Close()
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", a.name, err)
+			}
+			info := hdr.FileInfo()
+			e := walk.Entry{Path: hdr.Name, Size: hdr.Size, Mode: info.Mode(), ModTime: hdr.ModTime}
+			if err := fn(e, tr); err != nil {
+				return err
+			}
+		}
+
+	case Zip:
+		// zip reads the directory at the end of the file first, so it
+		// needs random access. Files of os.DirFS and embed.FS have ReadAt;
+		// other files are read into memory.
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		ra, ok := f.(io.ReaderAt)
+		if !ok {
+			b, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			ra = bytes.NewReader(b)
+		}
+		zr, err := zip.NewReader(ra, info.Size())
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.name, err)
+		}
+		for _, zf := range zr.File {
+			e := walk.Entry{Path: zf.Name, Size: int64(zf.UncompressedSize64), Mode: zf.Mode(), ModTime: zf.Modified}
+			if err := a.eachZip(zf, e, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown archive format %s", a.format)
+}
+
+// eachZip calls fn for a file of a zip archive. It is a function of its
+// own, so the file is closed after every call.
+func (a *Archive) eachZip(zf *zip.File, e walk.Entry, fn func(e walk.Entry, r io.Reader) error) error {
+	if !e.Mode.IsRegular() {
+		return fn(e, nil)
+	}
+	r, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", a.name, zf.Name, err)
+	}
+	defer r.Close()
+	return fn(e, r)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/**
+* Checkpoints of the user import.
+*
+* A checkpoint records how far an import got: the byte offset in the input
+* file to continue reading from, the number of the last line read, and the
+* size of the output file at that point. To resume, the import seeks the
+* input to the offset and cuts the output back to its size, which drops any
+* users written after the checkpoint, since they will be written again.
+*
+* The checkpoint is written to a sidecar file next to the output, e.g.
+* users_processed.txt.checkpoint, and only after the output up to that point
+* has been written to the file.
+**/
+
+// importCheckpoint is the progress of an import.
+type importCheckpoint struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// InputOffset is where the next line of the input starts.
+	InputOffset int64 `json:"inputOffset"`
+	// Line is the number of the last line read.
+	Line int `json:"line"`
+	// OutputOffset is the size of the output with all users up to Line.
+	OutputOffset int64 `json:"outputOffset"`
+	// Users is the number of users written up to Line.
+	Users int       `json:"users"`
+	Time  time.Time `json:"time"`
+}
+
+// checkpointPath returns the path of the checkpoint file of an output file.
+func checkpointPath(output string) string {
+	return output + ".checkpoint"
+}
+
+// loadCheckpoint reads a checkpoint file. It returns nil and no error if the
+// file does not exist.
+func loadCheckpoint(path string) (*importCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp importCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// save writes the checkpoint to path. The file is replaced with a rename, so
+// a crash while saving leaves the previous checkpoint intact.
+func (cp *importCheckpoint) save(path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// check verifies that the checkpoint belongs to the input and output files,
+// and that they have not shrunk since it was written.
+func (cp *importCheckpoint) check(input, output *os.File) error {
+	if cp.Input != input.Name() || cp.Output != output.Name() {
+		return fmt.Errorf("checkpoint is for %s -> %s, not %s -> %s", cp.Input, cp.Output, input.Name(), output.Name())
+	}
+	in, err := input.Stat()
+	if err != nil {
+		return err
+	}
+	if in.Size() < cp.InputOffset {
+		return fmt.Errorf("%s is smaller than at the checkpoint (%d < %d bytes)", cp.Input, in.Size(), cp.InputOffset)
+	}
+	out, err := output.Stat()
+	if err != nil {
+		return err
+	}
+	if out.Size() < cp.OutputOffset {
+		return fmt.Errorf("%s is smaller than at the checkpoint (%d < %d bytes)", cp.Output, out.Size(), cp.OutputOffset)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go_for_devops/api"
+	"go_for_devops/api/apitest"
+	"go_for_devops/config"
+	"go_for_devops/fetch"
+)
+
+// runAPI implements the api subcommand. It sends a GET request to the API
+// of the configuration and prints the JSON response. With -all, it follows
+// the pagination links and prints all items of a collection.
+func runAPI(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("api", flag.ContinueOnError)
+	cfgPath := fset.String("config", config.DefaultPath, "configuration file")
+	all := fset.Bool("all", false, "fetch all pages of a collection")
+	fake := fset.Bool("fake", false, "use a local stand-in API, serving the users of users_source.txt at /users")
+	fail := fset.Int("fail", 0, "with -fake, let the first n requests fail to show retries")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: api [flags] PATH")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return fmt.Errorf("expected exactly one path")
+	}
+	path := fset.Arg(0)
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if *fake {
+		srv, err := newFakeAPI(cfg.API.APIKey)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+		srv.FailNext(*fail)
+		cfg.API.BaseURL = srv.URL
+	}
+
+	retryPolicy := fetch.DefaultRetryPolicy()
+	retryPolicy.OnRetry = func(e fetch.RetryEvent) {
+		slog.Warn("API request failed, retrying", "url", e.URL, "attempt", e.Attempt, "err", e.Err, "delay", e.Delay)
+	}
+	client, err := api.New(cfg.API, fetch.WithRetry(retryPolicy), fetch.WithObserver(observeFetch))
+	if err != nil {
+		return err
+	}
+
+	var out any
+	if *all {
+		out, err = api.All[json.RawMessage](ctx, client, path, nil)
+	} else {
+		var raw json.RawMessage
+		err = client.Get(ctx, path, nil, &raw)
+		out = raw
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// newFakeAPI starts a stand-in API that serves the embedded user records.
+func newFakeAPI(key string) (*apitest.Server, error) {
+	srv := apitest.NewServer(key)
+	for u := range decodeUsers(context.Background(), strings.NewReader(userSource)) {
+		if u.err != nil {
+			srv.Close()
+			return nil, u.err
+		}
+		srv.Add("users", u)
+	}
+	return srv, nil
+}
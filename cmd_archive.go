@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go_for_devops/archive"
+	"go_for_devops/walk"
+)
+
+// archiveUsage describes the actions of the archive subcommand.
+const archiveUsage = `Usage:
+  archive create [flags] ARCHIVE [PATTERN...]
+  archive list [flags] ARCHIVE
+  archive extract [flags] ARCHIVE
+
+ARCHIVE ends in .tar.gz, .tgz or .zip. The PATTERNs select the files to
+archive, like the -include flag of the walk subcommand. They default to the
+processed outputs: /users_processed.txt, csv_data/*, json_data/*.`
+
+// runArchive implements the archive subcommand. It creates, lists and
+// extracts tar.gz and zip archives (see archive/archive.go).
+func runArchive(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, archiveUsage)
+		return errors.New("missing action")
+	}
+	switch args[0] {
+	case "create":
+		return archiveCreate(args[1:])
+	case "list":
+		return archiveList(args[1:])
+	case "extract":
+		return archiveExtract(args[1:])
+	case "-h", "-help", "--help":
+		fmt.Fprintln(os.Stderr, archiveUsage)
+		return flag.ErrHelp
+	}
+	fmt.Fprintln(os.Stderr, archiveUsage)
+	return fmt.Errorf("unknown action %q", args[0])
+}
+
+// archiveFlagSet returns a flag set for an archive action, with the usage
+// of the action.
+func archiveFlagSet(action, args string) *flag.FlagSet {
+	fset := flag.NewFlagSet("archive "+action, flag.ContinueOnError)
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "Usage: archive %s [flags] %s\n", action, args)
+		fset.PrintDefaults()
+	}
+	return fset
+}
+
+// openArchive opens an archive on the disk. The binary only embeds the
+// json_data files, and no archives, so unlike create, list and extract have
+// no -embedded flag.
+func openArchive(name string) (*archive.Archive, error) {
+	return archive.Open(os.DirFS(filepath.Dir(name)), filepath.Base(name))
+}
+
+func archiveCreate(args []string) error {
+	var exclude patternFlags
+	fset := archiveFlagSet("create", "ARCHIVE [PATTERN...]")
+	fset.Var(&exclude, "exclude", "skip files and directories matching a glob pattern (repeatable)")
+	dir := fset.String("C", ".", "directory to archive the files of")
+	gitIgnore := fset.Bool("gitignore", false, "skip files ignored by .gitignore files, and the .git directory")
+	embedded := fset.Bool("embedded", false, "archive the files embedded in the binary instead of the directory")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 {
+		fset.Usage()
+		return errors.New("missing ARCHIVE")
+	}
+	name := fset.Arg(0)
+	format, err := archive.FormatOf(name)
+	if err != nil {
+		return err
+	}
+	include := fset.Args()[1:]
+	if len(include) == 0 {
+		include = []string{"/users_processed.txt", "csv_data/*", "json_data/*"}
+	}
+	for _, p := range include {
+		if err := walk.CheckPattern(p); err != nil {
+			return err
+		}
+	}
+
+	var fsys fs.FS = modulesFs
+	if !*embedded {
+		fsys = os.DirFS(*dir)
+		// Do not archive the archive itself (or its temporary file), if it
+		// is written into the directory.
+		if rel, err := filepath.Rel(*dir, name); err == nil && filepath.IsLocal(rel) {
+			exclude = append(exclude, "/"+filepath.ToSlash(rel), "/"+filepath.ToSlash(rel)+".tmp")
+		}
+	}
+
+	// Write to a temporary file first, so a failure does not leave a
+	// broken archive behind.
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	n, err := archive.Create(f, format, fsys, walk.Options{Include: include, Exclude: exclude, GitIgnore: *gitIgnore})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d files to %s\n", n, name)
+	return nil
+}
+
+func archiveList(args []string) error {
+	fset := archiveFlagSet("list", "ARCHIVE")
+	format := fset.String("format", "text", "output format: "+strings.Join(walk.Formats, ", "))
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return errors.New("expected ARCHIVE")
+	}
+	a, err := openArchive(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries, err := a.List()
+	if err != nil {
+		return err
+	}
+
+	w, err := walk.NewWriter(os.Stdout, *format, false)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := w.Write(e); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func archiveExtract(args []string) error {
+	fset := archiveFlagSet("extract", "ARCHIVE")
+	dir := fset.String("C", ".", "directory to extract the files into")
+	maxFiles := fset.Int("max-files", archive.DefaultLimits.MaxFiles, "maximum number of files to extract (0 means no limit)")
+	maxFileSize := fset.Int64("max-file-size", archive.DefaultLimits.MaxFileSize, "maximum size of a file in bytes (0 means no limit)")
+	maxTotalSize := fset.Int64("max-total-size", archive.DefaultLimits.MaxTotalSize, "maximum size of all files in bytes (0 means no limit)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return errors.New("expected ARCHIVE")
+	}
+	a, err := openArchive(fset.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries, err := a.Extract(*dir, archive.Limits{MaxFiles: *maxFiles, MaxFileSize: *maxFileSize, MaxTotalSize: *maxTotalSize})
+	for _, e := range entries {
+		fmt.Println(filepath.Join(*dir, filepath.FromSlash(e.Path)))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Extracted %d files into %s\n", len(entries), *dir)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go_for_devops/crawl"
+	"go_for_devops/fetch"
+)
+
+// runCrawl implements the crawl subcommand. URLs are taken from the
+// arguments and, optionally, from a file with one URL per line.
+func runCrawl(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	list := fset.String("list", "", "file with one URL per line (lines starting with # are skipped)")
+	out := fset.String("out", "crawl_data", "directory to write pages and the manifest to")
+	depth := fset.Int("depth", 0, "how many links to follow away from the seed URLs")
+	workers := fset.Int("workers", 4, "number of pages fetched concurrently")
+	maxPages := fset.Int("max-pages", 100, "maximum number of pages to fetch (0 means no limit)")
+	rate := fset.Duration("rate", time.Second, "minimum time between two requests to the same host")
+	robots := fset.Bool("robots", true, "respect robots.txt")
+	sameHost := fset.Bool("same-host", true, "only follow links to the hosts of the seed URLs")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: crawl [flags] [URL...]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	seeds := fset.Args()
+	if *list != "" {
+		listed, err := readURLList(*list)
+		if err != nil {
+			return err
+		}
+		seeds = append(seeds, listed...)
+	}
+	if len(seeds) == 0 {
+		fset.Usage()
+		return fmt.Errorf("no URLs given")
+	}
+
+	c := crawl.New(crawl.Config{
+		OutDir:          *out,
+		Workers:         *workers,
+		MaxDepth:        *depth,
+		MaxPages:        *maxPages,
+		PerHostInterval: *rate,
+		RespectRobots:   *robots,
+		SameHost:        *sameHost,
+		// The same fetcher the crawler would create, plus metrics.
+		Fetcher: fetch.New(
+			fetch.WithHeader("User-Agent", crawl.DefaultUserAgent),
+			fetch.WithRetry(fetch.DefaultRetryPolicy()),
+			fetch.WithObserver(observeFetch),
+		),
+		OnPage: func(p crawl.Page) {
+			if p.Error != "" {
+				fmt.Printf("[depth %d] %s: %s\n", p.Depth, p.URL, p.Error)
+				return
+			}
+			fmt.Printf("[depth %d] %s (%d bytes, %d links)\n", p.Depth, p.URL, p.Size, p.Links)
+		},
+	})
+
+	m, err := c.Run(ctx, seeds)
+	if m != nil {
+		fmt.Printf("Crawled %d pages, manifest written to %s\n", len(m.Pages), filepath.Join(*out, crawl.ManifestFile))
+	}
+	return err
+}
+
+// readURLList reads a file with one URL per line. Empty lines and lines
+// starting with # are skipped.
+func readURLList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+
+	"go_for_devops/fetch"
+)
+
+// runDownload implements the download subcommand. It streams a (large) file
+// to disk, resumes interrupted downloads and verifies the SHA-256 digest.
+func runDownload(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("download", flag.ContinueOnError)
+	out := fset.String("o", "", "file to write to (defaults to the last part of the URL path)")
+	sum := fset.String("sha256", "", "expected hex-encoded SHA-256 digest of the file")
+	quiet := fset.Bool("q", false, "do not print progress")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: download [flags] URL")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return fmt.Errorf("expected exactly one URL")
+	}
+	url := fset.Arg(0)
+
+	dest := *out
+	if dest == "" {
+		dest = path.Base(url)
+		if dest == "." || dest == "/" {
+			return fmt.Errorf("cannot derive a file name from %s, use -o", url)
+		}
+	}
+
+	opts := fetch.DownloadOptions{SHA256: *sum}
+	if !*quiet {
+		// \r moves the cursor back to the start of the line, so the
+		// progress is updated in place.
+		opts.Progress = func(p fetch.Progress) {
+			fmt.Fprintf(os.Stderr, "\r%-60s", p)
+			if p.Done {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+
+	// The fetcher's default client has a timeout for the whole request,
+	// which a large download would exceed, so use a client without one.
+	// The context still cancels the download on Ctrl+C.
+	f := fetch.New(
+		fetch.WithClient(&http.Client{}),
+		fetch.WithRetry(fetch.DefaultRetryPolicy()),
+		fetch.WithObserver(observeFetch),
+	)
+	if err := f.Download(ctx, url, dest, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("Downloaded %s to %s\n", url, dest)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go_for_devops/dupes"
+	"go_for_devops/walk"
+)
+
+// runDupes implements the dupes subcommand. It finds files with the same
+// content in one or more directories, and reports them, or replaces the
+// copies with hard links or deletes them.
+func runDupes(ctx context.Context, args []string) error {
+	var include, exclude patternFlags
+	fset := flag.NewFlagSet("dupes", flag.ContinueOnError)
+	fset.Var(&include, "include", "only compare files matching a glob pattern (repeatable)")
+	fset.Var(&exclude, "exclude", "skip files and directories matching a glob pattern (repeatable)")
+	gitIgnore := fset.Bool("gitignore", false, "skip files ignored by .gitignore files, and the .git directory")
+	minSize := fset.Int64("min-size", 1, "only compare files of at least this many bytes")
+	workers := fset.Int("workers", 0, "number of files to hash at the same time (defaults to the number of CPUs)")
+	link := fset.Bool("link", false, "replace the copies with hard links to the first file")
+	remove := fset.Bool("delete", false, "delete the copies, keeping the first file")
+	dryRun := fset.Bool("dry-run", false, "only print what -link or -delete would do")
+	asJSON := fset.Bool("json", false, "print the groups of duplicates as JSON")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: dupes [flags] [DIR...]")
+		fmt.Fprintln(fset.Output(), "DIR defaults to the current directory. In every group of duplicates, the")
+		fmt.Fprintln(fset.Output(), "first file (by the order of the DIRs, then by name) is the one kept.")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *link && *remove {
+		return errors.New("-link and -delete cannot be used together")
+	}
+	dirs := fset.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	groups, err := dupes.Find(ctx, dirs, dupes.Options{
+		Walk: walk.Options{
+			Include:   include,
+			Exclude:   exclude,
+			GitIgnore: *gitIgnore,
+			MinSize:   *minSize,
+		},
+		Workers: *workers,
+		OnError: func(path string, err error) {
+			slog.Warn("Skipping unreadable file", "file", path, "err", err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(groups); err != nil {
+			return err
+		}
+	}
+
+	action, verb := "", "copy"
+	switch {
+	case *link:
+		action, verb = "link", "linked"
+	case *remove:
+		action, verb = "delete", "deleted"
+	}
+	if *dryRun && action != "" {
+		verb = "would " + action
+	}
+
+	var copies int
+	var wasted, freed int64
+	var errs []error
+	for _, g := range groups {
+		copies += len(g.Files) - 1
+		wasted += g.Wasted()
+		if !*asJSON {
+			fmt.Printf("%d files of %d bytes, sha256 %.16s\n", len(g.Files), g.Size, g.SHA256)
+			fmt.Printf("  keep    %s\n", g.Files[0].Path)
+		}
+
+		done := g.Files[1:]
+		if action != "" && !*dryRun {
+			var err error
+			if *link {
+				done, err = dupes.Link(g)
+			} else {
+				done, err = dupes.Remove(g)
+			}
+			if err != nil {
+				slog.Error("Could not "+action+" duplicates", "keep", g.Files[0].Path, "err", err)
+				errs = append(errs, err)
+			}
+			freed += g.Size * int64(len(done))
+		}
+		if !*asJSON {
+			for _, f := range done {
+				fmt.Printf("  %-7s %s\n", verb, f.Path)
+			}
+		}
+	}
+
+	// The summary goes to stderr with -json, to keep stdout valid JSON.
+	out := os.Stdout
+	if *asJSON {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%d groups, %d copies, %d bytes in copies", len(groups), copies, wasted)
+	if action != "" && !*dryRun {
+		fmt.Fprintf(out, ", %d bytes freed", freed)
+	}
+	fmt.Fprintln(out)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"go_for_devops/extract"
+	"go_for_devops/fetch"
+)
+
+// selectorFlags collects repeated -select name=selector flags.
+type selectorFlags map[string]*extract.Selector
+
+// String implements the flag.Value interface.
+func (s selectorFlags) String() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Set implements the flag.Value interface.
+func (s selectorFlags) Set(value string) error {
+	name, sel, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=selector, got %q", value)
+	}
+	compiled, err := extract.Compile(sel)
+	if err != nil {
+		return err
+	}
+	s[name] = compiled
+	return nil
+}
+
+// runExtract implements the extract subcommand. It reads an HTML page from
+// a file (remoteData.html by default) or a URL and prints its data as JSON.
+func runExtract(ctx context.Context, args []string) error {
+	selectors := selectorFlags{}
+	fset := flag.NewFlagSet("extract", flag.ContinueOnError)
+	fset.Var(selectors, "select", "extract values with a CSS selector, as name=selector (repeatable), e.g. links='a[href]::attr(href)'")
+	base := fset.String("base", "", "base URL to resolve relative links against (defaults to the page URL)")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: extract [flags] [FILE|URL]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	source := "remoteData.html"
+	if fset.NArg() > 0 {
+		source = fset.Arg(0)
+	}
+
+	var (
+		r       io.Reader
+		baseURL *url.URL
+	)
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := fetch.New(fetch.WithObserver(observeFetch)).Get(ctx, source)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(resp.Body)
+		baseURL, _ = url.Parse(resp.URL)
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if *base != "" {
+		u, err := url.Parse(*base)
+		if err != nil {
+			return fmt.Errorf("invalid base URL: %w", err)
+		}
+		baseURL = u
+	}
+
+	page, err := extract.Extract(r, extract.Options{BaseURL: baseURL, Selectors: selectors})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(page)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"go_for_devops/fetch"
+)
+
+// httpCacheDir is where fetched pages are cached between runs.
+const httpCacheDir = ".cache/http"
+
+// newHTTPCache creates the on-disk HTTP cache shared by the examples and the
+// fetch subcommand. In offline mode, pages are served from the cache only.
+func newHTTPCache(dir string, offline bool) (*fetch.Cache, error) {
+	store, err := fetch.NewDiskStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	cache := fetch.NewCache(store)
+	cache.Offline = offline
+	return cache, nil
+}
+
+// runFetch implements the fetch subcommand. It downloads a page through the
+// HTTP cache and writes it to a local file.
+func runFetch(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	offline := fset.Bool("offline", false, "serve the page from the cache only, without network access")
+	cacheDir := fset.String("cache", httpCacheDir, "directory of the HTTP cache")
+	out := fset.String("out", "remoteData.html", "file to write the page to")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: fetch [flags] [URL]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	url := "https://www.devdungeon.com/content/web-scraping-go"
+	if fset.NArg() > 0 {
+		url = fset.Arg(0)
+	}
+
+	cache, err := newHTTPCache(*cacheDir, *offline)
+	if err != nil {
+		return err
+	}
+	f := fetch.New(fetch.WithCache(cache), fetch.WithRetry(fetch.DefaultRetryPolicy()), fetch.WithObserver(observeFetch))
+
+	resp, err := f.Get(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(*out, resp.Body, 0644); err != nil {
+		return err
+	}
+
+	source := "network"
+	if resp.FromCache {
+		source = "cache"
+	}
+	fmt.Printf("Wrote %d bytes from %s (%s) to %s\n", len(resp.Body), url, source, *out)
+	return nil
+}
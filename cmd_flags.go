@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"go_for_devops/config"
+	"go_for_devops/flags"
+)
+
+// flagTarget returns the user as a target for feature flags.
+func (u User) flagTarget() flags.Target {
+	return flags.Target{ID: u.ID, Name: u.Name}
+}
+
+// runFlags implements the flags subcommand. It lists the feature flags of
+// the configuration and shows whether they are on for the given users.
+func runFlags(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("flags", flag.ContinueOnError)
+	cfgPath := fset.String("config", config.DefaultPath, "configuration file")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: flags [flags] [name:id ...]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	var users []User
+	for _, arg := range fset.Args() {
+		u, err := getUser(arg)
+		if err != nil {
+			return err
+		}
+		users = append(users, u)
+	}
+
+	set, err := flags.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+	for _, name := range set.Names() {
+		f, _ := set.Get(name)
+		fmt.Printf("%-24s %s\n", name, describeFlag(f))
+		for _, u := range users {
+			fmt.Printf("  %-22s %t\n", u, set.EnabledFor(name, u.flagTarget()))
+		}
+	}
+	return nil
+}
+
+// describeFlag summarises a flag for humans.
+func describeFlag(f flags.Flag) string {
+	var parts []string
+	if f.Enabled {
+		parts = append(parts, "on")
+	} else {
+		parts = append(parts, "off")
+	}
+	if f.Value != 0 {
+		parts = append(parts, fmt.Sprintf("value=%g", f.Value))
+	}
+	if f.Rollout < 100 {
+		parts = append(parts, fmt.Sprintf("rollout=%g%%", f.Rollout))
+	}
+	if len(f.Users) > 0 {
+		parts = append(parts, fmt.Sprintf("users=%v", f.Users))
+	}
+	if len(f.Names) > 0 {
+		parts = append(parts, fmt.Sprintf("names=%v", f.Names))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"go_for_devops/pipeline"
+)
+
+// runImport implements the import subcommand. It decodes the user records
+// of the input file and writes the valid users to the output file, saving
+// a checkpoint every few users (see checkpoint.go). An import that was
+// cancelled or stopped at an invalid record continues at the checkpoint
+// with -resume, instead of starting over at line 1.
+func runImport(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fset.String("in", "users_source.txt", "user records to import")
+	out := fset.String("out", "users_processed.txt", "file to write the users to")
+	resume := fset.Bool("resume", false, "continue after the last checkpoint instead of starting over")
+	every := fset.Int("every", 1000, "save a checkpoint after this many users (0 only saves one when the import stops)")
+	syncFlag := fset.String("sync", "batch", "when to sync the output to the disk: never, batch or close")
+	delay := fset.Duration("delay", 0, "wait this long after every user, to try out cancelling and resuming")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	policy, err := parseSyncPolicy(*syncFlag)
+	if err != nil {
+		return err
+	}
+
+	input, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	// Do not truncate the output yet, it may be resumed.
+	output, err := os.OpenFile(*out, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	// Start over, or continue after the last checkpoint.
+	cpPath := checkpointPath(*out)
+	start := importCheckpoint{Input: *in, Output: *out}
+	if *resume {
+		saved, err := loadCheckpoint(cpPath)
+		if err != nil {
+			return err
+		}
+		if saved == nil {
+			fmt.Printf("No checkpoint in %s, starting from the beginning\n", cpPath)
+		} else {
+			if err := saved.check(input, output); err != nil {
+				return fmt.Errorf("cannot resume: %w", err)
+			}
+			start = *saved
+			fmt.Printf("Resuming at line %d of %s, %d users written so far\n", start.Line+1, *in, start.Users)
+		}
+	}
+
+	// Like main.go seeks userFile back to 0 to read it again, seek both
+	// files to the checkpoint. Truncating the output drops the users that
+	// were written after the checkpoint, which are read again.
+	if _, err := input.Seek(start.InputOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := output.Truncate(start.OutputOffset); err != nil {
+		return err
+	}
+	if _, err := output.Seek(start.OutputOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	w := newUserWriter(output, userWriterOptions{Sync: policy})
+	// progress is the checkpoint after the last user given to w. It is
+	// only used by the sink stage, and by this goroutine after Wait.
+	progress := start
+	checkpoint := func() error {
+		// The users up to the checkpoint must be in the file first. With
+		// -sync never, they may still be in the cache of the operating
+		// system, which is enough if only the process dies.
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		pos, err := output.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		progress.OutputOffset = pos
+		progress.Time = time.Now()
+		return progress.save(cpPath)
+	}
+
+	// The line numbers and offsets of the pipeline start at the position
+	// the input was seeked to.
+	p := pipeline.New(ctx, "import_users")
+	records := decodeUserRecords(p, input)
+	pipeline.Sink(records, "write", func(ctx context.Context, rec userRecord) error {
+		if rec.User.err != nil {
+			return fmt.Errorf("%s:%d: %w", *in, start.Line+rec.Line.Num, rec.User.err)
+		}
+		if err := w.Write(ctx, rec.User); err != nil {
+			return err
+		}
+		progress.InputOffset = start.InputOffset + rec.Line.End
+		progress.Line = start.Line + rec.Line.Num
+		progress.Users++
+
+		if *every > 0 && (progress.Users-start.Users)%*every == 0 {
+			if err := checkpoint(); err != nil {
+				return fmt.Errorf("saving checkpoint: %w", err)
+			}
+		}
+		if *delay > 0 {
+			select {
+			case <-time.After(*delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	if err := p.Wait(); err != nil {
+		// Save the progress up to the last user that was written, so the
+		// import can be resumed.
+		if cerr := checkpoint(); cerr != nil {
+			return errors.Join(err, fmt.Errorf("saving checkpoint: %w", cerr))
+		}
+		fmt.Fprintf(os.Stderr, "Stopped after line %d with %d users written, continue with -resume\n", progress.Line, progress.Users)
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// The import is complete, so there is nothing left to resume.
+	if err := os.Remove(cpPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	fmt.Printf("Imported %d users from %s to %s\n", progress.Users, *in, *out)
+	return nil
+}
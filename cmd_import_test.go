@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// importFiles writes an input file with n users and a comment line every
+// 10 lines, and returns its path, the path of the output and the users the
+// output must contain after the import.
+func importFiles(t *testing.T, n int) (in, out string, want []string) {
+	dir := t.TempDir()
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "# comment before user %d\n", i)
+		}
+		u := fmt.Sprintf("user%d:%d", i, i)
+		b.WriteString(u + "\n")
+		want = append(want, u)
+	}
+	in = filepath.Join(dir, "users.txt")
+	if err := os.WriteFile(in, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return in, filepath.Join(dir, "out.txt"), want
+}
+
+// checkImported fails the test unless out contains exactly the users of
+// want, in order, and no checkpoint is left.
+func checkImported(t *testing.T, out string, want []string) {
+	t.Helper()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	seen := map[string]int{}
+	for _, u := range got {
+		seen[u]++
+	}
+	for u, n := range seen {
+		if n > 1 {
+			t.Errorf("%s was imported %d times", u, n)
+		}
+	}
+	for _, u := range want {
+		if seen[u] == 0 {
+			t.Errorf("%s is missing", u)
+		}
+	}
+	if len(got) != len(want) || strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("output has %d users, want %d in input order", len(got), len(want))
+	}
+	if _, err := os.Stat(checkpointPath(out)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the checkpoint is still there after a complete import: %v", err)
+	}
+}
+
+func TestImportCancelAndResume(t *testing.T) {
+	in, out, want := importFiles(t, 300)
+
+	// Cancel the import part of the way through, like Ctrl-C does.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(80*time.Millisecond, cancel)
+	err := runImport(ctx, []string{"-in", in, "-out", out, "-every", "7", "-delay", "1ms"})
+	cancel()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("first run: %v, want context.Canceled", err)
+	}
+
+	cp, err := loadCheckpoint(checkpointPath(out))
+	if err != nil || cp == nil {
+		t.Fatalf("no checkpoint after cancelling: %v", err)
+	}
+	if cp.Users == 0 || cp.Users >= len(want) {
+		t.Fatalf("checkpoint after %d users, want the import stopped half-way", cp.Users)
+	}
+	if info, _ := os.Stat(out); info.Size() != cp.OutputOffset {
+		t.Errorf("output has %d bytes, checkpoint says %d", info.Size(), cp.OutputOffset)
+	}
+
+	if err := runImport(context.Background(), []string{"-in", in, "-out", out, "-every", "7", "-resume"}); err != nil {
+		t.Fatalf("resuming: %v", err)
+	}
+	checkImported(t, out, want)
+}
+
+func TestImportResumeAfterCrash(t *testing.T) {
+	in, out, want := importFiles(t, 100)
+
+	// An invalid record stops the import at line 60.
+	data, _ := os.ReadFile(in)
+	broken := strings.Replace(string(data), "user55:55\n", "user55:xx\n", 1)
+	os.WriteFile(in, []byte(broken), 0644)
+	err := runImport(context.Background(), []string{"-in", in, "-out", out, "-every", "10"})
+	if err == nil || !strings.Contains(err.Error(), ":60:") {
+		t.Fatalf("first run: %v, want an error at line 60", err)
+	}
+
+	// If the process had died instead, the output could have more users
+	// than the checkpoint says. Resuming must drop them.
+	f, _ := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("user51:51\nuser52:5")
+	f.Close()
+
+	// Fix the record and continue.
+	os.WriteFile(in, data, 0644)
+	if err := runImport(context.Background(), []string{"-in", in, "-out", out, "-every", "10", "-resume"}); err != nil {
+		t.Fatalf("resuming: %v", err)
+	}
+	checkImported(t, out, want)
+}
+
+func TestImportResumeWithoutCheckpoint(t *testing.T) {
+	in, out, want := importFiles(t, 20)
+	// Without a checkpoint, -resume starts over and replaces the output.
+	os.WriteFile(out, []byte("old:1\n"), 0644)
+	if err := runImport(context.Background(), []string{"-in", in, "-out", out, "-resume"}); err != nil {
+		t.Fatal(err)
+	}
+	checkImported(t, out, want)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go_for_devops/watch"
+)
+
+// runInbox implements the inbox subcommand. It watches the inbox directory
+// and processes every file that is dropped into it (see inbox.go), until
+// it is interrupted.
+func runInbox(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("inbox", flag.ContinueOnError)
+	dir := fset.String("dir", "inbox", "directory to watch for new files")
+	outbox := fset.String("out", "outbox", "directory to write the results to")
+	poll := fset.Bool("poll", false, "poll the directory instead of using file system notifications")
+	interval := fset.Duration("interval", time.Second, "how often to poll the directory")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	b := &inbox{dir: *dir, outbox: *outbox}
+	if err := b.setup(); err != nil {
+		return err
+	}
+	handle := func(path string) {
+		if err := b.process(ctx, path); err != nil {
+			fmt.Printf("Failed %s: %s\n", path, err)
+			return
+		}
+		fmt.Printf("Processed %s\n", path)
+	}
+
+	fmt.Printf("Watching %s, results go to %s (Ctrl+C to stop)\n", *dir, *outbox)
+	if !*poll {
+		err := watch.Notify(ctx, *dir, handle)
+		if !errors.Is(err, watch.ErrNotSupported) {
+			return err
+		}
+		slog.Info("File system notifications are not available, polling instead", "interval", *interval)
+	}
+	return watch.Poll(ctx, *dir, *interval, handle)
+}
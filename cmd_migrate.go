@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"go_for_devops/config"
+	"go_for_devops/db"
+)
+
+// runMigrate implements the migrate subcommand. It connects to the
+// database of the configuration and applies the pending schema migrations.
+func runMigrate(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	cfgPath := fset.String("config", config.DefaultPath, "configuration file")
+	dsnOnly := fset.Bool("dsn", false, "print the data source name (without password) and exit")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if *dsnOnly {
+		fmt.Println(db.DSN(cfg.Redacted().Database, cfg.Features.DefaultTimeout()))
+		return nil
+	}
+
+	conn, err := db.OpenConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, err := conn.Migrate(ctx)
+	for _, version := range applied {
+		fmt.Println("Applied", version)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("Database is up to date")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go_for_devops/config"
+	"go_for_devops/notify"
+	"go_for_devops/notify/smtptest"
+)
+
+// runReport implements the report subcommand. It validates the CSV files
+// and the user records, and sends the result as an email report through
+// the SMTP server of the email configuration.
+func runReport(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("report", flag.ContinueOnError)
+	to := fset.String("to", "", "comma-separated recipients of the report")
+	csvDir := fset.String("csv", "csv_data", "directory with the CSV files to validate")
+	usersFile := fset.String("users", "users_source.txt", "user records to validate")
+	cfgPath := fset.String("config", config.DefaultPath, "configuration file")
+	fake := fset.Bool("fake", false, "send to a local fake SMTP server and print the message")
+	printOnly := fset.Bool("print", false, "print the report instead of sending it")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+
+	report := notify.Report{App: cfg.AppName, Title: "Data validation", Started: time.Now()}
+	csvFiles, _ := filepath.Glob(filepath.Join(*csvDir, "*.csv"))
+	var records int
+	for _, path := range csvFiles {
+		n, failures, err := validateCSVFile(path)
+		if err != nil {
+			return err
+		}
+		records += n
+		report.Failures = append(report.Failures, failures...)
+	}
+	users, failures, err := validateUserFile(*usersFile)
+	if err != nil {
+		return err
+	}
+	report.Failures = append(report.Failures, failures...)
+	report.Finished = time.Now()
+	report.Summary = []notify.Stat{
+		{Name: "CSV files", Value: len(csvFiles)},
+		{Name: "CSV records", Value: records},
+		{Name: "Users", Value: users},
+		{Name: "Failures", Value: len(report.Failures)},
+	}
+
+	var recipients []string
+	for _, addr := range strings.Split(*to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			recipients = append(recipients, addr)
+		}
+	}
+	if len(recipients) == 0 {
+		recipients = []string{cfg.Email.From}
+	}
+	msg, err := report.Message(recipients...)
+	if err != nil {
+		return err
+	}
+	if *printOnly {
+		fmt.Printf("Subject: %s\n\n%s", msg.Subject, msg.Text)
+		return nil
+	}
+
+	if !*fake {
+		if err := notify.NewMailer(cfg.Email).Send(ctx, msg); err != nil {
+			return err
+		}
+		fmt.Printf("Sent %q to %s\n", msg.Subject, strings.Join(recipients, ", "))
+		return nil
+	}
+
+	// Send the report to a local server instead, to see what would be
+	// sent without a real mail server.
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	cfg.Email.SMTPHost, cfg.Email.SMTPPort = srv.Host(), srv.Port()
+	mailer := notify.NewMailer(cfg.Email)
+	mailer.TLSConfig = srv.ClientTLSConfig()
+	if err := mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+	for _, m := range srv.Messages() {
+		fmt.Printf("Fake SMTP server received a message from %s to %s (TLS: %t, user: %q):\n\n%s\n",
+			m.From, strings.Join(m.To, ", "), m.TLS, m.Username, m.Data)
+	}
+	return nil
+}
+
+// validateCSVFile checks that every record of a CSV file has a first and a
+// last name. Unlike readRecsCSV, it does not stop at the first invalid
+// record. It returns the number of records and the failures.
+func validateCSVFile(path string) (int, []notify.Failure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	// Check the number of fields ourselves, so a bad record does not
+	// end the validation.
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var n int
+	var failures []notify.Failure
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		csvLinesRead.Inc()
+		line, _ := r.FieldPos(0)
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			csvRecordsRejected.Inc()
+			failures = append(failures, notify.Failure{Source: path, Line: perr.Line, Err: perr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return n, failures, err
+		}
+		n++
+		if err := csvRecord(rec).validate(); err != nil {
+			csvRecordsRejected.Inc()
+			failures = append(failures, notify.Failure{
+				Source: path,
+				Line:   line,
+				Err:    fmt.Sprintf("%s: expected 2 fields, got %d", err, len(rec)),
+			})
+			continue
+		}
+		csvRecordsRead.Inc()
+	}
+	return n, failures, nil
+}
+
+// validateUserFile checks every user record of a file, like decodeUsers,
+// but continues after invalid records. It returns the number of valid
+// users and the failures.
+func validateUserFile(path string) (int, []notify.Failure, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	var n, line int
+	var failures []notify.Failure
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line++
+		userLinesRead.Inc()
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") {
+			usersSkipped.Inc()
+			continue
+		}
+		if _, err := getUser(text); err != nil {
+			usersRejected.Inc()
+			failures = append(failures, notify.Failure{Source: path, Line: line, Err: err.Error()})
+			continue
+		}
+		usersDecoded.Inc()
+		n++
+	}
+	return n, failures, scanner.Err()
+}
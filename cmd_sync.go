@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"go_for_devops/mirror"
+	"go_for_devops/walk"
+)
+
+// runSync implements the sync subcommand. It copies a directory tree to
+// another directory, skipping the files that are up to date (see
+// mirror/mirror.go).
+func runSync(ctx context.Context, args []string) error {
+	var include, exclude patternFlags
+	fset := flag.NewFlagSet("sync", flag.ContinueOnError)
+	fset.Var(&include, "include", "only copy files matching a glob pattern (repeatable)")
+	fset.Var(&exclude, "exclude", "skip files and directories matching a glob pattern (repeatable)")
+	gitIgnore := fset.Bool("gitignore", false, "skip files ignored by .gitignore files, and the .git directory")
+	checksum := fset.Bool("checksum", false, "compare the content of files, instead of their size and modification time")
+	del := fset.Bool("delete", false, "delete files in DST that are not in SRC")
+	dryRun := fset.Bool("dry-run", false, "only print what would be done")
+	verify := fset.Bool("verify", false, "compare the SHA-256 digests of all files and their copies after the sync")
+	quiet := fset.Bool("q", false, "only print the summary")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: sync [flags] SRC DST")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return errors.New("expected SRC and DST")
+	}
+	src, dst := fset.Arg(0), fset.Arg(1)
+
+	opts := mirror.Options{
+		Walk: walk.Options{
+			Include:   include,
+			Exclude:   exclude,
+			GitIgnore: *gitIgnore,
+		},
+		Checksum: *checksum,
+		Delete:   *del,
+		DryRun:   *dryRun,
+		Verify:   *verify,
+	}
+	if !*quiet {
+		opts.OnAction = func(a mirror.Action) {
+			fmt.Printf("%-6s %s\n", a.Op, a.Path)
+		}
+	}
+	stats, err := mirror.Sync(ctx, src, dst, opts)
+
+	prefix := ""
+	if *dryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Printf("%s%d copied, %d updated, %d touched, %d deleted, %d unchanged, %d bytes copied\n",
+		prefix, stats.Copied, stats.Updated, stats.Touched, stats.Deleted, stats.Unchanged, stats.Bytes)
+	if err == nil && *verify && !*dryRun {
+		fmt.Println("Verified: all copies match their source")
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// runTail implements the tail subcommand. It prints the users that are
+// appended to a user file, like `tail -f`, until it is interrupted.
+func runTail(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fromStart := fset.Bool("from-start", false, "print the users already in the file first")
+	interval := fset.Duration("interval", 250*time.Millisecond, "how often to check the file for new lines")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: tail [flags] [FILE]")
+		fmt.Fprintln(fset.Output(), "FILE defaults to users_source.txt.")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	path := "users_source.txt"
+	if fset.NArg() > 0 {
+		path = fset.Arg(0)
+	}
+
+	users, err := followUsers(ctx, path, followOptions{FromStart: *fromStart, Interval: *interval})
+	if err != nil {
+		return err
+	}
+	for u := range users {
+		var invalid *userRecordError
+		switch {
+		case errors.As(u.err, &invalid):
+			slog.Warn("Skipping invalid user record", "file", path, "err", invalid)
+		case errors.Is(u.err, context.Canceled):
+			// Interrupted, which is the usual way to stop following.
+			return nil
+		case u.err != nil:
+			return u.err
+		default:
+			fmt.Println(u)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"go_for_devops/walk"
+)
+
+// patternFlags collects repeated glob pattern flags, like -include.
+type patternFlags []string
+
+// String implements the flag.Value interface.
+func (p *patternFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+// Set implements the flag.Value interface.
+func (p *patternFlags) Set(value string) error {
+	// Check the pattern now, walk.Match treats a malformed one as no match.
+	if err := walk.CheckPattern(value); err != nil {
+		return err
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// runWalk implements the walk subcommand. It lists the files of a directory
+// tree, or of the files embedded in the binary, with their metadata.
+func runWalk(ctx context.Context, args []string) error {
+	var include, exclude patternFlags
+	fset := flag.NewFlagSet("walk", flag.ContinueOnError)
+	fset.Var(&include, "include", "only list files matching a glob pattern (repeatable), e.g. '**/*.go'")
+	fset.Var(&exclude, "exclude", "skip files and directories matching a glob pattern (repeatable)")
+	gitIgnore := fset.Bool("gitignore", true, "skip files ignored by .gitignore files, and the .git directory")
+	depth := fset.Int("depth", 0, "how many directory levels to descend, 1 lists only DIR itself (0 means no limit)")
+	minSize := fset.Int64("min-size", 0, "only list files of at least this many bytes")
+	maxSize := fset.Int64("max-size", 0, "only list files of at most this many bytes (0 means no limit)")
+	newer := fset.Duration("newer", 0, "only list files modified within this duration, e.g. 24h")
+	older := fset.Duration("older", 0, "only list files modified longer ago than this duration")
+	hash := fset.Bool("hash", false, "compute the SHA-256 digest of every file")
+	format := fset.String("format", "text", "output format: "+strings.Join(walk.Formats, ", "))
+	embedded := fset.Bool("embedded", false, "walk the files embedded in the binary instead of DIR")
+	fset.Usage = func() {
+		fmt.Fprintln(fset.Output(), "Usage: walk [flags] [DIR]")
+		fmt.Fprintln(fset.Output(), "DIR defaults to the current directory.")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	var fsys fs.FS = modulesFs
+	if !*embedded {
+		dir := "."
+		if fset.NArg() > 0 {
+			dir = fset.Arg(0)
+		}
+		fsys = os.DirFS(dir)
+	}
+
+	opts := walk.Options{
+		Include:   include,
+		Exclude:   exclude,
+		GitIgnore: *gitIgnore,
+		MaxDepth:  *depth,
+		MinSize:   *minSize,
+		MaxSize:   *maxSize,
+		Hash:      *hash,
+	}
+	now := time.Now()
+	if *newer > 0 {
+		opts.ModifiedAfter = now.Add(-*newer)
+	}
+	if *older > 0 {
+		opts.ModifiedBefore = now.Add(-*older)
+	}
+
+	w, err := walk.NewWriter(os.Stdout, *format, *hash)
+	if err != nil {
+		return err
+	}
+	err = walk.Walk(fsys, ".", opts, func(e walk.Entry) error {
+		// Stop early when interrupted, walking a large tree takes a while.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return w.Write(e)
+	})
+	// Complete the output even after an error, so it stays valid JSON.
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
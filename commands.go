@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go_for_devops/config"
+)
+
+/**
+* Subcommands.
+*
+* Running the binary without arguments runs all the examples in main().
+* Passing a subcommand as the first argument runs that tool instead, e.g.
+* go run . crawl -depth 2 https://www.devdungeon.com/
+**/
+
+// command is a tool that can be run as a subcommand of the binary.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands lists all available subcommands.
+var commands = []command{
+	{name: "crawl", summary: "fetch pages concurrently and save them with a manifest", run: runCrawl},
+	{name: "serve", summary: "run the HTTP API for users, CSV and config data", run: runServe},
+	{name: "fetch", summary: "download a page through the HTTP cache (supports -offline)", run: runFetch},
+	{name: "download", summary: "stream a file to disk with resume, progress and SHA-256 check", run: runDownload},
+	{name: "extract", summary: "extract structured data from an HTML page as JSON", run: runExtract},
+	{name: "import", summary: "import user records with checkpoints, and resume with -resume", run: runImport},
+	{name: "tail", summary: "print the users appended to a user file, like tail -f", run: runTail},
+	{name: "inbox", summary: "process user and CSV files dropped into an inbox directory", run: runInbox},
+	{name: "walk", summary: "list the files of a directory tree with include/exclude globs and metadata", run: runWalk},
+	{name: "dupes", summary: "find duplicate files, and hard-link or delete the copies", run: runDupes},
+	{name: "sync", summary: "copy a directory tree, skipping unchanged files, like rsync", run: runSync},
+	{name: "archive", summary: "create, list and extract tar.gz and zip archives", run: runArchive},
+	{name: "migrate", summary: "apply the database schema migrations", run: runMigrate},
+	{name: "report", summary: "validate the CSV and user files and email a report", run: runReport},
+	{name: "flags", summary: "list the feature flags and evaluate them for users", run: runFlags},
+	{name: "api", summary: "send a GET request to the configured API and print the JSON", run: runAPI},
+}
+
+// runCommand runs the subcommand name with args and returns the exit code.
+// The context passed to the subcommand is cancelled on SIGINT or SIGTERM,
+// so long-running commands can shut down gracefully.
+func runCommand(name string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	closeLog := setupLogging(config.DefaultPath)
+	defer closeLog()
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(ctx, args); err != nil {
+			// The flag package already printed the usage for -h.
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\nAvailable commands:\n", name)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	return 2
+}
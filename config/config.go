@@ -0,0 +1,202 @@
+// Package config loads the application configuration from
+// json_data/config.json into typed structs.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// DefaultPath is the location of the configuration file, relative to the
+// module root.
+const DefaultPath = "json_data/config.json"
+
+// redacted replaces secrets in Redacted.
+const redacted = "REDACTED"
+
+// Config is the complete application configuration.
+type Config struct {
+	AppName     string   `json:"appName"`
+	Version     string   `json:"version"`
+	Environment string   `json:"environment"`
+	Database    Database `json:"database"`
+	Logging     Logging  `json:"logging"`
+	Features    Features `json:"features"`
+	API         API      `json:"api"`
+	Email       Email    `json:"email"`
+	Storage     Storage  `json:"storage"`
+}
+
+// Database holds the connection settings of the MySQL database, see the db
+// package.
+type Database struct {
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	User         string `json:"user"`
+	Password     string `json:"password"`
+	DatabaseName string `json:"databaseName"`
+}
+
+// Logging configures the application log.
+type Logging struct {
+	// Level is one of debug, info, warn or error.
+	Level string `json:"level"`
+	// Format is either text or json.
+	Format string `json:"format"`
+	// File is the log file. If empty, the log is written to stderr.
+	File string `json:"file"`
+	// MaxSizeMB is the size in megabytes at which the log file is rotated.
+	MaxSizeMB int `json:"maxSizeMB"`
+	// MaxBackups is the number of rotated log files to keep.
+	MaxBackups int `json:"maxBackups"`
+}
+
+// Features holds feature switches and tuning knobs.
+type Features struct {
+	EnableFeatureX          bool `json:"enableFeatureX"`
+	MaxItemsToShow          int  `json:"maxItemsToShow"`
+	DefaultTimeoutInSeconds int  `json:"defaultTimeoutInSeconds"`
+}
+
+// DefaultTimeout returns DefaultTimeoutInSeconds as a time.Duration.
+func (f Features) DefaultTimeout() time.Duration {
+	return time.Duration(f.DefaultTimeoutInSeconds) * time.Second
+}
+
+// API configures the client of the remote API.
+type API struct {
+	BaseURL string `json:"baseUrl"`
+	APIKey  string `json:"apiKey"`
+	// Timeout is the request timeout in milliseconds.
+	Timeout int `json:"timeout"`
+}
+
+// TimeoutDuration returns Timeout as a time.Duration.
+func (a API) TimeoutDuration() time.Duration {
+	return time.Duration(a.Timeout) * time.Millisecond
+}
+
+// Email holds the settings of the SMTP server used to send mail.
+type Email struct {
+	SMTPHost string `json:"smtpHost"`
+	SMTPPort int    `json:"smtpPort"`
+	From     string `json:"from"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	UseTLS   bool   `json:"useTLS"`
+}
+
+// Storage selects where user records are stored.
+type Storage struct {
+	// Backend is one of file, memory, bolt or mysql. The mysql backend
+	// uses the database section.
+	Backend string `json:"backend"`
+	// Path is the users file for the file backend, or the database file
+	// for the bolt backend.
+	Path string `json:"path"`
+	// Source is the file the file backend reads until Path exists.
+	Source string `json:"source"`
+	// Sync is when the file backend syncs written users to the disk:
+	// never, batch (after every batch) or close (once per update).
+	Sync string `json:"sync"`
+}
+
+// Default returns the configuration used for every setting that the
+// configuration file does not set.
+func Default() Config {
+	return Config{
+		AppName:     "go_for_devops",
+		Environment: "development",
+		Database:    Database{Host: "localhost", Port: 3306},
+		Logging:     Logging{Level: "info", Format: "text", MaxSizeMB: 10, MaxBackups: 3},
+		Features:    Features{MaxItemsToShow: 50, DefaultTimeoutInSeconds: 30},
+		API:         API{Timeout: 5000},
+		Email:       Email{SMTPPort: 587, UseTLS: true},
+		Storage:     Storage{Backend: "file", Path: "users_processed.txt", Source: "users_source.txt", Sync: "close"},
+	}
+}
+
+// Load reads the configuration file at path on top of the defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes a JSON configuration on top of the defaults and validates
+// the result.
+func Parse(data []byte) (*Config, error) {
+	// Decoding into a struct that already holds the defaults only
+	// overwrites the fields that are present in the JSON.
+	cfg := Default()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks that the configuration values are usable.
+func (c Config) Validate() error {
+	if c.Database.Port < 0 || c.Database.Port > 65535 {
+		return fmt.Errorf("database.port %d is out of range", c.Database.Port)
+	}
+	if c.Email.SMTPPort < 0 || c.Email.SMTPPort > 65535 {
+		return fmt.Errorf("email.smtpPort %d is out of range", c.Email.SMTPPort)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		return fmt.Errorf("logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxBackups < 0 {
+		return fmt.Errorf("logging.maxSizeMB and logging.maxBackups must not be negative")
+	}
+	switch c.Logging.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("logging.format must be text or json, got %q", c.Logging.Format)
+	}
+	switch c.Storage.Backend {
+	case "file", "memory", "bolt", "mysql":
+	default:
+		return fmt.Errorf("storage.backend must be file, memory, bolt or mysql, got %q", c.Storage.Backend)
+	}
+	switch c.Storage.Sync {
+	case "never", "batch", "close":
+	default:
+		return fmt.Errorf("storage.sync must be never, batch or close, got %q", c.Storage.Sync)
+	}
+	if c.Features.DefaultTimeoutInSeconds < 0 {
+		return fmt.Errorf("features.defaultTimeoutInSeconds must not be negative")
+	}
+	if c.API.Timeout < 0 {
+		return fmt.Errorf("api.timeout must not be negative")
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with all secrets replaced,
+// so it can be shown or logged.
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+	if c.API.APIKey != "" {
+		c.API.APIKey = redacted
+	}
+	if c.Email.Password != "" {
+		c.Email.Password = redacted
+	}
+	return c
+}
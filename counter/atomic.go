@@ -0,0 +1,120 @@
+package counter
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicInt is a lock-free int64 counter.
+type AtomicInt struct {
+	v atomic.Int64
+}
+
+// Add adds n and returns the new total.
+func (c *AtomicInt) Add(n int64) int64 {
+	return c.v.Add(n)
+}
+
+// Inc adds 1 and returns the new total.
+func (c *AtomicInt) Inc() int64 {
+	return c.v.Add(1)
+}
+
+// Value returns the current total.
+func (c *AtomicInt) Value() int64 {
+	return c.v.Load()
+}
+
+// Reset sets the total to zero and returns the total before the reset.
+func (c *AtomicInt) Reset() int64 {
+	return c.v.Swap(0)
+}
+
+// AtomicFloat is a lock-free float64 counter.
+//
+// There is no atomic addition for floats, so Add stores the bits of the
+// float in a uint64 and retries a compare-and-swap until no other
+// goroutine got in between.
+type AtomicFloat struct {
+	bits atomic.Uint64
+}
+
+// Add adds n and returns the new total.
+func (c *AtomicFloat) Add(n float64) float64 {
+	for {
+		old := c.bits.Load()
+		v := math.Float64frombits(old) + n
+		if c.bits.CompareAndSwap(old, math.Float64bits(v)) {
+			return v
+		}
+	}
+}
+
+// Value returns the current total.
+func (c *AtomicFloat) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Reset sets the total to zero and returns the total before the reset.
+func (c *AtomicFloat) Reset() float64 {
+	return math.Float64frombits(c.bits.Swap(0))
+}
+
+// AtomicCounterMap keeps an int64 total per key. Updates of existing keys
+// do not take a lock, so it suits a small, stable set of keys that are
+// updated very often, e.g. one per CSV column.
+type AtomicCounterMap[K comparable] struct {
+	m sync.Map // K -> *AtomicInt
+}
+
+// counter returns the counter of key, creating it if needed.
+func (m *AtomicCounterMap[K]) counter(key K) *AtomicInt {
+	// Load first: LoadOrStore would allocate a new counter on every call.
+	if c, ok := m.m.Load(key); ok {
+		return c.(*AtomicInt)
+	}
+	c, _ := m.m.LoadOrStore(key, new(AtomicInt))
+	return c.(*AtomicInt)
+}
+
+// Add adds n to the total of key and returns the new total.
+func (m *AtomicCounterMap[K]) Add(key K, n int64) int64 {
+	return m.counter(key).Add(n)
+}
+
+// Inc adds 1 to the total of key and returns the new total.
+func (m *AtomicCounterMap[K]) Inc(key K) int64 {
+	return m.Add(key, 1)
+}
+
+// Get returns the total of key, which is zero for unknown keys.
+func (m *AtomicCounterMap[K]) Get(key K) int64 {
+	if c, ok := m.m.Load(key); ok {
+		return c.(*AtomicInt).Value()
+	}
+	return 0
+}
+
+// Snapshot returns a copy of all totals. Without a lock, concurrent
+// updates may or may not be included, and the totals of different keys
+// may be read at slightly different times.
+func (m *AtomicCounterMap[K]) Snapshot() map[K]int64 {
+	s := map[K]int64{}
+	m.m.Range(func(k, c any) bool {
+		s[k.(K)] = c.(*AtomicInt).Value()
+		return true
+	})
+	return s
+}
+
+// Reset sets all totals to zero and returns the totals before the reset.
+// The keys are kept, so concurrent updates are never lost.
+func (m *AtomicCounterMap[K]) Reset() map[K]int64 {
+	s := map[K]int64{}
+	m.m.Range(func(k, c any) bool {
+		s[k.(K)] = c.(*AtomicInt).Reset()
+		return true
+	})
+	return s
+}
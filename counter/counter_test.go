@@ -0,0 +1,220 @@
+package counter
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// concurrently runs fn n times in each of g goroutines and waits for them.
+func concurrently(g, n int, fn func(goroutine int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCounters(t *testing.T) {
+	var (
+		c  Counter[int64]
+		f  Counter[float64]
+		ai AtomicInt
+		af AtomicFloat
+	)
+	concurrently(8, 1000, func(int) {
+		c.Inc()
+		f.Add(0.5)
+		ai.Inc()
+		af.Add(0.5)
+	})
+
+	if c.Value() != 8000 || ai.Value() != 8000 {
+		t.Errorf("int totals %d and %d, want 8000", c.Value(), ai.Value())
+	}
+	// Halves add up exactly in a float64, so the totals can be compared.
+	if f.Value() != 4000 || af.Value() != 4000 {
+		t.Errorf("float totals %g and %g, want 4000", f.Value(), af.Value())
+	}
+
+	if c.Reset() != 8000 || ai.Reset() != 8000 || f.Reset() != 4000 || af.Reset() != 4000 {
+		t.Error("Reset did not return the totals")
+	}
+	if c.Value() != 0 || ai.Value() != 0 || f.Value() != 0 || af.Value() != 0 {
+		t.Error("Reset did not set the totals to zero")
+	}
+}
+
+func TestResetLosesNothing(t *testing.T) {
+	var c Counter[int]
+	var a AtomicInt
+	var resetC, resetA AtomicInt
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			resetC.Add(int64(c.Reset()))
+			resetA.Add(a.Reset())
+		}
+	}()
+	concurrently(4, 1000, func(int) {
+		c.Inc()
+		a.Inc()
+	})
+	wg.Wait()
+
+	// Every increment is either in a reset total or in the current value.
+	if got := resetC.Value() + int64(c.Value()); got != 4000 {
+		t.Errorf("Counter: %d increments accounted for, want 4000", got)
+	}
+	if got := resetA.Value() + a.Value(); got != 4000 {
+		t.Errorf("AtomicInt: %d increments accounted for, want 4000", got)
+	}
+}
+
+func TestCounterMap(t *testing.T) {
+	var m CounterMap[string, int]
+	if s := m.Snapshot(); len(s) != 0 {
+		t.Errorf("Snapshot of the zero value: %v", s)
+	}
+	if s := m.Reset(); s == nil || len(s) != 0 {
+		t.Errorf("Reset of the zero value: %#v, want an empty map", s)
+	}
+
+	concurrently(4, 100, func(g int) {
+		m.Inc("all")
+		m.Add("g"+strconv.Itoa(g), 2)
+	})
+	if m.Get("all") != 400 || m.Get("g0") != 200 || m.Get("missing") != 0 || m.Len() != 5 {
+		t.Errorf("totals %v", m.Snapshot())
+	}
+
+	snap := m.Snapshot()
+	m.Inc("all")
+	if snap["all"] != 400 {
+		t.Errorf("the snapshot changed to %d after an update", snap["all"])
+	}
+
+	old := m.Reset()
+	if old["all"] != 401 || len(old) != 5 {
+		t.Errorf("Reset returned %v", old)
+	}
+	if m.Len() != 0 || m.Get("all") != 0 {
+		t.Errorf("Reset kept %v", m.Snapshot())
+	}
+	m.Inc("all")
+	if old["all"] != 401 {
+		t.Error("an update after Reset changed the returned totals")
+	}
+}
+
+func TestAtomicCounterMap(t *testing.T) {
+	var m AtomicCounterMap[string]
+	if s := m.Snapshot(); len(s) != 0 {
+		t.Errorf("Snapshot of the zero value: %v", s)
+	}
+
+	concurrently(4, 100, func(g int) {
+		m.Inc("all")
+		m.Add("g"+strconv.Itoa(g), 2)
+	})
+	if m.Get("all") != 400 || m.Get("g3") != 200 || m.Get("missing") != 0 {
+		t.Errorf("totals %v", m.Snapshot())
+	}
+
+	snap := m.Snapshot()
+	m.Inc("all")
+	if snap["all"] != 400 || len(snap) != 5 {
+		t.Errorf("snapshot %v", snap)
+	}
+
+	old := m.Reset()
+	if old["all"] != 401 || len(old) != 5 {
+		t.Errorf("Reset returned %v", old)
+	}
+	// Unlike CounterMap, the keys are kept with a zero total.
+	after := m.Snapshot()
+	if len(after) != 5 || after["all"] != 0 {
+		t.Errorf("after Reset: %v, want all keys with zero totals", after)
+	}
+}
+
+// The benchmarks compare the mutex-based and the atomic counters under
+// contention. Run them with e.g.
+//
+//	go test -bench . -cpu 1,4,16 ./counter
+
+func BenchmarkCounter(b *testing.B) {
+	var c Counter[int64]
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+func BenchmarkAtomicInt(b *testing.B) {
+	var c AtomicInt
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Inc()
+		}
+	})
+}
+
+func BenchmarkCounterFloat(b *testing.B) {
+	var c Counter[float64]
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(0.5)
+		}
+	})
+}
+
+func BenchmarkAtomicFloat(b *testing.B) {
+	var c AtomicFloat
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(0.5)
+		}
+	})
+}
+
+// benchKeys are the keys of the map benchmarks.
+var benchKeys = func() []string {
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	return keys
+}()
+
+func BenchmarkCounterMap(b *testing.B) {
+	var m CounterMap[string, int64]
+	var start AtomicInt
+	b.RunParallel(func(pb *testing.PB) {
+		// Every goroutine starts at a different key, so the load is
+		// spread over all keys.
+		for n := int(start.Inc()); pb.Next(); n++ {
+			m.Inc(benchKeys[n%len(benchKeys)])
+		}
+	})
+}
+
+func BenchmarkAtomicCounterMap(b *testing.B) {
+	var m AtomicCounterMap[string]
+	var start AtomicInt
+	b.RunParallel(func(pb *testing.PB) {
+		for n := int(start.Inc()); pb.Next(); n++ {
+			m.Inc(benchKeys[n%len(benchKeys)])
+		}
+	})
+}
@@ -0,0 +1,321 @@
+// Package crawl fetches many pages concurrently and saves them to disk.
+//
+// A Crawler starts from one or more seed URLs and follows links up to a
+// maximum depth. It:
+// * fetches pages with a bounded pool of workers
+// * spaces out requests to the same host (per-host rate limit)
+// * respects robots.txt
+// * fetches every URL only once (de-duplication)
+// * writes every page to disk, plus a manifest.json describing the crawl
+package crawl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go_for_devops/fetch"
+)
+
+// DefaultUserAgent is sent with every request and used to pick the rules
+// of robots.txt files.
+const DefaultUserAgent = "go_for_devops-crawler/1.0"
+
+// ManifestFile is the name of the manifest written to the output directory.
+const ManifestFile = "manifest.json"
+
+// Config configures a Crawler.
+type Config struct {
+	// OutDir is the directory pages and the manifest are written to.
+	OutDir string
+	// Workers is the number of pages fetched at the same time. Defaults to 4.
+	Workers int
+	// MaxDepth is how many links away from a seed the crawler goes.
+	// 0 only fetches the seeds themselves.
+	MaxDepth int
+	// MaxPages stops the crawl after this many pages, seeds included. 0
+	// means no limit.
+	MaxPages int
+	// PerHostInterval is the minimum time between two requests to the
+	// same host. 0 disables rate limiting.
+	PerHostInterval time.Duration
+	// RespectRobots skips URLs that are disallowed by the host's robots.txt.
+	RespectRobots bool
+	// SameHost only follows links that point to the host of one of the seeds.
+	SameHost bool
+	// UserAgent is sent with every request. Defaults to DefaultUserAgent.
+	UserAgent string
+	// Fetcher is used for all requests. If nil, a fetcher with the default
+	// retry policy and the configured user agent is created.
+	Fetcher *fetch.Fetcher
+	// OnPage is called for every visited URL, e.g. to print progress.
+	OnPage func(Page)
+}
+
+// Page describes the outcome of visiting a single URL.
+type Page struct {
+	URL         string    `json:"url"`
+	Depth       int       `json:"depth"`
+	File        string    `json:"file,omitempty"`
+	StatusCode  int       `json:"status,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Size        int       `json:"size"`
+	Links       int       `json:"links"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Manifest describes a complete crawl. It is written to ManifestFile.
+type Manifest struct {
+	Seeds      []string  `json:"seeds"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Pages      []Page    `json:"pages"`
+}
+
+// Crawler crawls web pages. Create one with New.
+type Crawler struct {
+	cfg     Config
+	fetcher *fetch.Fetcher
+	limiter *hostLimiter
+	robots  *robotsCache
+}
+
+// task is a URL waiting to be visited.
+type task struct {
+	url   *url.URL
+	depth int
+}
+
+// result is the outcome of a task, including the links found on the page.
+type result struct {
+	page  Page
+	links []*url.URL
+	depth int
+}
+
+// New creates a Crawler, filling in defaults for unset fields.
+func New(cfg Config) *Crawler {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+
+	f := cfg.Fetcher
+	if f == nil {
+		f = fetch.New(
+			fetch.WithHeader("User-Agent", cfg.UserAgent),
+			fetch.WithRetry(fetch.DefaultRetryPolicy()),
+		)
+	}
+
+	c := &Crawler{
+		cfg:     cfg,
+		fetcher: f,
+		limiter: newHostLimiter(cfg.PerHostInterval),
+	}
+	if cfg.RespectRobots {
+		c.robots = newRobotsCache(f, c.limiter, cfg.UserAgent)
+	}
+	return c
+}
+
+// Run crawls starting from seeds and writes the results to the output
+// directory. If ctx is cancelled, the pages fetched so far are still
+// recorded in the manifest and ctx.Err() is returned.
+func (c *Crawler) Run(ctx context.Context, seeds []string) (*Manifest, error) {
+	if err := os.MkdirAll(c.cfg.OutDir, 0755); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{Seeds: seeds, StartedAt: time.Now()}
+
+	// Parse the seeds and remember their hosts for the SameHost option.
+	var queue []task
+	seen := map[string]bool{}
+	hosts := map[string]bool{}
+	for _, s := range seeds {
+		if c.cfg.MaxPages > 0 && len(seen) >= c.cfg.MaxPages {
+			break
+		}
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid seed URL %q", s)
+		}
+		u = normalize(u)
+		hosts[u.Host] = true
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			queue = append(queue, task{url: u})
+		}
+	}
+
+	tasks := make(chan task)
+	results := make(chan result)
+
+	// Start a fixed number of workers. They stop once tasks is closed.
+	for i := 0; i < c.cfg.Workers; i++ {
+		go func() {
+			for t := range tasks {
+				results <- c.visit(ctx, t)
+			}
+		}()
+	}
+
+	// The coordinator hands out tasks and collects results. It is the only
+	// goroutine touching queue and seen, so they need no locking.
+	pending := 0
+	done := ctx.Done()
+	for len(queue) > 0 || pending > 0 {
+		// Sending on a nil channel blocks forever, which disables the
+		// send case of the select while the queue is empty.
+		var send chan task
+		var next task
+		if len(queue) > 0 {
+			send = tasks
+			next = queue[0]
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			pending++
+		case r := <-results:
+			pending--
+			m.Pages = append(m.Pages, r.page)
+			if c.cfg.OnPage != nil {
+				c.cfg.OnPage(r.page)
+			}
+			// After cancellation, the queue stays empty, so only the
+			// running tasks are waited for.
+			if ctx.Err() != nil {
+				continue
+			}
+			for _, link := range r.links {
+				if c.cfg.MaxPages > 0 && len(seen) >= c.cfg.MaxPages {
+					break
+				}
+				if c.cfg.SameHost && !hosts[link.Host] {
+					continue
+				}
+				if seen[link.String()] {
+					continue
+				}
+				seen[link.String()] = true
+				queue = append(queue, task{url: link, depth: r.depth + 1})
+			}
+		case <-done:
+			// Stop handing out work, but wait for running tasks to finish.
+			// Receiving from a nil channel blocks forever as well, so this
+			// case only fires once.
+			queue = nil
+			done = nil
+		}
+	}
+	close(tasks)
+
+	m.FinishedAt = time.Now()
+	sort.Slice(m.Pages, func(i, j int) bool {
+		return m.Pages[i].URL < m.Pages[j].URL
+	})
+
+	if err := writeManifest(filepath.Join(c.cfg.OutDir, ManifestFile), m); err != nil {
+		return m, err
+	}
+	return m, ctx.Err()
+}
+
+// visit fetches a single URL, saves it and extracts its links.
+func (c *Crawler) visit(ctx context.Context, t task) result {
+	r := result{page: Page{URL: t.url.String(), Depth: t.depth}, depth: t.depth}
+
+	if c.robots != nil && !c.robots.allowed(ctx, t.url) {
+		r.page.Error = "disallowed by robots.txt"
+		return r
+	}
+	if err := c.limiter.wait(ctx, t.url.Host); err != nil {
+		r.page.Error = err.Error()
+		return r
+	}
+
+	resp, err := c.fetcher.Get(ctx, t.url.String())
+	r.page.FetchedAt = time.Now()
+	if err != nil {
+		r.page.Error = err.Error()
+		return r
+	}
+
+	r.page.StatusCode = resp.StatusCode
+	r.page.ContentType = resp.Header.Get("Content-Type")
+	r.page.Size = len(resp.Body)
+
+	file, err := c.save(t.url, resp.Body)
+	if err != nil {
+		r.page.Error = err.Error()
+		return r
+	}
+	r.page.File = file
+
+	// Only follow links of HTML pages that are not at the maximum depth yet.
+	if t.depth < c.cfg.MaxDepth && isHTML(r.page.ContentType) {
+		base, err := url.Parse(resp.URL)
+		if err != nil {
+			base = t.url
+		}
+		for _, link := range extractLinks(base, resp.Body) {
+			if link.Scheme != "http" && link.Scheme != "https" {
+				continue
+			}
+			r.links = append(r.links, normalize(link))
+		}
+		r.page.Links = len(r.links)
+	}
+
+	return r
+}
+
+// save writes body to a file named after the hash of u, in a directory per
+// host. It returns the file path relative to the output directory.
+func (c *Crawler) save(u *url.URL, body []byte) (string, error) {
+	sum := sha256.Sum256([]byte(u.String()))
+	host := strings.ReplaceAll(u.Host, ":", "_")
+	rel := filepath.Join(host, hex.EncodeToString(sum[:8])+".html")
+
+	path := filepath.Join(c.cfg.OutDir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// isHTML reports whether a Content-Type header describes an HTML document.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// writeManifest writes m as indented JSON to path.
+func writeManifest(path string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,174 @@
+package crawl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// site serves a small web site: / links to /a and /b, /a links to /c and
+// /private, and robots.txt disallows /private. It records the time of
+// every request.
+type site struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	times    []time.Time
+}
+
+func newSite(t *testing.T) *site {
+	pages := map[string]string{
+		"/":        `<a href="/a">a</a> <a href="/b">b</a>`,
+		"/a":       `<a href="/c">c</a> <a href="/private">p</a> <a href="https://elsewhere.example/">x</a>`,
+		"/b":       `<a href="/">home</a>`,
+		"/c":       `no links`,
+		"/private": `secret`,
+	}
+	s := &site{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.URL.Path)
+		s.times = append(s.times, time.Now())
+		s.mu.Unlock()
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintln(w, "User-agent: *\nDisallow: /private")
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *site) config(t *testing.T) Config {
+	return Config{
+		OutDir:        t.TempDir(),
+		Workers:       4,
+		MaxDepth:      5,
+		RespectRobots: true,
+		SameHost:      true,
+	}
+}
+
+func pageURLs(m *Manifest, base string) []string {
+	var urls []string
+	for _, p := range m.Pages {
+		urls = append(urls, strings.TrimPrefix(p.URL, base))
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+func TestCrawl(t *testing.T) {
+	s := newSite(t)
+	cfg := s.config(t)
+	m, err := New(cfg).Run(context.Background(), []string{s.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/", "/a", "/b", "/c", "/private"}
+	if got := pageURLs(m, s.URL); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("pages %v, want %v", got, want)
+	}
+	for _, p := range m.Pages {
+		switch {
+		case strings.HasSuffix(p.URL, "/private"):
+			if p.Error != "disallowed by robots.txt" {
+				t.Errorf("/private: error %q, want it disallowed", p.Error)
+			}
+		case p.Error != "":
+			t.Errorf("%s: %s", p.URL, p.Error)
+		default:
+			if _, err := os.Stat(filepath.Join(cfg.OutDir, p.File)); err != nil {
+				t.Errorf("%s was not saved: %v", p.URL, err)
+			}
+		}
+	}
+	for _, path := range s.requests {
+		if path == "/private" {
+			t.Error("the crawler fetched a page disallowed by robots.txt")
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(cfg.OutDir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Manifest
+	if err := json.Unmarshal(b, &saved); err != nil || len(saved.Pages) != len(m.Pages) {
+		t.Errorf("manifest has %d pages (%v), want %d", len(saved.Pages), err, len(m.Pages))
+	}
+}
+
+func TestCrawlMaxPagesCountsSeeds(t *testing.T) {
+	s := newSite(t)
+	cfg := s.config(t)
+	cfg.MaxPages = 2
+	seeds := []string{s.URL + "/a", s.URL + "/b", s.URL + "/c"}
+	m, err := New(cfg).Run(context.Background(), seeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Pages) != 2 {
+		t.Errorf("crawled %d pages %v, want 2", len(m.Pages), pageURLs(m, s.URL))
+	}
+}
+
+func TestCrawlStopsOnCancel(t *testing.T) {
+	s := newSite(t)
+	cfg := s.config(t)
+	cfg.Workers = 1
+	cfg.RespectRobots = false
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancel as soon as the first page is done. Its links must not be
+	// visited anymore.
+	cfg.OnPage = func(Page) { cancel() }
+
+	m, err := New(cfg).Run(ctx, []string{s.URL + "/"})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+	if len(m.Pages) != 1 {
+		t.Errorf("got %d pages after cancelling, want 1: %+v", len(m.Pages), m.Pages)
+	}
+	for _, p := range m.Pages {
+		if p.Error != "" {
+			t.Errorf("%s: %s", p.URL, p.Error)
+		}
+	}
+}
+
+func TestCrawlRateLimitIncludesRobots(t *testing.T) {
+	s := newSite(t)
+	cfg := s.config(t)
+	cfg.MaxDepth = 0
+	cfg.PerHostInterval = 40 * time.Millisecond
+	if _, err := New(cfg).Run(context.Background(), []string{s.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// robots.txt and the seed are two requests to the same host.
+	if len(s.times) != 2 || s.requests[0] != "/robots.txt" {
+		t.Fatalf("requests %v, want robots.txt and /", s.requests)
+	}
+	if gap := s.times[1].Sub(s.times[0]); gap < 30*time.Millisecond {
+		t.Errorf("second request %s after robots.txt, want at least the per-host interval", gap)
+	}
+}
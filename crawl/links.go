@@ -0,0 +1,78 @@
+package crawl
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// extractLinks returns the absolute URLs of all <a href> links in an HTML
+// document. Relative links are resolved against base, or against the
+// document's <base href> if it has one.
+func extractLinks(base *url.URL, body []byte) []*url.URL {
+	var links []*url.URL
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			// io.EOF or a broken document, either way we are done.
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data != "a" && tok.Data != "base" {
+				continue
+			}
+
+			href, ok := attr(tok, "href")
+			if !ok {
+				continue
+			}
+			ref, err := url.Parse(strings.TrimSpace(href))
+			if err != nil {
+				continue
+			}
+
+			// <base href> changes how all following links are resolved.
+			if tok.Data == "base" {
+				base = base.ResolveReference(ref)
+				continue
+			}
+
+			links = append(links, base.ResolveReference(ref))
+		}
+	}
+}
+
+// attr returns the value of the attribute name of tok.
+func attr(tok html.Token, name string) (string, bool) {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// normalize returns the canonical form of u that is used to de-duplicate
+// URLs: the fragment is dropped, the scheme and host are lower-cased,
+// default ports are removed and an empty path becomes "/".
+func normalize(u *url.URL) *url.URL {
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+
+	if (n.Scheme == "http" && strings.HasSuffix(n.Host, ":80")) ||
+		(n.Scheme == "https" && strings.HasSuffix(n.Host, ":443")) {
+		n.Host = n.Host[:strings.LastIndex(n.Host, ":")]
+	}
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	return &n
+}
@@ -0,0 +1,211 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"go_for_devops/fetch"
+)
+
+// robots holds the rules of a robots.txt file that apply to our user agent.
+type robots struct {
+	rules []robotsRule
+}
+
+// robotsRule is a single Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// allowed reports whether path may be fetched. The longest matching rule
+// wins, and Allow wins over Disallow if both are equally long. A nil
+// robots allows everything.
+func (r *robots) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	best := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !matchRobots(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > best || (len(rule.pattern) == best && rule.allow) {
+			best = len(rule.pattern)
+			allow = rule.allow
+		}
+	}
+	return allow
+}
+
+// matchRobots matches path against a robots.txt path pattern. Patterns are
+// prefixes that may contain `*` (any sequence of characters) and may end in
+// `$` (end of the path).
+func matchRobots(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	// The first part must be a prefix of the path.
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		// The last part of an anchored pattern must match the end of the path.
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+
+	return !anchored || rest == ""
+}
+
+// parseRobots parses a robots.txt file and keeps the rules of the group
+// that matches userAgent best. Groups for `*` are used if no group names
+// the user agent.
+func parseRobots(r io.Reader, userAgent string) (*robots, error) {
+	// Robots.txt matches on the product token, e.g. "mybot" in "mybot/1.0".
+	token := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+	var (
+		specific, wildcard []robotsRule
+		agents             []string
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Strip comments.
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group.
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything, so it adds no rule.
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", pattern: value}
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					wildcard = append(wildcard, rule)
+				case agent == token:
+					specific = append(specific, rule)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if specific != nil {
+		return &robots{rules: specific}, nil
+	}
+	return &robots{rules: wildcard}, nil
+}
+
+// robotsCache fetches and caches robots.txt per scheme and host.
+type robotsCache struct {
+	fetcher   *fetch.Fetcher
+	limiter   *hostLimiter
+	userAgent string
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+// robotsEntry makes sure robots.txt of a host is only fetched once, even
+// when several workers ask for it at the same time.
+type robotsEntry struct {
+	once   sync.Once
+	robots *robots
+}
+
+// newRobotsCache creates an empty robotsCache. Fetching robots.txt counts
+// against the per-host limit of l, like any other request.
+func newRobotsCache(f *fetch.Fetcher, l *hostLimiter, userAgent string) *robotsCache {
+	return &robotsCache{fetcher: f, limiter: l, userAgent: userAgent, hosts: map[string]*robotsEntry{}}
+}
+
+// allowed reports whether u may be crawled according to the robots.txt of
+// its host. A robots.txt that does not exist or cannot be fetched allows
+// everything, except for a 401 or 403 response, which disallows the host.
+func (c *robotsCache) allowed(ctx context.Context, u *url.URL) bool {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.hosts[key]
+	if !ok {
+		entry = &robotsEntry{}
+		c.hosts[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.robots = c.fetch(ctx, u.Host, key+"/robots.txt")
+	})
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return entry.robots.allowed(path)
+}
+
+// fetch downloads and parses the robots.txt file of host.
+func (c *robotsCache) fetch(ctx context.Context, host, robotsURL string) *robots {
+	if err := c.limiter.wait(ctx, host); err != nil {
+		return nil
+	}
+	resp, err := c.fetcher.Get(ctx, robotsURL)
+	if err != nil {
+		var se *fetch.StatusError
+		if errors.As(err, &se) && (se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden) {
+			return &robots{rules: []robotsRule{{allow: false, pattern: "/"}}}
+		}
+		return nil
+	}
+
+	rb, err := parseRobots(bytes.NewReader(resp.Body), c.userAgent)
+	if err != nil {
+		return nil
+	}
+	return rb
+}
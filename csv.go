@@ -1,15 +1,18 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"sort"
 	"strings"
+
+	"go_for_devops/pipeline"
 )
 
 // Define a record type as a slice of strings.
@@ -71,9 +74,11 @@ func readRecs(filepath string, hasHeader bool) ([]csvRecord, error) {
 	// Decare a slice of records.
 	var records []csvRecord
 	for i, line := range lines {
+		csvLinesRead.Inc()
+
 		// Skip header line.
 		if hasHeader && i == 0 {
-			fmt.Println("Skipping header line")
+			slog.Debug("Skipping CSV header line", "file", filepath)
 			continue
 		}
 
@@ -87,10 +92,12 @@ func readRecs(filepath string, hasHeader bool) ([]csvRecord, error) {
 
 		// Validate the record.
 		if err := rec.validate(); err != nil {
+			csvRecordsRejected.Inc()
 			return nil, fmt.Errorf("entry at line %d was invalid: %w", i, err)
 		}
 
 		// If the line is valid, append the record to the slice of records.
+		csvRecordsRead.Inc()
 		records = append(records, rec)
 	}
 
@@ -98,9 +105,12 @@ func readRecs(filepath string, hasHeader bool) ([]csvRecord, error) {
 	return records, nil
 }
 
-// Same function as above, but using the bufio & bytes packages.
+// Same function as above, but reading the file line by line.
 // This modification will allow for a more efficient way to read the data
 // in regards to memory usage, as we are not converting the whole file to a string.
+//
+// The lines are read, filtered and parsed in a pipeline of goroutines
+// (see pipeline/pipeline.go), the same way decodeUsers reads user records.
 func readRecsBytes(filepath string, hasHeader bool) ([]csvRecord, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -108,43 +118,42 @@ func readRecsBytes(filepath string, hasHeader bool) ([]csvRecord, error) {
 	}
 	defer file.Close()
 
-	// Create a new scanner.
-	scanner := bufio.NewScanner(file)
-
-	// Declare a slice of records.
-	var records []csvRecord
-	lineNum := 0
+	// Read the file line by line, with line numbers starting at 1.
+	p := pipeline.New(context.Background(), "read_csv")
+	lines := pipeline.Lines(p, "read", file)
 
-	for scanner.Scan() {
-		// Skip header line.
-		if hasHeader && lineNum == 0 {
-			fmt.Println("Skipping header line")
-			lineNum++
-			continue
+	// Skip the header line and empty lines.
+	lines = pipeline.Filter(lines, "skip", func(l pipeline.Line) bool {
+		csvLinesRead.Inc()
+		if hasHeader && l.Num == 1 {
+			slog.Debug("Skipping CSV header line", "file", filepath)
+			return false
 		}
-
-		// Increment the line number.
-		lineNum++
-
-		// Read the line.
-		line := scanner.Text()
-
-		// Skip empty lines.
-		if strings.TrimSpace(line) == "" {
-			fmt.Println("Skip empty line")
-			continue
+		if strings.TrimSpace(l.Text) == "" {
+			slog.Debug("Skipping empty CSV line", "file", filepath, "line", l.Num)
+			return false
 		}
+		return true
+	})
 
-		var rec csvRecord = strings.Split(line, ",")
+	// Split and validate the records. The first invalid record stops
+	// the pipeline, and Collect returns its error.
+	recs := pipeline.Map(lines, "parse", func(_ context.Context, l pipeline.Line) (csvRecord, error) {
+		var rec csvRecord = strings.Split(l.Text, ",")
 		if err := rec.validate(); err != nil {
-			return nil, fmt.Errorf("entry at line %d was invalid: %w", lineNum, err)
+			csvRecordsRejected.Inc()
+			return nil, fmt.Errorf("entry at line %d was invalid: %w", l.Num, err)
 		}
+		csvRecordsRead.Inc()
+		return rec, nil
+	})
 
-		records = append(records, rec)
+	// Return all records, or none if a record was invalid.
+	records, err := pipeline.Collect(recs)
+	if err != nil {
+		return nil, err
 	}
-
-	// Return all records.
-	return records, scanner.Err()
+	return records, nil
 }
 
 // Write CSV records sorted to a CSV outfile.
@@ -169,6 +178,7 @@ func writeRecs(filepath string, recs []csvRecord) error {
 		if err != nil {
 			return err
 		}
+		csvRecordsWritten.Inc()
 	}
 
 	return nil
@@ -205,19 +215,24 @@ func readRecsCSV(filepath string) ([]csvRecord, error) {
 			if err == io.EOF {
 				break
 			}
-			// Otherwise, actually return the error.
+			// Otherwise, actually return the error. The reader also
+			// fails on records with the wrong number of fields.
+			csvLinesRead.Inc()
+			csvRecordsRejected.Inc()
 			return nil, err
 		}
+		csvLinesRead.Inc()
 
 		// Skip lines that would be a comment.
 		if strings.HasPrefix(data[0], "#") || strings.HasPrefix(data[0], ";") {
-			fmt.Println("Skipping comment line:", strings.Join(data, " "))
+			slog.Debug("Skipping CSV comment line", "file", filepath, "record", strings.Join(data, " "))
 			continue
 		}
 
 		// Append the record to the slice of records.
 		// Validation is handled as part of the CSV reader.
 		rec := csvRecord(data)
+		csvRecordsRead.Inc()
 		recs = append(recs, rec)
 	}
 
@@ -236,14 +251,20 @@ func writeCSVWriter(filepath string, recs []csvRecord) error {
 
 	// Create a new CSV writer.
 	w := csv.NewWriter(file)
-	defer w.Flush()
 
 	// Loop over slice of csvRecords and write each record to the file.
 	for _, rec := range recs {
 		if err := w.Write(rec); err != nil {
 			return err
 		}
+		csvRecordsWritten.Inc()
 	}
 
-	return nil
+	// The writer buffers the records, so errors of the file may only show
+	// up when the buffer is flushed, and when the file is closed.
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
 }
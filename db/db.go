@@ -0,0 +1,124 @@
+// Package db is the database access layer. It connects to the MySQL
+// database configured in the database section of config.json, manages the
+// connection pool, runs the embedded schema migrations and provides
+// repositories for the tables.
+//
+// The driver is only selected in OpenConfig. Open accepts any
+// database/sql driver, so the layer can also run against an in-process
+// engine such as SQLite, as long as the SQL stays portable.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"go_for_devops/config"
+)
+
+// DriverName is the database/sql driver used by OpenConfig.
+const DriverName = "mysql"
+
+// Options configures the connection pool.
+type Options struct {
+	// Timeout bounds connecting and every single query. Zero means no
+	// timeout, other than the one of the caller's context.
+	Timeout time.Duration
+	// MaxOpenConns limits the number of open connections. Defaults to 10.
+	MaxOpenConns int
+	// MaxIdleConns is the number of idle connections kept in the pool.
+	// Defaults to 5.
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections after this time, so the pool
+	// does not run into server-side timeouts. Defaults to 5 minutes.
+	ConnMaxLifetime time.Duration
+}
+
+// DB is a pool of database connections.
+type DB struct {
+	*sql.DB
+	timeout time.Duration
+}
+
+// DSN builds the data source name of the MySQL driver from the database
+// configuration. timeout is used for dialing, reading and writing.
+func DSN(cfg config.Database, timeout time.Duration) string {
+	c := mysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Password
+	c.Net = "tcp"
+	c.Addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	c.DBName = cfg.DatabaseName
+	// Scan DATETIME columns into time.Time instead of []byte.
+	c.ParseTime = true
+	c.Timeout = timeout
+	c.ReadTimeout = timeout
+	c.WriteTimeout = timeout
+	return c.FormatDSN()
+}
+
+// OpenConfig connects to the MySQL database of cfg. The timeouts are taken
+// from features.defaultTimeoutInSeconds.
+func OpenConfig(ctx context.Context, cfg *config.Config) (*DB, error) {
+	timeout := cfg.Features.DefaultTimeout()
+	return Open(ctx, DriverName, DSN(cfg.Database, timeout), Options{Timeout: timeout})
+}
+
+// Open opens a connection pool with the given driver and checks that the
+// database can be reached.
+func Open(ctx context.Context, driver, dsn string, opts Options) (*DB, error) {
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = 10
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = 5
+	}
+	if opts.ConnMaxLifetime == 0 {
+		opts.ConnMaxLifetime = 5 * time.Minute
+	}
+
+	// sql.Open only validates its arguments, it does not connect.
+	sqlDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	d := &DB{DB: sqlDB, timeout: opts.Timeout}
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	return d, nil
+}
+
+// withTimeout derives a context with the query timeout of the pool.
+func (d *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+// inTx runs fn in a transaction. The transaction is committed if fn
+// returns nil and rolled back otherwise.
+func (d *DB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
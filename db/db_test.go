@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// A pure Go SQLite, so the tests run against a real SQL engine without
+	// a MySQL server.
+	_ "github.com/glebarez/go-sqlite"
+
+	"go_for_devops/config"
+)
+
+// openTest opens a fresh SQLite database in a temporary directory. A file
+// is used instead of :memory:, because every connection of the pool would
+// get its own in-memory database.
+func openTest(t *testing.T) *DB {
+	t.Helper()
+	d, err := Open(context.Background(), "sqlite", filepath.Join(t.TempDir(), "test.db"), Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestDSN(t *testing.T) {
+	dsn := DSN(config.Database{
+		Host:         "db.example.com",
+		Port:         3306,
+		User:         "app",
+		Password:     "secret",
+		DatabaseName: "devops",
+	}, 30*time.Second)
+
+	for _, want := range []string{"app:secret@tcp(db.example.com:3306)/devops", "parseTime=true", "timeout=30s", "readTimeout=30s", "writeTimeout=30s"} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("DSN %q does not contain %q", dsn, want)
+		}
+	}
+}
+
+func TestOpenUnreachable(t *testing.T) {
+	// Nothing listens on port 1, so the ping in Open fails.
+	_, err := Open(context.Background(), DriverName, DSN(config.Database{Host: "127.0.0.1", Port: 1}, time.Second), Options{Timeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "connecting to database") {
+		t.Errorf("got error %v, want a connection error", err)
+	}
+}
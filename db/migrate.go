@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// migrations holds the schema migrations. Each file is named
+// <version>_<description>.sql and the files are applied in name order, so
+// the version is zero-padded (001, 002, ...).
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// createMigrationsTable records which migrations have been applied.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version VARCHAR(255) NOT NULL PRIMARY KEY
+)`
+
+// Migrate applies the embedded migrations that have not been applied yet.
+// It returns the names of the migrations it applied.
+func (d *DB) Migrate(ctx context.Context) ([]string, error) {
+	sub, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return d.MigrateFS(ctx, sub)
+}
+
+// MigrateFS applies the .sql files in the root of fsys that have not been
+// applied yet, in name order.
+//
+// A file may contain several statements separated by semicolons at the end
+// of a line. Each file runs in a transaction together with its entry in the
+// schema_migrations table. Note that MySQL commits DDL statements such as
+// CREATE TABLE implicitly, so a migration that fails half-way can leave
+// its first statements applied.
+func (d *DB) MigrateFS(ctx context.Context, fsys fs.FS) ([]string, error) {
+	if err := d.exec(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var done []string
+	for _, name := range names {
+		version := strings.TrimSuffix(path.Base(name), ".sql")
+		if applied[version] {
+			continue
+		}
+
+		script, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return done, err
+		}
+		if err := d.applyMigration(ctx, version, string(script)); err != nil {
+			return done, fmt.Errorf("migration %s: %w", name, err)
+		}
+		done = append(done, version)
+	}
+	return done, nil
+}
+
+// exec runs a single statement with the query timeout of the pool.
+func (d *DB) exec(ctx context.Context, stmt string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	_, err := d.ExecContext(ctx, stmt)
+	return err
+}
+
+// applyMigration runs the statements of a migration script and records its
+// version in one transaction. The timeout of the pool applies to the whole
+// migration.
+func (d *DB) applyMigration(ctx context.Context, version, script string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return d.inTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range splitStatements(script) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", version)
+		return err
+	})
+}
+
+// appliedMigrations returns the versions in the schema_migrations table.
+func (d *DB) appliedMigrations(ctx context.Context) (map[string]bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := d.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// splitStatements splits a script at semicolons that end a line. Lines
+// starting with -- are comments and are dropped.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+
+	applied, err := d.Migrate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) == 0 || applied[0] != "001_create_users" {
+		t.Errorf("applied %q, want the embedded migrations", applied)
+	}
+	// The users table exists now.
+	if _, err := d.ExecContext(ctx, "INSERT INTO users (id, name) VALUES (1, 'ada')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is applied twice.
+	applied, err = d.Migrate(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second run applied %q, %v, want nothing", applied, err)
+	}
+}
+
+func TestMigrateFS(t *testing.T) {
+	d := openTest(t)
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"002_add_b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);\nINSERT INTO b VALUES (1);\n")},
+		"001_add_a.sql": {Data: []byte("-- The first table.\nCREATE TABLE a (\n\tid INTEGER\n);")},
+		"README.md":     {Data: []byte("not a migration")},
+	}
+	applied, err := d.MigrateFS(ctx, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(applied, " ") != "001_add_a 002_add_b" {
+		t.Errorf("applied %q, want them in name order", applied)
+	}
+
+	// A later migration that fails is rolled back together with its
+	// schema_migrations entry, and the earlier ones stay applied.
+	fsys["003_broken.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO b VALUES (2);\nINSERT INTO missing VALUES (1);\n")}
+	fsys["004_add_c.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE c (id INTEGER);")}
+	applied, err = d.MigrateFS(ctx, fsys)
+	if err == nil || !strings.Contains(err.Error(), "003_broken.sql") {
+		t.Fatalf("got error %v, want one naming the broken migration", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied %q before the broken migration, want nothing", applied)
+	}
+	var n int
+	if err := d.QueryRowContext(ctx, "SELECT COUNT(*) FROM b").Scan(&n); err != nil || n != 1 {
+		t.Errorf("table b has %d rows (%v), want the insert of the broken migration rolled back", n, err)
+	}
+	versions, err := d.appliedMigrations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions["003_broken"] {
+		t.Errorf("schema_migrations has %v", versions)
+	}
+
+	// Once fixed, the migration and the ones after it are applied.
+	fsys["003_broken.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO b VALUES (2);")}
+	applied, err = d.MigrateFS(ctx, fsys)
+	if err != nil || strings.Join(applied, " ") != "003_broken 004_add_c" {
+		t.Errorf("applied %q, %v", applied, err)
+	}
+}
+
+func TestMigrateFSTimeout(t *testing.T) {
+	d := openTest(t)
+	// The timeout of the pool must apply to the migration statements too,
+	// even if the caller's context has no deadline.
+	d.timeout = time.Nanosecond
+	_, err := d.MigrateFS(context.Background(), fstest.MapFS{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (
+	id INT -- trailing comments are kept
+);
+
+INSERT INTO a VALUES (1); 
+INSERT INTO a VALUES (2)`
+	got := splitStatements(script)
+	want := []string{
+		"CREATE TABLE a (\n\tid INT -- trailing comments are kept\n)",
+		"INSERT INTO a VALUES (1)",
+		"INSERT INTO a VALUES (2)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d statements %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d: %q, want %q", i, got[i], want[i])
+		}
+	}
+}
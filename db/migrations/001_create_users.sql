@@ -0,0 +1,5 @@
+-- The users of users_source.txt, see the UserStore in the main package.
+CREATE TABLE IF NOT EXISTS users (
+	id BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned when a row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// User is a row of the users table.
+type User struct {
+	ID   int
+	Name string
+}
+
+// Users is the repository of the users table.
+type Users struct {
+	db *DB
+}
+
+// Users returns the repository of the users table.
+func (d *DB) Users() *Users {
+	return &Users{db: d}
+}
+
+// Get returns the user with the given ID, or ErrNotFound.
+func (r *Users) Get(ctx context.Context, id int) (User, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	u := User{ID: id}
+	err := r.db.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", id).Scan(&u.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	return u, err
+}
+
+// List returns all users, ordered by ID.
+func (r *Users) List(ctx context.Context) ([]User, error) {
+	users := []User{}
+	err := r.Iterate(ctx, func(u User) error {
+		users = append(users, u)
+		return nil
+	})
+	return users, err
+}
+
+// Iterate calls fn for every user, ordered by ID, until fn returns an
+// error. The rows are streamed, so fn should not take long: the connection
+// stays busy until Iterate returns.
+func (r *Users) Iterate(ctx context.Context, fn func(User) error) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name FROM users ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name); err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Put inserts u, or updates the user with the same ID.
+//
+// MySQL and SQLite spell upserts differently (ON DUPLICATE KEY UPDATE vs.
+// ON CONFLICT), so this uses a transaction with plain SQL instead.
+func (r *Users) Put(ctx context.Context, u User) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	return r.db.inTx(ctx, func(tx *sql.Tx) error {
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ?", u.ID).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			_, err := tx.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ?", u.Name, u.ID)
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO users (id, name) VALUES (?, ?)", u.ID, u.Name)
+		return err
+	})
+}
+
+// Delete removes the user with the given ID, or returns ErrNotFound.
+func (r *Users) Delete(ctx context.Context, id int) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
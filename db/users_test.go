@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func migrated(t *testing.T) *Users {
+	t.Helper()
+	d := openTest(t)
+	if _, err := d.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return d.Users()
+}
+
+func TestUsersCRUD(t *testing.T) {
+	users := migrated(t)
+	ctx := context.Background()
+
+	if _, err := users.Get(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing user: %v, want ErrNotFound", err)
+	}
+
+	for _, u := range []User{{ID: 2, Name: "grace"}, {ID: 1, Name: "ada"}, {ID: 3, Name: "alan"}} {
+		if err := users.Put(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Put with an existing ID updates the user.
+	if err := users.Put(ctx, User{ID: 2, Name: "grace hopper"}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := users.Get(ctx, 2)
+	if err != nil || u != (User{ID: 2, Name: "grace hopper"}) {
+		t.Errorf("Get(2) = %+v, %v", u, err)
+	}
+
+	list, err := users.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []User{{1, "ada"}, {2, "grace hopper"}, {3, "alan"}}
+	if len(list) != len(want) {
+		t.Fatalf("List = %+v, want %+v", list, want)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("List[%d] = %+v, want %+v", i, list[i], want[i])
+		}
+	}
+
+	if err := users.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Delete(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := users.Get(ctx, 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestUsersIterateStops(t *testing.T) {
+	users := migrated(t)
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		users.Put(ctx, User{ID: i, Name: "user"})
+	}
+
+	stop := errors.New("stop")
+	var seen []int
+	err := users.Iterate(ctx, func(u User) error {
+		seen = append(seen, u.ID)
+		if u.ID == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(seen) != 2 {
+		t.Errorf("Iterate returned %v after %v, want it to stop at the error of fn", err, seen)
+	}
+}
@@ -0,0 +1,81 @@
+package dupes
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrChanged is returned for files that were modified after Find compared
+// them. They are left alone.
+var ErrChanged = errors.New("file changed since it was compared")
+
+// Remove deletes the copies of the first file of g. It returns the files
+// it removed. A file that cannot be removed does not stop the others, the
+// errors are joined.
+func Remove(g Group) ([]File, error) {
+	return apply(g, func(keep, dup File) error {
+		return os.Remove(dup.Path)
+	})
+}
+
+// Link replaces the copies of the first file of g with hard links to it,
+// which frees their space while all paths stay valid. The links share the
+// mode and owner of the first file. Hard links only work within a file
+// system, so copies on another one are reported as errors.
+func Link(g Group) ([]File, error) {
+	return apply(g, func(keep, dup File) error {
+		// Link under a temporary name, and rename the link over the copy,
+		// so the copy is never missing if linking fails.
+		tmp := dup.Path + ".dupes-link"
+		if err := os.Link(keep.Path, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dup.Path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	})
+}
+
+// apply calls fn for every copy in g that is unchanged since Find.
+func apply(g Group, fn func(keep, dup File) error) ([]File, error) {
+	if len(g.Files) < 2 {
+		return nil, nil
+	}
+	keep := g.Files[0]
+	if err := unchanged(keep); err != nil {
+		return nil, err
+	}
+	var (
+		done []File
+		errs []error
+	)
+	for _, dup := range g.Files[1:] {
+		err := unchanged(dup)
+		if err == nil {
+			err = fn(keep, dup)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		done = append(done, dup)
+	}
+	return done, errors.Join(errs...)
+}
+
+// unchanged checks that a file still has the size and modification time it
+// had when Find compared it. It does not hash the file again, which would
+// read all files a second time.
+func unchanged(f File) error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != f.Size || !info.ModTime().Equal(f.ModTime) {
+		return fmt.Errorf("%s: %w", f.Path, ErrChanged)
+	}
+	return nil
+}
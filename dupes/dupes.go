@@ -0,0 +1,261 @@
+// Package dupes finds files with the same content in one or more directory
+// trees. Comparing every file with every other file would read each file
+// many times, so the files are narrowed down in rounds that get more
+// expensive:
+//
+//  1. Files of different sizes cannot be equal, so only files that share
+//     their size with another file are candidates.
+//  2. The candidates are grouped by a hash of their first and last few KiB,
+//     which tells most different files apart without reading them fully.
+//  3. The files left are grouped by the SHA-256 digest of their content.
+//
+// The hashing runs in a bounded pool of goroutines, see Options.Workers.
+package dupes
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"go_for_devops/pipeline"
+	"go_for_devops/walk"
+)
+
+// DefaultPartialSize is the number of bytes read from the start and from
+// the end of a file for the partial hash.
+const DefaultPartialSize = 4096
+
+// Options configures Find.
+type Options struct {
+	// Walk selects the files to compare in every tree. Empty files are
+	// always skipped, they are all equal.
+	Walk walk.Options
+	// Workers is the number of files hashed at the same time. It defaults
+	// to the number of CPUs.
+	Workers int
+	// PartialSize defaults to DefaultPartialSize.
+	PartialSize int64
+	// OnError is called for files that cannot be read. They are left out
+	// of the result, and the search goes on. A nil OnError ignores them.
+	OnError func(path string, err error)
+}
+
+// File is a file found by Find.
+type File struct {
+	// Path is the path of the file in the OS format, starting with the
+	// directory it was found in.
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Group is a set of files with the same content.
+type Group struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Files are in the order of the directories passed to Find, and in
+	// lexical order within a directory. The first file is the one that
+	// Link and Remove keep.
+	Files []File `json:"files"`
+}
+
+// Wasted returns the number of bytes used by the copies of the first file.
+func (g Group) Wasted() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// hashed is a file with a hash of (part of) its content.
+type hashed struct {
+	file File
+	sum  string
+	err  error
+}
+
+// Find returns the groups of files with the same content below the
+// directories dirs, largest files first.
+func Find(ctx context.Context, dirs []string, opts Options) ([]Group, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.PartialSize <= 0 {
+		opts.PartialSize = DefaultPartialSize
+	}
+	opts.Walk.MinSize = max(opts.Walk.MinSize, 1)
+	onError := opts.OnError
+	if onError == nil {
+		onError = func(string, error) {}
+	}
+
+	// Round 1: group by size.
+	bySize := map[int64][]File{}
+	for _, dir := range dirs {
+		err := walk.Walk(os.DirFS(dir), ".", opts.Walk, func(e walk.Entry) error {
+			if !e.Mode.IsRegular() {
+				return nil
+			}
+			f := File{Path: filepath.Join(dir, filepath.FromSlash(e.Path)), Size: e.Size, ModTime: e.ModTime}
+			bySize[e.Size] = append(bySize[e.Size], f)
+			return ctx.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var candidates []File
+	for _, files := range bySize {
+		if files = distinct(files, onError); len(files) > 1 {
+			candidates = append(candidates, files...)
+		}
+	}
+
+	// Round 2: group by the partial hash. For small files, the partial
+	// hash already covers the whole content, so they skip round 3.
+	partial, err := hashAll(ctx, "partial_hash", candidates, opts, func(f File) (string, error) {
+		return hashFile(f.Path, f.Size, opts.PartialSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	candidates = candidates[:0]
+	for _, g := range groupBy(partial, onError) {
+		if g.Size <= 2*opts.PartialSize {
+			groups = append(groups, g)
+		} else {
+			candidates = append(candidates, g.Files...)
+		}
+	}
+
+	// Round 3: group by the full hash.
+	full, err := hashAll(ctx, "full_hash", candidates, opts, func(f File) (string, error) {
+		return hashFile(f.Path, f.Size, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	groups = append(groups, groupBy(full, onError)...)
+
+	slices.SortFunc(groups, func(a, b Group) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Files[0].Path, b.Files[0].Path)
+	})
+	return groups, nil
+}
+
+// distinct drops the files that are the same file as an earlier one: hard
+// links, or a file found twice because the directories overlap.
+func distinct(files []File, onError func(string, error)) []File {
+	if len(files) < 2 {
+		return files
+	}
+	var (
+		kept  []File
+		infos []os.FileInfo
+	)
+next:
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			onError(f.Path, err)
+			continue
+		}
+		for _, other := range infos {
+			if os.SameFile(info, other) {
+				continue next
+			}
+		}
+		kept = append(kept, f)
+		infos = append(infos, info)
+	}
+	return kept
+}
+
+// hashAll hashes the files with Options.Workers goroutines.
+func hashAll(ctx context.Context, name string, files []File, opts Options, hash func(File) (string, error)) ([]hashed, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	p := pipeline.New(ctx, "dupes")
+	in := pipeline.FromSlice(p, "files", files)
+	out := pipeline.Map(in, name, func(ctx context.Context, f File) (hashed, error) {
+		// A file that cannot be read is reported, but does not stop the
+		// other workers.
+		sum, err := hash(f)
+		return hashed{file: f, sum: sum, err: err}, nil
+	}, pipeline.Workers(opts.Workers))
+	results, err := pipeline.Collect(out)
+	if err != nil {
+		return nil, err
+	}
+
+	// The workers finish in any order, restore the order of the files.
+	pos := make(map[string]int, len(files))
+	for i, f := range files {
+		pos[f.Path] = i
+	}
+	slices.SortFunc(results, func(a, b hashed) int {
+		return cmp.Compare(pos[a.file.Path], pos[b.file.Path])
+	})
+	return results, nil
+}
+
+// groupBy groups the files with the same size and hash. Groups of a single
+// file are dropped.
+func groupBy(files []hashed, onError func(string, error)) []Group {
+	type key struct {
+		size int64
+		sum  string
+	}
+	byKey := map[key]*Group{}
+	var keys []key
+	for _, h := range files {
+		if h.err != nil {
+			onError(h.file.Path, h.err)
+			continue
+		}
+		k := key{h.file.Size, h.sum}
+		g, ok := byKey[k]
+		if !ok {
+			g = &Group{Size: h.file.Size, SHA256: h.sum}
+			byKey[k] = g
+			keys = append(keys, k)
+		}
+		g.Files = append(g.Files, h.file)
+	}
+
+	var groups []Group
+	for _, k := range keys {
+		g := byKey[k]
+		if len(g.Files) < 2 {
+			continue
+		}
+		groups = append(groups, *g)
+	}
+	return groups
+}
+
+// hashFile returns the hex-encoded SHA-256 digest of a file of the given
+// size. If partial is not 0, it only hashes the first and the last partial
+// bytes of the file.
+func hashFile(path string, size, partial int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if partial == 0 || size <= 2*partial {
+		return walk.Hash(f)
+	}
+	return walk.Hash(io.MultiReader(
+		io.NewSectionReader(f, 0, partial),
+		io.NewSectionReader(f, size-partial, partial),
+	))
+}
@@ -0,0 +1,245 @@
+package dupes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files in dir, by slash-separated path.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// paths returns the paths of the files of g relative to dir.
+func paths(t *testing.T, dir string, g Group) string {
+	var names []string
+	for _, f := range g.Files {
+		rel, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.ToSlash(rel))
+	}
+	return strings.Join(names, " ")
+}
+
+func sum(content string) string {
+	h := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	// With a partial size of 4, files of up to 8 bytes are hashed fully in
+	// the partial round.
+	large := "head" + strings.Repeat("x", 20) + "tail"
+	writeFiles(t, dir, map[string]string{
+		// Small copies, found by the partial hash.
+		"a/small": "small", "b/small": "small", "b/small2": "small",
+		// Same size, different content.
+		"a/other": "other",
+		// Unique size.
+		"a/unique": "unique content",
+		// Large copies, found by the full hash.
+		"a/large": large, "b/large": large,
+		// Same size, start and end as the large copies, so only the full
+		// hash tells them apart.
+		"b/middle": "head" + strings.Repeat("y", 20) + "tail",
+		// Empty files are all equal, but never reported.
+		"a/empty": "", "b/empty": "",
+	})
+	// A hard link is the same file, not a copy.
+	if err := os.Link(filepath.Join(dir, "a/small"), filepath.Join(dir, "a/small-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs []string
+	groups, err := Find(context.Background(), []string{filepath.Join(dir, "b"), filepath.Join(dir, "a")}, Options{
+		PartialSize: 4,
+		Workers:     3,
+		OnError:     func(path string, err error) { errs = append(errs, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("errors for %v", errs)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("found %d groups, want 2: %+v", len(groups), groups)
+	}
+
+	// The largest files come first, and the files are in the order of
+	// the directories.
+	if got := paths(t, dir, groups[0]); got != "b/large a/large" {
+		t.Errorf("first group %s", got)
+	}
+	if groups[0].Size != int64(len(large)) || groups[0].SHA256 != sum(large) {
+		t.Errorf("first group has size %d and digest %s", groups[0].Size, groups[0].SHA256)
+	}
+	if got := paths(t, dir, groups[1]); got != "b/small b/small2 a/small" {
+		t.Errorf("second group %s", got)
+	}
+	if groups[1].SHA256 != sum("small") || groups[1].Wasted() != 10 {
+		t.Errorf("second group has digest %s and wastes %d bytes", groups[1].SHA256, groups[1].Wasted())
+	}
+}
+
+func TestFindCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "same", "b": "same"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Find(ctx, []string{dir}, Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Find returned %v, want context.Canceled", err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a": "0123-middle-a-6789",
+		"b": "0123-middle-b-6789",
+	})
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+
+	partialA, err := hashFile(a, 18, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partialB, _ := hashFile(b, 18, 4)
+	if partialA != partialB || partialA != sum("01236789") {
+		t.Errorf("partial hashes %s and %s, want the digest of the first and last 4 bytes", partialA, partialB)
+	}
+
+	fullA, _ := hashFile(a, 18, 0)
+	fullB, _ := hashFile(b, 18, 0)
+	if fullA == fullB || fullA != sum("0123-middle-a-6789") {
+		t.Errorf("full hashes %s and %s", fullA, fullB)
+	}
+
+	// A file of at most twice the partial size is hashed fully.
+	if small, _ := hashFile(a, 18, 9); small != fullA {
+		t.Errorf("partial hash of a small file %s, want the full hash", small)
+	}
+
+	if _, err := hashFile(filepath.Join(dir, "missing"), 1, 0); err == nil {
+		t.Error("hashing a missing file succeeded")
+	}
+}
+
+// findOne returns the only group of copies in dir.
+func findOne(t *testing.T, dir string) Group {
+	t.Helper()
+	groups, err := Find(context.Background(), []string{dir}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("found %d groups, want 1", len(groups))
+	}
+	return groups[0]
+}
+
+func TestLink(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "same", "b": "same", "c/d": "same"})
+	g := findOne(t, dir)
+
+	done, err := Link(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Errorf("linked %d files, want 2", len(done))
+	}
+	keep, _ := os.Stat(filepath.Join(dir, "a"))
+	for _, name := range []string{"b", "c/d"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(keep, info) {
+			t.Errorf("%s is not a link to a", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.dupes-link")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the temporary link is left: %v", err)
+	}
+
+	// The links are the same file now, so nothing is left to do.
+	groups, _ := Find(context.Background(), []string{dir}, Options{})
+	if len(groups) != 0 {
+		t.Errorf("found %d groups after linking", len(groups))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a": "same", "b": "same", "c": "same"})
+	g := findOne(t, dir)
+
+	done, err := Remove(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Errorf("removed %d files, want 2", len(done))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); err != nil {
+		t.Errorf("the first file is gone: %v", err)
+	}
+	for _, name := range []string{"b", "c"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s was not removed: %v", name, err)
+		}
+	}
+}
+
+func TestActionsSkipChangedFiles(t *testing.T) {
+	for _, action := range []struct {
+		name string
+		fn   func(Group) ([]File, error)
+	}{{"Link", Link}, {"Remove", Remove}} {
+		t.Run(action.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"a": "same", "b": "same", "c": "same"})
+			g := findOne(t, dir)
+
+			// b changes after it was compared, and is left alone.
+			writeFiles(t, dir, map[string]string{"b": "different"})
+			done, err := action.fn(g)
+			if !errors.Is(err, ErrChanged) {
+				t.Errorf("got error %v, want ErrChanged", err)
+			}
+			if len(done) != 1 || done[0].Path != filepath.Join(dir, "c") {
+				t.Errorf("done %+v, want only c", done)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "b")); string(data) != "different" {
+				t.Errorf("b contains %q", data)
+			}
+
+			// If the file to keep changed, nothing is done.
+			writeFiles(t, dir, map[string]string{"a": "changed"})
+			if done, err := action.fn(g); !errors.Is(err, ErrChanged) || len(done) != 0 {
+				t.Errorf("got %v, %v after the first file changed", done, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+// Package extract turns an HTML page into structured data.
+//
+// Extract pulls out the data most pages have in common (title, meta
+// description, Open Graph tags, links, headings and the main text), and
+// additional values picked with CSS selectors.
+package extract
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Page is the structured data extracted from an HTML document.
+type Page struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Meta        map[string]string   `json:"meta,omitempty"`
+	OpenGraph   map[string]string   `json:"openGraph,omitempty"`
+	Headings    []Heading           `json:"headings,omitempty"`
+	Links       []Link              `json:"links,omitempty"`
+	Text        string              `json:"text,omitempty"`
+	Selected    map[string][]string `json:"selected,omitempty"`
+}
+
+// Heading is an <h1> to <h6> element.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// Link is an <a href> element.
+type Link struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+// Options configures Extract.
+type Options struct {
+	// BaseURL is used to turn relative links into absolute ones. If nil,
+	// links are returned as they appear in the document.
+	BaseURL *url.URL
+	// Selectors maps a name to a selector. The values matched by each
+	// selector end up in Page.Selected under that name.
+	Selectors map[string]*Selector
+}
+
+// mainSelectors find the element holding the main content of a page. The
+// first selector that matches wins, so <main> is preferred over <article>.
+var mainSelectors = []*Selector{
+	MustCompile("main"),
+	MustCompile("[role=main]"),
+	MustCompile("article"),
+	MustCompile("body"),
+}
+
+// Extract parses the HTML document read from r and extracts its data.
+func Extract(r io.Reader, opts Options) (*Page, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Page{
+		Meta:      map[string]string{},
+		OpenGraph: map[string]string{},
+	}
+
+	walk(doc, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+
+		switch n.DataAtom {
+		case atom.Title:
+			// Only use the document title, not the <title> of an inline SVG.
+			if p.Title == "" {
+				p.Title = Text(n)
+			}
+		case atom.Meta:
+			content, _ := getAttr(n, "content")
+			if prop, ok := getAttr(n, "property"); ok && strings.HasPrefix(prop, "og:") {
+				p.OpenGraph[strings.TrimPrefix(prop, "og:")] = content
+			} else if name, ok := getAttr(n, "name"); ok {
+				// If a name appears more than once, the last tag wins.
+				// CMSs tend to add page-specific tags after site-wide ones.
+				p.Meta[strings.ToLower(name)] = content
+			}
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			if text := Text(n); text != "" {
+				p.Headings = append(p.Headings, Heading{Level: int(n.Data[1] - '0'), Text: text})
+			}
+		case atom.A:
+			href, ok := getAttr(n, "href")
+			if !ok || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+				return true
+			}
+			p.Links = append(p.Links, Link{Href: resolve(opts.BaseURL, href), Text: Text(n)})
+		}
+		return true
+	})
+
+	p.Description = p.Meta["description"]
+	if p.Description == "" {
+		p.Description = p.OpenGraph["description"]
+	}
+
+	for _, sel := range mainSelectors {
+		if nodes := sel.MatchAll(doc); len(nodes) > 0 {
+			p.Text = Text(nodes[0])
+			break
+		}
+	}
+
+	if len(opts.Selectors) > 0 {
+		p.Selected = map[string][]string{}
+		for name, sel := range opts.Selectors {
+			p.Selected[name] = sel.Values(doc)
+		}
+	}
+
+	return p, nil
+}
+
+// Parse parses an HTML document, e.g. to run selectors on it directly.
+func Parse(r io.Reader) (*html.Node, error) {
+	return html.Parse(r)
+}
+
+// skipText lists elements whose content is not readable text.
+var skipText = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Form:     true,
+}
+
+// blockElements start on a new line when rendered, so their text must be
+// separated from the text before them. Inline elements such as <a> or <em>
+// are not, so "(<a>entry</a>)" stays "(entry)".
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true,
+	atom.Ul: true, atom.Ol: true, atom.Dt: true, atom.Dd: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Table: true, atom.Tr: true, atom.Td: true, atom.Th: true,
+	atom.Section: true, atom.Article: true, atom.Aside: true, atom.Main: true,
+}
+
+// Text returns the readable text inside n, with runs of whitespace
+// collapsed into single spaces. Scripts, styles and page furniture such as
+// navigation and footers are skipped.
+func Text(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c != n {
+			if skipText[c.DataAtom] {
+				return false
+			}
+			if blockElements[c.DataAtom] {
+				b.WriteByte(' ')
+			}
+		}
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// walk calls fn for n and all of its descendants in document order. If fn
+// returns false, the children of that node are skipped.
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// getAttr returns the value of the attribute name of n.
+func getAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// resolve turns href into an absolute URL relative to base.
+func resolve(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if base == nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
@@ -0,0 +1,181 @@
+package extract
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// The fixture is a copy of the page that `fetch` saves to remoteData.html,
+// so the tests run offline.
+const fixture = "testdata/remoteData.html"
+
+func extractFixture(t *testing.T, opts Options) *Page {
+	t.Helper()
+	f, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := Extract(f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExtract(t *testing.T) {
+	base, _ := url.Parse("https://www.devdungeon.com/content/web-scraping-go")
+	p := extractFixture(t, Options{BaseURL: base})
+
+	// The commented-out <title> at the top of the page must not be used.
+	if want := "Web Scraping with Go | DevDungeon"; p.Title != want {
+		t.Errorf("title %q, want %q", p.Title, want)
+	}
+	// The page has a site-wide and a page-specific description; the later,
+	// page-specific one wins.
+	if !strings.HasPrefix(p.Description, "Web scraping (Wikipedia entry)") {
+		t.Errorf("description %.80q, want the page-specific one", p.Description)
+	}
+	if got := p.OpenGraph["title"]; got != "Web Scraping with Go" {
+		t.Errorf("og:title %q", got)
+	}
+	if len(p.Headings) == 0 || p.Headings[0] != (Heading{Level: 1, Text: "Web Scraping with Go"}) {
+		t.Errorf("first heading %+v, want the <h1>", p.Headings[:min(1, len(p.Headings))])
+	}
+
+	if len(p.Links) == 0 {
+		t.Fatal("no links")
+	}
+	for _, l := range p.Links {
+		if strings.HasPrefix(l.Href, "#") || strings.HasPrefix(l.Href, "javascript:") {
+			t.Errorf("link %q should have been skipped", l.Href)
+		}
+		if u, err := url.Parse(l.Href); err == nil && u.Scheme != "" && !u.IsAbs() {
+			t.Errorf("link %q is not absolute", l.Href)
+		}
+	}
+	if p.Links[0].Href != "https://www.devdungeon.com/" {
+		t.Errorf("first link %q, want the home page resolved against the base URL", p.Links[0].Href)
+	}
+
+	// The page has no <main>, so the text comes from the <article>.
+	if !strings.Contains(p.Text, "Make an HTTP GET request") || strings.Contains(p.Text, "Google Tag Manager") {
+		t.Errorf("text does not look like the article: %.200q", p.Text)
+	}
+}
+
+func TestExtractSelectors(t *testing.T) {
+	p := extractFixture(t, Options{Selectors: map[string]*Selector{
+		"h1":        MustCompile("article h1, h1.page-header"),
+		"sections":  MustCompile("article h2"),
+		"canonical": MustCompile("link[rel=canonical]::attr(href)"),
+		"none":      MustCompile("blink"),
+	}})
+
+	if got := p.Selected["h1"]; len(got) != 1 || got[0] != "Web Scraping with Go" {
+		t.Errorf("h1: %q", got)
+	}
+	if got := p.Selected["sections"]; len(got) < 10 || got[0] != "Overview" {
+		t.Errorf("sections: %q", got)
+	}
+	if got := p.Selected["canonical"]; len(got) != 1 || !strings.HasSuffix(got[0], "/content/web-scraping-go") {
+		t.Errorf("canonical: %q", got)
+	}
+	if got, ok := p.Selected["none"]; !ok || len(got) != 0 {
+		t.Errorf("none: %q, %v, want an empty list", got, ok)
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`
+		<div id="nav" class="menu top">
+			<a href="/a" class="internal">A</a>
+			<p><a href="https://example.com/b">B</a></p>
+		</div>
+		<a href="mailto:c@example.com" lang="en fr">C</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sel  string
+		want string
+	}{
+		{"a", "A B C"},
+		{"*", ""}, // html, head, body and so on have text too, checked below
+		{"#nav a", "A B"},
+		{"#nav > a", "A"},
+		{"div.menu.top > p a", "B"},
+		{".menu.bottom a", ""},
+		{"a.internal", "A"},
+		{"a[href]", "A B C"},
+		{"a[href=/a]", "A"},
+		{`a[href^="https:"]`, "B"},
+		{"a[href$=.com]", "C"},
+		{"a[href*=example]", "B C"},
+		{"a[lang~=fr]", "C"},
+		{"a[lang~=f]", ""},
+		{"p a, a.internal", "A B"},
+		{"A[HREF=/a]", "A"},
+	}
+	for _, tt := range tests {
+		s, err := Compile(tt.sel)
+		if err != nil {
+			t.Errorf("%s: %v", tt.sel, err)
+			continue
+		}
+		if tt.sel == "*" {
+			if len(s.MatchAll(doc)) < 7 {
+				t.Errorf("* matched %d elements", len(s.MatchAll(doc)))
+			}
+			continue
+		}
+		if got := strings.Join(s.Values(doc), " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.sel, got, tt.want)
+		}
+	}
+
+	s := MustCompile("a::attr(href)")
+	if got := strings.Join(s.Values(doc), " "); got != "/a https://example.com/b mailto:c@example.com" {
+		t.Errorf("::attr(href): %q", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		sel  string
+		want string // part of the error message
+	}{
+		{"a:hover", "pseudo-class"},
+		{"a::before", "pseudo-class"},
+		{"a.external:first-child", "pseudo-class"},
+		{"#nav:not(.x)", "pseudo-class"},
+		{"a[href]:visited", "pseudo-class"},
+		{":root", "pseudo-class"},
+		{"h1 + p", "unsupported character"},
+		{"h1~p", "unsupported character"},
+		{"a[href|=en]", "unsupported character"},
+		{"a[=x]", "missing attribute name"},
+		{"a[href", "unterminated"},
+		{"a.", "missing name"},
+		{"", "empty selector"},
+		{"a,", "empty selector"},
+		{"> a", "unexpected >"},
+		{"a >", "ends with >"},
+		{"a::attr(href) b", "must be at the end"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.sel)
+		if err == nil {
+			t.Errorf("Compile(%q) succeeded, want an error", tt.sel)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q): %v, want an error about %q", tt.sel, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector is a compiled CSS selector.
+//
+// The supported subset covers what is needed to pick data out of a page:
+//   - type selectors (div), the universal selector (*)
+//   - #id and .class
+//   - attribute selectors: [attr], [attr=v], [attr~=v], [attr^=v], [attr$=v], [attr*=v]
+//   - descendant (a b) and child (a > b) combinators
+//   - selector groups (a, b)
+//   - the ::attr(name) pseudo-element, which selects an attribute value
+//     instead of the element's text
+//
+// Attribute values in selectors must not contain spaces, commas or `>`.
+// Compile returns an error for anything else, such as pseudo-classes
+// (a:hover), other pseudo-elements (p::before) or the + and ~ combinators,
+// instead of accepting a selector that can never match.
+type Selector struct {
+	groups []complexSel
+	// attr is set by ::attr(name).
+	attr string
+}
+
+// complexSel is a chain of compound selectors joined by combinators,
+// stored from left to right.
+type complexSel struct {
+	parts []compoundSel
+	// child[i] is true if parts[i] and parts[i+1] are joined by `>`.
+	child []bool
+}
+
+// compoundSel is a sequence of simple selectors without combinators,
+// e.g. a.external[href^=http].
+type compoundSel struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSel
+}
+
+// attrSel is a single attribute selector.
+type attrSel struct {
+	name, op, value string
+}
+
+// Compile parses a CSS selector.
+func Compile(sel string) (*Selector, error) {
+	s := &Selector{}
+
+	// Cut off the ::attr(name) pseudo-element, which applies to all groups.
+	if i := strings.Index(sel, "::attr("); i >= 0 {
+		rest := sel[i+len("::attr("):]
+		end := strings.Index(rest, ")")
+		if end < 0 || strings.TrimSpace(rest[end+1:]) != "" {
+			return nil, fmt.Errorf("selector %q: ::attr() must be at the end", sel)
+		}
+		s.attr = strings.TrimSpace(rest[:end])
+		sel = sel[:i]
+	}
+
+	for _, group := range strings.Split(sel, ",") {
+		c, err := parseComplex(group)
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", sel, err)
+		}
+		s.groups = append(s.groups, c)
+	}
+	return s, nil
+}
+
+// MustCompile is like Compile but panics if the selector cannot be parsed.
+// It is meant for selectors that are fixed in the code.
+func MustCompile(sel string) *Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// parseComplex parses a selector without commas.
+func parseComplex(sel string) (complexSel, error) {
+	var c complexSel
+
+	// Put spaces around `>` so it becomes a token of its own.
+	fields := strings.Fields(strings.ReplaceAll(sel, ">", " > "))
+	if len(fields) == 0 {
+		return c, fmt.Errorf("empty selector")
+	}
+
+	child := false
+	for _, f := range fields {
+		if f == ">" {
+			if len(c.parts) == 0 || child {
+				return c, fmt.Errorf("unexpected >")
+			}
+			child = true
+			continue
+		}
+		part, err := parseCompound(f)
+		if err != nil {
+			return c, err
+		}
+		if len(c.parts) > 0 {
+			c.child = append(c.child, child)
+		}
+		c.parts = append(c.parts, part)
+		child = false
+	}
+	if child {
+		return c, fmt.Errorf("selector ends with >")
+	}
+	return c, nil
+}
+
+// parseCompound parses a compound selector such as a.external[href^=http].
+func parseCompound(s string) (compoundSel, error) {
+	var c compoundSel
+
+	// The type selector comes first, if there is one.
+	i := strings.IndexAny(s, "#.[")
+	if i < 0 {
+		i = len(s)
+	}
+	c.tag = strings.ToLower(s[:i])
+	if c.tag == "*" {
+		c.tag = ""
+	} else if err := checkName("type selector", c.tag); err != nil {
+		return c, err
+	}
+	s = s[i:]
+
+	for s != "" {
+		switch s[0] {
+		case '#', '.':
+			end := strings.IndexAny(s[1:], "#.[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			name := s[1 : end+1]
+			if name == "" {
+				return c, fmt.Errorf("missing name after %q", s[0])
+			}
+			if err := checkName("name", name); err != nil {
+				return c, err
+			}
+			if s[0] == '#' {
+				c.id = name
+			} else {
+				c.classes = append(c.classes, name)
+			}
+			s = s[end+1:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return c, fmt.Errorf("unterminated attribute selector")
+			}
+			a, err := parseAttr(s[1:end])
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, a)
+			s = s[end+1:]
+		case ':':
+			return c, fmt.Errorf("unsupported pseudo-class or pseudo-element %q", s)
+		default:
+			return c, fmt.Errorf("unexpected %q", s)
+		}
+	}
+	return c, nil
+}
+
+// checkName returns an error if name is not a plain CSS identifier. A
+// colon means a pseudo-class or pseudo-element, which gets a clearer error
+// than the other characters.
+func checkName(kind, name string) error {
+	for i, r := range name {
+		switch {
+		case r == ':':
+			return fmt.Errorf("unsupported pseudo-class or pseudo-element %q", name[i:])
+		case r == '-' || r == '_' || r >= 0x80,
+			'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		default:
+			return fmt.Errorf("unsupported character %q in %s %q", r, kind, name)
+		}
+	}
+	return nil
+}
+
+// parseAttr parses the inside of an attribute selector, e.g. href^="http".
+func parseAttr(s string) (attrSel, error) {
+	for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+		name, value, ok := strings.Cut(s, op)
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return attrSel{}, fmt.Errorf("missing attribute name before %q", op)
+		}
+		if err := checkName("attribute name", name); err != nil {
+			return attrSel{}, err
+		}
+		return attrSel{name: name, op: op, value: value}, nil
+	}
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" {
+		return attrSel{}, fmt.Errorf("empty attribute selector")
+	}
+	if err := checkName("attribute name", name); err != nil {
+		return attrSel{}, err
+	}
+	return attrSel{name: name}, nil
+}
+
+// MatchAll returns all elements below root that match the selector, in
+// document order.
+func (s *Selector) MatchAll(root *html.Node) []*html.Node {
+	var nodes []*html.Node
+	walk(root, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && s.Match(n) {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// Match reports whether the element n matches the selector.
+func (s *Selector) Match(n *html.Node) bool {
+	for _, g := range s.groups {
+		if g.match(n, len(g.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the text of all matching elements, or the value of the
+// ::attr() attribute if the selector has one.
+func (s *Selector) Values(root *html.Node) []string {
+	values := []string{}
+	for _, n := range s.MatchAll(root) {
+		if s.attr != "" {
+			if v, ok := getAttr(n, s.attr); ok {
+				values = append(values, v)
+			}
+			continue
+		}
+		values = append(values, Text(n))
+	}
+	return values
+}
+
+// match reports whether n matches parts[0..i], with parts[i] matching n
+// itself and the earlier parts matching its ancestors.
+func (c complexSel) match(n *html.Node, i int) bool {
+	if !c.parts[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	// A child combinator needs the direct parent to match, a descendant
+	// combinator any ancestor.
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if c.match(p, i-1) {
+			return true
+		}
+		if c.child[i-1] {
+			return false
+		}
+	}
+	return false
+}
+
+// match reports whether the element n matches all simple selectors.
+func (c compoundSel) match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" {
+		if id, _ := getAttr(n, "id"); id != c.id {
+			return false
+		}
+	}
+	if len(c.classes) > 0 {
+		class, _ := getAttr(n, "class")
+		have := strings.Fields(class)
+		for _, want := range c.classes {
+			if !contains(have, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether n has an attribute that satisfies the selector.
+func (a attrSel) match(n *html.Node) bool {
+	v, ok := getAttr(n, a.name)
+	if !ok {
+		return false
+	}
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return v == a.value
+	case "~=":
+		return contains(strings.Fields(v), a.value)
+	case "^=":
+		return a.value != "" && strings.HasPrefix(v, a.value)
+	case "$=":
+		return a.value != "" && strings.HasSuffix(v, a.value)
+	case "*=":
+		return a.value != "" && strings.Contains(v, a.value)
+	}
+	return false
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a request is rejected because the
+// circuit breaker for its host is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit breaker for a single host.
+type State int
+
+const (
+	// StateClosed lets all requests through. This is the normal state.
+	StateClosed State = iota
+	// StateOpen rejects all requests until the open timeout has passed.
+	StateOpen
+	// StateHalfOpen lets a single trial request through. If it succeeds
+	// the circuit closes again, if it fails the circuit re-opens.
+	StateHalfOpen
+)
+
+// String implements the Stringer interface.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// BreakerConfig configures a Breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// the circuit for a host opens. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long a circuit stays open before a trial request
+	// is allowed through. Defaults to 30s.
+	OpenTimeout time.Duration
+	// OnStateChange is called whenever the circuit of a host changes state.
+	// It is called while the Breaker is locked and must not call back into it.
+	OnStateChange func(host string, from, to State)
+}
+
+// Breaker is a circuit breaker that keeps a separate circuit per host, so
+// one failing host does not block requests to other hosts.
+type Breaker struct {
+	cfg BreakerConfig
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// circuit holds the state of a single host.
+type circuit struct {
+	state    State
+	failures int
+	openedAt time.Time
+	// trial is true while the single half-open trial request is running.
+	trial bool
+}
+
+// NewBreaker creates a Breaker, filling in defaults for unset fields.
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	return &Breaker{cfg: cfg, hosts: map[string]*circuit{}}
+}
+
+// WithBreaker guards all requests of a Fetcher with the given Breaker.
+// A Breaker can be shared between several fetchers.
+func WithBreaker(b *Breaker) Option {
+	return func(f *Fetcher) {
+		f.breaker = b
+	}
+}
+
+// State returns the current state of the circuit for host.
+func (b *Breaker) State(host string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok {
+		return StateClosed
+	}
+	// An open circuit whose timeout has passed is ready for a trial.
+	if c.state == StateOpen && time.Since(c.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return c.state
+}
+
+// Allow reports whether a request to host may be sent. It returns
+// ErrCircuitOpen if the circuit is open, or if it is half-open and the
+// trial request is still running.
+func (b *Breaker) Allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	switch c.state {
+	case StateOpen:
+		if time.Since(c.openedAt) < b.cfg.OpenTimeout {
+			return fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+		}
+		b.setState(host, c, StateHalfOpen)
+		c.trial = true
+		return nil
+	case StateHalfOpen:
+		if c.trial {
+			return fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+		}
+		c.trial = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a request to host that was allowed.
+func (b *Breaker) Record(host string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	c.trial = false
+
+	if success {
+		c.failures = 0
+		b.setState(host, c, StateClosed)
+		return
+	}
+
+	c.failures++
+	if c.state == StateHalfOpen || c.failures >= b.cfg.FailureThreshold {
+		c.openedAt = time.Now()
+		b.setState(host, c, StateOpen)
+	}
+}
+
+// release frees the trial slot of host without recording an outcome, e.g.
+// when the caller cancelled the request.
+func (b *Breaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.circuit(host).trial = false
+}
+
+// circuit returns the circuit for host, creating it if necessary.
+// b.mu must be held.
+func (b *Breaker) circuit(host string) *circuit {
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+	return c
+}
+
+// setState changes the state of c and notifies the OnStateChange hook.
+// b.mu must be held.
+func (b *Breaker) setState(host string, c *circuit, to State) {
+	from := c.state
+	c.state = to
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(host, from, to)
+	}
+}
@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreakerStates(t *testing.T) {
+	var changes []string
+	b := NewBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(host string, from, to State) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	})
+	const host = "example.com"
+
+	b.Record(host, false)
+	if s := b.State(host); s != StateClosed {
+		t.Fatalf("after 1 failure: %s, want closed", s)
+	}
+	b.Record(host, false)
+	if s := b.State(host); s != StateOpen {
+		t.Fatalf("after 2 failures: %s, want open", s)
+	}
+	if err := b.Allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow on an open circuit: %v, want ErrCircuitOpen", err)
+	}
+	if s := b.State("other.com"); s != StateClosed {
+		t.Errorf("other host: %s, want closed", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if s := b.State(host); s != StateHalfOpen {
+		t.Fatalf("after the open timeout: %s, want half-open", s)
+	}
+	// Only a single trial request is let through.
+	if err := b.Allow(host); err != nil {
+		t.Fatalf("first trial: %v", err)
+	}
+	if err := b.Allow(host); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second trial: %v, want ErrCircuitOpen", err)
+	}
+	// A failed trial re-opens the circuit.
+	b.Record(host, false)
+	if s := b.State(host); s != StateOpen {
+		t.Fatalf("after a failed trial: %s, want open", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(host); err != nil {
+		t.Fatal(err)
+	}
+	b.Record(host, true)
+	if s := b.State(host); s != StateClosed {
+		t.Fatalf("after a successful trial: %s, want closed", s)
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state change %d: %s, want %s", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestFetcherWithBreaker(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	b := NewBreaker(BreakerConfig{FailureThreshold: 3, OpenTimeout: time.Hour})
+	f := New(WithClient(srv.Client()), WithBreaker(b))
+	ctx := context.Background()
+
+	// 4xx responses mean the host is healthy.
+	for i := 0; i < 5; i++ {
+		f.Get(ctx, srv.URL+"/missing")
+	}
+	if s := b.State(u.Host); s != StateClosed {
+		t.Fatalf("after 404s: %s, want closed", s)
+	}
+
+	for i := 0; i < 3; i++ {
+		f.Get(ctx, srv.URL)
+	}
+	if s := b.State(u.Host); s != StateOpen {
+		t.Fatalf("after 500s: %s, want open", s)
+	}
+	before := hits.Load()
+	if _, err := f.Get(ctx, srv.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want ErrCircuitOpen", err)
+	}
+	if hits.Load() != before {
+		t.Error("a request was sent through an open circuit")
+	}
+}
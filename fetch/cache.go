@@ -0,0 +1,277 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheStore when it has no entry for a key,
+// and by an offline Fetcher when a URL has not been cached yet.
+var ErrCacheMiss = errors.New("not in cache")
+
+// CacheEntry is a stored response.
+type CacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	StoredAt   time.Time   `json:"storedAt"`
+	Body       []byte      `json:"-"`
+}
+
+// CacheStore persists cache entries.
+type CacheStore interface {
+	// Get returns the entry for key, or ErrCacheMiss.
+	Get(key string) (*CacheEntry, error)
+	// Put stores e under key, replacing any previous entry.
+	Put(key string, e *CacheEntry) error
+}
+
+// Cache is an HTTP cache for GET requests. It follows the basic rules of
+// HTTP caching:
+//   - responses with Cache-Control: no-store are never stored
+//   - stored responses are served without a request while they are fresh
+//     (Cache-Control: max-age, or Expires)
+//   - stale responses, and responses with Cache-Control: no-cache, are
+//     revalidated with If-None-Match (ETag) and If-Modified-Since
+//     (Last-Modified); a 304 Not Modified response re-uses the stored body
+//
+// In offline mode, no requests are sent at all and only stored responses
+// are served, whether they are fresh or not.
+type Cache struct {
+	store CacheStore
+	// Offline serves responses from the store only. URLs that have not
+	// been stored yet fail with ErrCacheMiss.
+	Offline bool
+}
+
+// NewCache creates a Cache that keeps its entries in store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{store: store}
+}
+
+// WithCache caches the responses of Get and Do in c. Open, which is used
+// for streaming, always bypasses the cache.
+func WithCache(c *Cache) Option {
+	return func(f *Fetcher) {
+		f.cache = c
+	}
+}
+
+// do serves req from the cache, revalidating or fetching it through f if
+// necessary.
+func (c *Cache) do(f *Fetcher, req *http.Request) (*Response, error) {
+	key := req.URL.String()
+
+	entry, err := c.store.Get(key)
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		return nil, err
+	}
+
+	if c.Offline {
+		if entry == nil {
+			return nil, fmt.Errorf("%s %s (offline): %w", req.Method, key, ErrCacheMiss)
+		}
+		return entry.response(), nil
+	}
+
+	if entry != nil && entry.fresh(time.Now()) {
+		return entry.response(), nil
+	}
+
+	// Ask the server to only send the body if it changed. The headers go
+	// on a clone, so the caller can reuse req.
+	if entry != nil {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	resp, err := f.fetch(req)
+	var se *StatusError
+	if entry != nil && errors.As(err, &se) && se.StatusCode == http.StatusNotModified {
+		// The stored body is still valid. Take over the new headers,
+		// which may extend the freshness of the entry.
+		for k, v := range se.Header {
+			entry.Header[k] = v
+		}
+		entry.StoredAt = time.Now()
+		if err := c.store.Put(key, entry); err != nil {
+			return nil, err
+		}
+		return entry.response(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !directives(resp.Header)["no-store"].set {
+		entry := &CacheEntry{
+			URL:        key,
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			StoredAt:   time.Now(),
+			Body:       resp.Body,
+		}
+		if err := c.store.Put(key, entry); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// response turns e into a Response.
+func (e *CacheEntry) response() *Response {
+	return &Response{
+		URL:        e.URL,
+		StatusCode: e.StatusCode,
+		Header:     e.Header,
+		Body:       e.Body,
+		FromCache:  true,
+	}
+}
+
+// fresh reports whether e can be served without asking the server.
+func (e *CacheEntry) fresh(now time.Time) bool {
+	cc := directives(e.Header)
+	if cc["no-cache"].set {
+		return false
+	}
+
+	if maxAge, ok := cc["max-age"]; ok {
+		secs, err := strconv.Atoi(maxAge.value)
+		if err != nil {
+			return false
+		}
+		return now.Before(e.StoredAt.Add(time.Duration(secs) * time.Second))
+	}
+
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return false
+		}
+		return now.Before(t)
+	}
+
+	// Without explicit freshness information, always revalidate.
+	return false
+}
+
+// directive is a single Cache-Control directive.
+type directive struct {
+	set   bool
+	value string
+}
+
+// directives parses the Cache-Control header, e.g. "public, max-age=60".
+func directives(h http.Header) map[string]directive {
+	d := map[string]directive{}
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			d[strings.ToLower(name)] = directive{set: true, value: strings.Trim(value, `"`)}
+		}
+	}
+	return d
+}
+
+// DiskStore is a CacheStore that keeps every entry in two files in a
+// directory: <hash>.json with the status and headers, and <hash>.body with
+// the body. The hash is the SHA-256 of the key.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a DiskStore in dir, creating the directory if needed.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get implements CacheStore.
+func (s *DiskStore) Get(key string) (*CacheEntry, error) {
+	base := s.path(key)
+
+	meta, err := os.ReadFile(base + ".json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e CacheEntry
+	if err := json.Unmarshal(meta, &e); err != nil {
+		return nil, fmt.Errorf("cache entry for %s is corrupt: %w", key, err)
+	}
+
+	e.Body, err = os.ReadFile(base + ".body")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Put implements CacheStore. The body is written before the metadata, so a
+// crash in between leaves no entry that points at a missing body.
+func (s *DiskStore) Put(key string, e *CacheEntry) error {
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	base := s.path(key)
+	if err := writeFileAtomic(base+".body", e.Body); err != nil {
+		return err
+	}
+	return writeFileAtomic(base+".json", meta)
+}
+
+// path returns the path of the files for key, without extension.
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Clean up the temporary file if anything goes wrong. After a
+	// successful rename this is a no-op.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
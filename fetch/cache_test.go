@@ -0,0 +1,158 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheRevalidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator string // response header
+		condition string // request header the cache must send
+		value     string
+	}{
+		{name: "etag", validator: "ETag", condition: "If-None-Match", value: `"v1"`},
+		{name: "last-modified", validator: "Last-Modified", condition: "If-Modified-Since", value: "Mon, 02 Jan 2006 15:04:05 GMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits, notModified atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.Header().Set(tt.validator, tt.value)
+				w.Header().Set("Cache-Control", "no-cache")
+				if r.Header.Get(tt.condition) == tt.value {
+					notModified.Add(1)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				w.Write([]byte("page"))
+			}))
+			defer srv.Close()
+
+			store, err := NewDiskStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := New(WithClient(srv.Client()), WithCache(NewCache(store)))
+			for i := 0; i < 3; i++ {
+				resp, err := f.Get(context.Background(), srv.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(resp.Body) != "page" {
+					t.Fatalf("request %d: body %q, want %q", i, resp.Body, "page")
+				}
+				if resp.FromCache != (i > 0) {
+					t.Errorf("request %d: FromCache = %v", i, resp.FromCache)
+				}
+			}
+			if hits.Load() != 3 || notModified.Load() != 2 {
+				t.Errorf("got %d requests and %d 304 responses, want 3 and 2", hits.Load(), notModified.Load())
+			}
+		})
+	}
+}
+
+func TestCacheRevalidationKeepsRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(WithClient(srv.Client()), WithCache(NewCache(store)))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The conditional headers are only sent, not set on the caller's
+	// request, which would otherwise turn a reuse without the cache into
+	// a conditional request.
+	if len(req.Header) != 0 {
+		t.Errorf("the request has the headers %v after revalidating", req.Header)
+	}
+}
+
+func TestCacheFresh(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("fresh"))
+	}))
+	defer srv.Close()
+
+	store, _ := NewDiskStore(t.TempDir())
+	f := New(WithClient(srv.Client()), WithCache(NewCache(store)))
+	for i := 0; i < 3; i++ {
+		if _, err := f.Get(context.Background(), srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Errorf("got %d requests, a fresh response should be served from the cache", hits.Load())
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("stored"))
+	}))
+	defer srv.Close()
+
+	store, _ := NewDiskStore(t.TempDir())
+	cache := NewCache(store)
+	f := New(WithClient(srv.Client()), WithCache(cache))
+	ctx := context.Background()
+	if _, err := f.Get(ctx, srv.URL+"/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Offline = true
+	resp, err := f.Get(ctx, srv.URL+"/a")
+	if err != nil || string(resp.Body) != "stored" {
+		t.Fatalf("offline Get of a stored URL: %q, %v", resp.Body, err)
+	}
+	if _, err := f.Get(ctx, srv.URL+"/b"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("offline Get of a new URL: %v, want ErrCacheMiss", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("got %d requests, offline mode must not send any", hits.Load())
+	}
+}
+
+func TestCacheNoStore(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+
+	store, _ := NewDiskStore(t.TempDir())
+	f := New(WithClient(srv.Client()), WithCache(NewCache(store)))
+	f.Get(context.Background(), srv.URL)
+	if _, err := store.Get(srv.URL); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("a no-store response was stored: %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned when a downloaded file does not match the
+// expected SHA-256 digest.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// PartSuffix is appended to the destination path while a download is in
+// progress. An existing part file is resumed by the next download.
+const PartSuffix = ".part"
+
+// DownloadOptions configures Fetcher.Download.
+type DownloadOptions struct {
+	// SHA256 is the expected hex-encoded SHA-256 digest of the file. If
+	// set, the file is only moved into place if its digest matches.
+	SHA256 string
+	// Progress is called periodically while the download is running, and
+	// once more when it has finished.
+	Progress func(Progress)
+	// ProgressInterval is the minimum time between two Progress calls.
+	// Defaults to 500ms.
+	ProgressInterval time.Duration
+}
+
+// Progress describes the state of a running download.
+type Progress struct {
+	// Downloaded is the number of bytes on disk, including resumed bytes.
+	Downloaded int64
+	// Total is the size of the file, or -1 if the server did not tell.
+	Total int64
+	// Rate is the download speed in bytes per second during this run.
+	Rate float64
+	// ETA is the estimated time left, or 0 if unknown.
+	ETA time.Duration
+	// Done is true for the final call.
+	Done bool
+}
+
+// String formats p for humans, e.g. "1.5 MiB / 10.0 MiB (2.0 MiB/s, ETA 4s)".
+func (p Progress) String() string {
+	if p.Total < 0 {
+		return fmt.Sprintf("%s (%s/s)", formatBytes(p.Downloaded), formatBytes(int64(p.Rate)))
+	}
+	return fmt.Sprintf("%s / %s (%s/s, ETA %s)",
+		formatBytes(p.Downloaded), formatBytes(p.Total), formatBytes(int64(p.Rate)), p.ETA.Round(time.Second))
+}
+
+// Download streams url to the file dest without holding it in memory.
+//
+// The data is first written to dest + PartSuffix. If that file already
+// exists from an earlier, interrupted download, only the missing bytes are
+// requested with a Range header. If the connection breaks while streaming,
+// the download resumes from where it stopped, as long as the retry policy
+// allows another attempt. Once complete, the file is verified against
+// opts.SHA256 and renamed to dest. A part file that already has all the
+// bytes is only accepted with a checksum.
+func (f *Fetcher) Download(ctx context.Context, url, dest string, opts DownloadOptions) error {
+	part := dest + PartSuffix
+	attempts := f.retry.attempts()
+
+	for n := 1; ; n++ {
+		total, err := f.downloadPart(ctx, url, part, opts)
+		if err == nil {
+			return finishDownload(part, dest, total, opts)
+		}
+		if n >= attempts || !retryable(ctx, err) {
+			return err
+		}
+
+		d := f.retry.delay(n, err)
+		if f.retry.OnRetry != nil {
+			f.retry.OnRetry(RetryEvent{URL: url, Attempt: n, Err: err, Delay: d})
+		}
+		if sleep(ctx, d) != nil {
+			return err
+		}
+	}
+}
+
+// downloadPart appends the missing bytes of url to the part file. It
+// returns the total size of the file, or -1 if it is unknown.
+func (f *Fetcher) downloadPart(ctx context.Context, url, part string, opts DownloadOptions) (int64, error) {
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Send a single attempt: Download retries, and resumes from the part
+	// file when it does.
+	resp, err := f.attempt(req, 1)
+	var se *StatusError
+	if offset > 0 && errors.As(err, &se) && se.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// We asked for bytes past the end, so the part file is either
+		// complete, or left from a different version of the file. Only
+		// the checksum can tell.
+		if opts.SHA256 == "" {
+			return 0, fmt.Errorf("%s already has %d bytes and cannot be verified without a checksum, remove it to download again: %w", part, offset, err)
+		}
+		return offset, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+		if start != offset {
+			return 0, fmt.Errorf("server resumed at byte %d instead of %d", start, offset)
+		}
+		total = size
+	default:
+		// The server ignored the Range header and sends the whole file,
+		// so start over.
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		offset = 0
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	}
+
+	pw := newProgressWriter(offset, total, opts)
+	if _, err := io.Copy(io.MultiWriter(file, pw), resp.Body); err != nil {
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+	pw.report(true)
+
+	if total >= 0 && pw.downloaded != total {
+		return 0, fmt.Errorf("download incomplete: got %d of %d bytes: %w", pw.downloaded, total, io.ErrUnexpectedEOF)
+	}
+	return pw.downloaded, nil
+}
+
+// finishDownload verifies the part file and moves it to dest.
+func finishDownload(part, dest string, total int64, opts DownloadOptions) error {
+	if opts.SHA256 != "" {
+		sum, err := hashFile(sha256.New(), part)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, opts.SHA256) {
+			// A corrupt part file would be resumed forever, so remove it.
+			os.Remove(part)
+			return fmt.Errorf("%s: got sha256 %s, want %s: %w", dest, sum, opts.SHA256, ErrChecksumMismatch)
+		}
+	}
+
+	if total >= 0 {
+		info, err := os.Stat(part)
+		if err != nil {
+			return err
+		}
+		if info.Size() != total {
+			return fmt.Errorf("%s: file has %d bytes, want %d", dest, info.Size(), total)
+		}
+	}
+
+	return os.Rename(part, dest)
+}
+
+// hashFile returns the hex-encoded digest of the file at path.
+func hashFile(h hash.Hash, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseContentRange parses a Content-Range header such as
+// "bytes 100-199/1000". It returns the first byte and the total size, which
+// is -1 if the server sent "*".
+func parseContentRange(v string) (start, total int64, err error) {
+	spec, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	rng, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	first, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	if size == "*" {
+		return start, -1, nil
+	}
+	total, err = strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	return start, total, nil
+}
+
+// progressWriter counts the bytes written to it and reports progress.
+type progressWriter struct {
+	opts       DownloadOptions
+	downloaded int64
+	total      int64
+	// resumed is the number of bytes that were already on disk.
+	resumed    int64
+	started    time.Time
+	lastReport time.Time
+}
+
+// newProgressWriter creates a progressWriter for a download that starts at
+// offset.
+func newProgressWriter(offset, total int64, opts DownloadOptions) *progressWriter {
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = 500 * time.Millisecond
+	}
+	return &progressWriter{
+		opts:       opts,
+		downloaded: offset,
+		total:      total,
+		resumed:    offset,
+		started:    time.Now(),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.downloaded += int64(len(p))
+	if time.Since(w.lastReport) >= w.opts.ProgressInterval {
+		w.report(false)
+	}
+	return len(p), nil
+}
+
+// report calls the Progress callback, if there is one.
+func (w *progressWriter) report(done bool) {
+	if w.opts.Progress == nil {
+		return
+	}
+	w.lastReport = time.Now()
+
+	p := Progress{Downloaded: w.downloaded, Total: w.total, Done: done}
+	if elapsed := time.Since(w.started).Seconds(); elapsed > 0 {
+		p.Rate = float64(w.downloaded-w.resumed) / elapsed
+	}
+	if p.Rate > 0 && w.total > 0 && !done {
+		p.ETA = time.Duration(float64(w.total-w.downloaded) / p.Rate * float64(time.Second))
+	}
+	w.opts.Progress(p)
+}
+
+// formatBytes formats n with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
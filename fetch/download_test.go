@@ -0,0 +1,191 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with support for Range requests, and records
+// the Range header of every request.
+func rangeServer(t *testing.T, content []byte) (*httptest.Server, *[]string) {
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	sum := sha256.Sum256(content)
+	srv, ranges := rangeServer(t, content)
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	// An earlier download stopped after 4000 bytes.
+	if err := os.WriteFile(dest+PartSuffix, content[:4000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var last Progress
+	err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, DownloadOptions{
+		SHA256:   hex.EncodeToString(sum[:]),
+		Progress: func(p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=4000-" {
+		t.Errorf("Range headers %q, want [bytes=4000-]", *ranges)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, which differ from the content", len(got))
+	}
+	if _, err := os.Stat(dest + PartSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the part file is still there: %v", err)
+	}
+	if !last.Done || last.Downloaded != int64(len(content)) || last.Total != int64(len(content)) {
+		t.Errorf("last progress %+v", last)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	srv, _ := rangeServer(t, []byte("the real content"))
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, DownloadOptions{
+		SHA256: strings.Repeat("0", 64),
+	})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got error %v, want ErrChecksumMismatch", err)
+	}
+	for _, p := range []string{dest, dest + PartSuffix} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s exists after a checksum mismatch", filepath.Base(p))
+		}
+	}
+}
+
+func TestDownloadServerIgnoresRange(t *testing.T) {
+	content := []byte("complete file")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(dest+PartSuffix, []byte("stale bytes that are longer than the file"), 0644)
+	if err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, DownloadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("got %q, want %q", got, content)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, err := parseContentRange("bytes 100-199/1000")
+	if err != nil || start != 100 || total != 1000 {
+		t.Errorf("got %d, %d, %v", start, total, err)
+	}
+	if _, _, err := parseContentRange("items 1-2/3"); err == nil {
+		t.Error("expected an error for a non-byte range")
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	err := New(WithClient(srv.Client()), WithRetry(fastRetry(4))).Download(context.Background(), srv.URL, dest, DownloadOptions{})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, want the 503", err)
+	}
+	// Every attempt of the policy is one request, not a retried Open.
+	if n := hits.Load(); n != 4 {
+		t.Errorf("%d requests, want 4", n)
+	}
+}
+
+func TestDownloadRetryResumes(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if len(ranges) == 1 {
+			// Break the connection after half of the file.
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:5000])
+			return
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	if err := New(WithClient(srv.Client()), WithRetry(fastRetry(2))).Download(context.Background(), srv.URL, dest, DownloadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ranges, ",") != ",bytes=5000-" {
+		t.Errorf("Range headers %q, want the retry to resume at byte 5000", ranges)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes, which differ from the content", len(got))
+	}
+}
+
+func TestDownloadCompletePart(t *testing.T) {
+	content := []byte("complete file")
+	sum := sha256.Sum256(content)
+	srv, _ := rangeServer(t, content)
+
+	// The part file has as many bytes as the file, so the server answers
+	// 416. Without a checksum, it may be a stale file of the same size.
+	dest := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(dest+PartSuffix, []byte("stale content"), 0644)
+	err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, DownloadOptions{})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("got error %v, want the 416", err)
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the unverified part file was moved into place: %v", err)
+	}
+
+	// With a checksum, a complete part file is accepted, and a stale one
+	// is removed.
+	opts := DownloadOptions{SHA256: hex.EncodeToString(sum[:])}
+	if err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, opts); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got error %v for the stale part, want ErrChecksumMismatch", err)
+	}
+	os.WriteFile(dest+PartSuffix, content, 0644)
+	if err := New(WithClient(srv.Client())).Download(context.Background(), srv.URL, dest, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, content) {
+		t.Errorf("got %q, want %q", got, content)
+	}
+}
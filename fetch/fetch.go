@@ -0,0 +1,318 @@
+// Package fetch provides a small, reusable HTTP fetcher.
+//
+// In contrast to a bare http.Get, a Fetcher:
+// * honours the deadline and cancellation of the passed context
+// * returns errors instead of exiting the program
+// * limits the number of bytes read from a response body
+// * treats non-2xx status codes as errors
+// * adds custom headers to every request
+// * optionally retries failed requests with exponential backoff
+// * optionally stops calling failing hosts through a circuit breaker
+// * optionally caches responses on disk, including an offline mode
+//
+// The underlying *http.Client can be replaced, which makes a Fetcher
+// easy to point at an httptest.Server.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxBodySize is the maximum number of bytes read from a response
+// body when no other limit has been configured (10 MiB).
+const DefaultMaxBodySize int64 = 10 << 20
+
+// DefaultTimeout is the timeout of the default HTTP client. A deadline on
+// the context passed to Get or Do still takes precedence if it is shorter.
+const DefaultTimeout = 30 * time.Second
+
+// ErrBodyTooLarge is returned when a response body exceeds the configured
+// maximum body size.
+var ErrBodyTooLarge = errors.New("response body exceeds maximum size")
+
+// StatusError is returned when a server responds with a status code
+// outside of the 2xx range.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %s", e.Method, e.URL, e.Status)
+}
+
+// Response is a fully read HTTP response.
+type Response struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// FromCache is true if the response was served from a Cache.
+	FromCache bool
+}
+
+// Fetcher performs HTTP requests. The zero value is not usable, create a
+// Fetcher through New.
+type Fetcher struct {
+	client      *http.Client
+	maxBodySize int64
+	header      http.Header
+	retry       RetryPolicy
+	breaker     *Breaker
+	cache       *Cache
+	observe     func(RequestEvent)
+}
+
+// Option configures a Fetcher.
+type Option func(*Fetcher)
+
+// WithClient sets the HTTP client used for all requests.
+func WithClient(c *http.Client) Option {
+	return func(f *Fetcher) {
+		f.client = c
+	}
+}
+
+// WithMaxBodySize limits the number of bytes read from a response body.
+// A value of 0 or less disables the limit.
+func WithMaxBodySize(n int64) Option {
+	return func(f *Fetcher) {
+		f.maxBodySize = n
+	}
+}
+
+// WithHeader adds a header that is sent with every request.
+func WithHeader(key, value string) Option {
+	return func(f *Fetcher) {
+		f.header.Add(key, value)
+	}
+}
+
+// RequestEvent describes a single HTTP round trip, for metrics or logging.
+// Retries are separate round trips, and responses served from the cache
+// without a request are not reported.
+type RequestEvent struct {
+	Method string
+	URL    string
+	Host   string
+	// StatusCode is 0 if the request failed without a response.
+	StatusCode int
+	// Duration is the time until the response header was received.
+	Duration time.Duration
+	// Err is the transport error, if there was no response.
+	Err error
+}
+
+// WithObserver calls fn after every HTTP round trip.
+func WithObserver(fn func(RequestEvent)) Option {
+	return func(f *Fetcher) {
+		f.observe = fn
+	}
+}
+
+// New creates a Fetcher. Without any options, it uses an HTTP client with
+// DefaultTimeout and reads at most DefaultMaxBodySize bytes per response.
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		client:      &http.Client{Timeout: DefaultTimeout},
+		maxBodySize: DefaultMaxBodySize,
+		header:      http.Header{},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Get fetches url and returns the fully read response.
+func (f *Fetcher) Get(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.Do(req)
+}
+
+// Do sends req and returns the fully read response. The context of req
+// controls the lifetime of the whole call, including reading the body.
+// GET requests are served from the cache, if one is configured.
+func (f *Fetcher) Do(req *http.Request) (*Response, error) {
+	if f.cache != nil && req.Method == http.MethodGet {
+		return f.cache.do(f, req)
+	}
+	return f.fetch(req)
+}
+
+// fetch sends req, bypassing the cache, and reads the response body.
+func (f *Fetcher) fetch(req *http.Request) (*Response, error) {
+	resp, err := f.Open(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := f.readBody(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, err)
+	}
+
+	return &Response{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
+
+// Open sends req and returns the raw response for streaming. Non-2xx status
+// codes are returned as a *StatusError. The caller must close the body.
+//
+// If a retry policy is configured, failed attempts are retried with
+// exponential backoff until the policy's attempts are used up or the
+// request's context is done. Requests with a body are only retried if the
+// body can be recreated through req.GetBody.
+func (f *Fetcher) Open(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	attempts := f.retry.attempts()
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		attempts = 1
+	}
+
+	for n := 1; ; n++ {
+		resp, err := f.attempt(req, n)
+		if err == nil {
+			return resp, nil
+		}
+		if n >= attempts || !retryable(ctx, err) {
+			return nil, err
+		}
+
+		d := f.retry.delay(n, err)
+		if f.retry.OnRetry != nil {
+			f.retry.OnRetry(RetryEvent{URL: req.URL.String(), Attempt: n, Err: err, Delay: d})
+		}
+		// Give up if the context ends while waiting, but report the
+		// error of the last attempt, as that is the more useful one.
+		if sleep(ctx, d) != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends attempt number n of req, guarded by the circuit breaker.
+func (f *Fetcher) attempt(req *http.Request, n int) (*http.Response, error) {
+	// Every attempt sends a clone of the request, so adding the
+	// configured headers does not change the caller's request. A request
+	// body can only be read once, so retries get a fresh body.
+	r := req.Clone(req.Context())
+	if n > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+
+	if f.breaker == nil {
+		return f.send(r)
+	}
+
+	host := req.URL.Host
+	if err := f.breaker.Allow(host); err != nil {
+		return nil, err
+	}
+
+	resp, err := f.send(r)
+	switch {
+	case err == nil:
+		f.breaker.Record(host, true)
+	case req.Context().Err() != nil:
+		// The caller gave up, which says nothing about the host.
+		f.breaker.release(host)
+	default:
+		// Client errors (4xx, except 429) mean the host is healthy.
+		var se *StatusError
+		healthy := errors.As(err, &se) && se.StatusCode < 500 && se.StatusCode != http.StatusTooManyRequests
+		f.breaker.Record(host, healthy)
+	}
+	return resp, err
+}
+
+// send performs a single HTTP round trip and checks the status code.
+func (f *Fetcher) send(req *http.Request) (*http.Response, error) {
+	// Add the configured headers, without overwriting headers that
+	// were set on the request itself.
+	for key, values := range f.header {
+		if _, ok := req.Header[key]; ok {
+			continue
+		}
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	if f.observe != nil {
+		e := RequestEvent{Method: req.Method, URL: req.URL.String(), Host: req.URL.Host, Duration: time.Since(start), Err: err}
+		if resp != nil {
+			e.StatusCode = resp.StatusCode
+		}
+		f.observe(e)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Drain a little of the body so the connection can be reused.
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		resp.Body.Close()
+		return nil, &StatusError{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+		}
+	}
+
+	return resp, nil
+}
+
+// readBody reads r up to the configured maximum body size.
+func (f *Fetcher) readBody(r io.Reader) ([]byte, error) {
+	if f.maxBodySize <= 0 {
+		return io.ReadAll(r)
+	}
+
+	// Read one byte more than allowed, so we can tell a body that is
+	// exactly maxBodySize long apart from one that is longer.
+	data, err := io.ReadAll(io.LimitReader(r, f.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+// Preview returns at most n bytes of b as a string. Unlike slicing with
+// b[0:n], it does not panic when b is shorter than n.
+func Preview(b []byte, n int) string {
+	if len(b) < n {
+		n = len(b)
+	}
+	return string(b[:n])
+}
@@ -0,0 +1,136 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetBodySizeLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		limit   int64
+		wantErr error
+	}{
+		{limit: 9, wantErr: ErrBodyTooLarge},
+		// A body of exactly the limit is fine.
+		{limit: 10},
+		{limit: 0},
+	}
+	for _, tt := range tests {
+		f := New(WithClient(srv.Client()), WithMaxBodySize(tt.limit))
+		resp, err := f.Get(context.Background(), srv.URL)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("limit %d: got error %v, want %v", tt.limit, err, tt.wantErr)
+			continue
+		}
+		if err == nil && len(resp.Body) != 10 {
+			t.Errorf("limit %d: got %d bytes, want 10", tt.limit, len(resp.Body))
+		}
+	}
+}
+
+func TestGetStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Reason", "gone")
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := New(WithClient(srv.Client())).Get(context.Background(), srv.URL+"/page")
+	var se *StatusError
+	if !errors.As(err, &se) {
+		t.Fatalf("got error %v, want a *StatusError", err)
+	}
+	if se.StatusCode != http.StatusNotFound || se.Method != http.MethodGet || se.URL != srv.URL+"/page" {
+		t.Errorf("got %+v", se)
+	}
+	if se.Header.Get("X-Reason") != "gone" {
+		t.Errorf("status error does not carry the response header: %v", se.Header)
+	}
+}
+
+func TestHeaderPrecedence(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	f := New(WithClient(srv.Client()), WithHeader("User-Agent", "fetcher"), WithHeader("X-Extra", "a"))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("User-Agent", "request")
+	if _, err := f.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	// Headers set on the request win over the fetcher's headers.
+	if ua := got.Get("User-Agent"); ua != "request" {
+		t.Errorf("User-Agent = %q, want %q", ua, "request")
+	}
+	if x := got.Get("X-Extra"); x != "a" {
+		t.Errorf("X-Extra = %q, want %q", x, "a")
+	}
+}
+
+func TestRequestIsNotChanged(t *testing.T) {
+	var extras []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extras = append(extras, strings.Join(r.Header.Values("X-Extra"), ","))
+	}))
+	defer srv.Close()
+
+	f := New(WithClient(srv.Client()), WithHeader("X-Extra", "a"))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Do(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(req.Header) != 0 {
+		t.Errorf("the request has the headers %v after sending it", req.Header)
+	}
+	// A reused request does not collect the headers of earlier calls.
+	if strings.Join(extras, " ") != "a a" {
+		t.Errorf("X-Extra headers %q, want one per request", extras)
+	}
+}
+
+func TestGetContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(WithClient(srv.Client())).Get(ctx, srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Get returned after %s, it should honour the deadline", d)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if got := Preview([]byte("abc"), 800); got != "abc" {
+		t.Errorf("Preview of a short body = %q", got)
+	}
+	if got := Preview([]byte("abcdef"), 3); got != "abc" {
+		t.Errorf("Preview = %q, want %q", got, "abc")
+	}
+}
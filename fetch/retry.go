@@ -0,0 +1,167 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how often and how fast failed requests are retried.
+//
+// A request is retried when:
+// * the transport returned an error (e.g. connection refused, reset)
+// * the server responded with a 5xx status code
+// * the server responded with 429 Too Many Requests
+//
+// Errors caused by the request's own context are never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 1 are treated as 1, i.e. no retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts, including delays
+	// requested by a Retry-After header.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt (exponential backoff).
+	Multiplier float64
+	// Jitter is the fraction (0 to 1) of the backoff that is randomised,
+	// so that many clients do not retry at exactly the same time.
+	Jitter float64
+	// OnRetry is called before the fetcher sleeps for a retry. It can be
+	// used to log or count retries.
+	OnRetry func(RetryEvent)
+}
+
+// RetryEvent describes a failed attempt that is about to be retried.
+type RetryEvent struct {
+	URL     string
+	Attempt int
+	Err     error
+	Delay   time.Duration
+}
+
+// DefaultRetryPolicy returns a policy with 4 attempts and a backoff that
+// starts at 200ms and doubles up to 5s, with 20% jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// WithRetry enables retries using the given policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(f *Fetcher) {
+		f.retry = p
+	}
+}
+
+// attempts returns the number of attempts allowed by the policy.
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before retry number n (starting at 1).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(n-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+
+	// Remove a random part of the delay, e.g. with a jitter of 0.2
+	// the delay ends up between 80% and 100% of the computed backoff.
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		d -= d * jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+// delay returns how long to wait before retrying after err. A Retry-After
+// header on a status error takes precedence over the computed backoff.
+func (p RetryPolicy) delay(n int, err error) time.Duration {
+	d := p.backoff(n)
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		if ra, ok := parseRetryAfter(se.Header.Get("Retry-After")); ok && ra > d {
+			d = ra
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// retryable reports whether a request that failed with err should be
+// retried.
+func retryable(ctx context.Context, err error) bool {
+	// The caller gave up, so there is no point in trying again.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500 || se.StatusCode == http.StatusTooManyRequests
+	}
+
+	// A body that is too large will be too large next time as well.
+	if errors.Is(err, ErrBodyTooLarge) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	// Everything else is a transport error.
+	return true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done, whichever happens first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
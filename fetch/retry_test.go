@@ -0,0 +1,105 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetry is a retry policy that does not slow down the tests.
+func fastRetry(attempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   []int // status of every attempt, the last one repeats
+		attempts int
+		wantErr  bool
+		wantHits int32
+	}{
+		{name: "recovers after 5xx", status: []int{503, 502, 200}, attempts: 4, wantHits: 3},
+		{name: "429 is retried", status: []int{429, 200}, attempts: 4, wantHits: 2},
+		{name: "gives up", status: []int{500}, attempts: 3, wantErr: true, wantHits: 3},
+		{name: "4xx is not retried", status: []int{404}, attempts: 4, wantErr: true, wantHits: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(hits.Add(1)) - 1
+				w.WriteHeader(tt.status[min(n, len(tt.status)-1)])
+			}))
+			defer srv.Close()
+
+			var retries []RetryEvent
+			policy := fastRetry(tt.attempts)
+			policy.OnRetry = func(e RetryEvent) { retries = append(retries, e) }
+			_, err := New(WithClient(srv.Client()), WithRetry(policy)).Get(context.Background(), srv.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("server got %d requests, want %d", got, tt.wantHits)
+			}
+			if len(retries) != int(tt.wantHits)-1 {
+				t.Errorf("OnRetry was called %d times, want %d", len(retries), tt.wantHits-1)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextEnds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	policy := RetryPolicy{MaxAttempts: 100, InitialBackoff: time.Hour}
+	start := time.Now()
+	_, err := New(WithClient(srv.Client()), WithRetry(policy)).Get(ctx, srv.URL)
+	var se *StatusError
+	// The error of the last attempt is more useful than the context's.
+	if !errors.As(err, &se) {
+		t.Errorf("got error %v, want the *StatusError of the last attempt", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("retry slept for %s after the context ended", d)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("backoff with 50%% jitter = %s, want between 50ms and 100ms", got)
+		}
+	}
+}
+
+func TestDelayRetryAfter(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Second}
+	err := &StatusError{StatusCode: 429, Header: http.Header{"Retry-After": {"3"}}}
+	if got := p.delay(1, err); got != 3*time.Second {
+		t.Errorf("delay with Retry-After: 3 = %s, want 3s", got)
+	}
+	err.Header.Set("Retry-After", "3600")
+	if got := p.delay(1, err); got != 10*time.Second {
+		t.Errorf("delay with a long Retry-After = %s, want MaxBackoff", got)
+	}
+}
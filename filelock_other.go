@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockFile is a no-op on platforms without flock. Writers in the same
+// process are still serialised by the mutex in fileUserStore.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without flock.
+func unlockFile(file *os.File) error {
+	return nil
+}
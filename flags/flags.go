@@ -0,0 +1,284 @@
+// Package flags evaluates feature flags from the features section of
+// config.json, so new code paths can be switched on gradually.
+//
+// Every entry of the features section is a flag:
+//
+//	"features": {
+//	  "enableFeatureX": true,
+//	  "maxItemsToShow": 50,
+//	  "newImport": {"rollout": 25, "users": [1], "names": ["mario"]}
+//	}
+//
+// The value of an entry decides the kind of flag:
+//
+//   - A boolean switches the flag on or off for everybody.
+//   - A number is a tuning knob. It counts as on if it is not zero.
+//   - An object is a rule with the optional fields enabled (default true),
+//     value, rollout (percentage of users, 0-100), users (IDs) and names.
+//
+// A rollout assigns every user to a stable bucket, based on the flag name
+// and the user ID, so a user keeps seeing the same behaviour, and raising
+// the percentage only adds users.
+package flags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Flag is a single feature flag.
+type Flag struct {
+	// Enabled switches the flag off for everybody if false.
+	Enabled bool `json:"enabled"`
+	// Value is the number of numeric flags.
+	Value float64 `json:"value"`
+	// Rollout is the percentage of users the flag is on for.
+	Rollout float64 `json:"rollout"`
+	// Users and Names are always included, independent of the rollout.
+	Users []int    `json:"users"`
+	Names []string `json:"names"`
+}
+
+// Target is the user a flag is evaluated for.
+type Target struct {
+	ID   int
+	Name string
+}
+
+// Set is a set of flags. It is safe for concurrent use, and can be reloaded
+// from its file while it is in use.
+type Set struct {
+	path string
+
+	mu      sync.RWMutex
+	flags   map[string]Flag
+	modTime time.Time
+}
+
+// New creates a Set with fixed flags, e.g. for tests.
+func New(flags map[string]Flag) *Set {
+	return &Set{flags: flags}
+}
+
+// Load reads the flags from the features section of the configuration
+// file at path.
+func Load(path string) (*Set, error) {
+	s := &Set{path: path}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the configuration file again. If the file is invalid, the
+// current flags are kept and the error is returned.
+func (s *Set) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	flags, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the flags whenever the modification time of the file
+// changes, checking every interval until ctx is cancelled. onReload, if not
+// nil, is called after every reload with its error.
+//
+// Polling works on every platform and file system, and flags do not need
+// to change within milliseconds.
+func (s *Set) Watch(ctx context.Context, interval time.Duration, onReload func(error)) {
+	if s.path == "" {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		info, err := os.Stat(s.path)
+		if err != nil {
+			if onReload != nil {
+				onReload(err)
+			}
+			continue
+		}
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.modTime)
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		err = s.Reload()
+		if err != nil {
+			// Remember the broken version, so the error is reported
+			// once and not on every tick.
+			s.mu.Lock()
+			s.modTime = info.ModTime()
+			s.mu.Unlock()
+		}
+		if onReload != nil {
+			onReload(err)
+		}
+	}
+}
+
+// Parse reads the flags from the features section of a configuration.
+func Parse(data []byte) (map[string]Flag, error) {
+	var cfg struct {
+		Features map[string]json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]Flag, len(cfg.Features))
+	for name, raw := range cfg.Features {
+		f, err := parseFlag(raw)
+		if err != nil {
+			return nil, fmt.Errorf("features.%s: %w", name, err)
+		}
+		flags[name] = f
+	}
+	return flags, nil
+}
+
+// parseFlag decodes a boolean, a number or a rule object.
+func parseFlag(raw json.RawMessage) (Flag, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return Flag{Enabled: b, Rollout: 100}, nil
+	}
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return Flag{Enabled: n != 0, Value: n, Rollout: 100}, nil
+	}
+
+	// A rule object is on unless it says otherwise. Without a rollout,
+	// it is on for everybody, unless it targets specific users.
+	var rule struct {
+		Enabled *bool    `json:"enabled"`
+		Value   float64  `json:"value"`
+		Rollout *float64 `json:"rollout"`
+		Users   []int    `json:"users"`
+		Names   []string `json:"names"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		return Flag{}, fmt.Errorf("must be a boolean, a number or a rule object: %w", err)
+	}
+	f := Flag{Enabled: true, Value: rule.Value, Users: rule.Users, Names: rule.Names}
+	if rule.Enabled != nil {
+		f.Enabled = *rule.Enabled
+	}
+	switch {
+	case rule.Rollout != nil:
+		f.Rollout = *rule.Rollout
+	case len(rule.Users) == 0 && len(rule.Names) == 0:
+		f.Rollout = 100
+	}
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return Flag{}, fmt.Errorf("rollout %g is not between 0 and 100", f.Rollout)
+	}
+	return f, nil
+}
+
+// Get returns the flag with the given name.
+func (s *Set) Get(name string) (Flag, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.flags[name]
+	return f, ok
+}
+
+// Names returns the names of all flags, sorted.
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.flags))
+	for name := range s.flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Bool reports whether the flag is on for everybody. Unknown flags are off.
+func (s *Set) Bool(name string) bool {
+	f, ok := s.Get(name)
+	return ok && f.Enabled && f.Rollout >= 100
+}
+
+// Int returns the value of a numeric flag, or def if the flag is unknown.
+func (s *Set) Int(name string, def int) int {
+	f, ok := s.Get(name)
+	if !ok {
+		return def
+	}
+	return int(f.Value)
+}
+
+// Float returns the value of a numeric flag, or def if the flag is unknown.
+func (s *Set) Float(name string, def float64) float64 {
+	f, ok := s.Get(name)
+	if !ok {
+		return def
+	}
+	return f.Value
+}
+
+// EnabledFor reports whether the flag is on for the user t. Unknown flags
+// are off.
+func (s *Set) EnabledFor(name string, t Target) bool {
+	f, ok := s.Get(name)
+	if !ok || !f.Enabled {
+		return false
+	}
+	if slices.Contains(f.Users, t.ID) || slices.Contains(f.Names, t.Name) {
+		return true
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	return float64(bucket(name, t)) < f.Rollout*100
+}
+
+// bucket maps the user to one of 10000 buckets, so rollouts have a
+// resolution of 0.01%. Hashing the flag name as well keeps the same users
+// from being the first to get every new feature.
+func bucket(name string, t Target) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(t.ID)))
+	return h.Sum32() % 10000
+}
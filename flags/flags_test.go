@@ -0,0 +1,272 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFlag(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Flag
+		wantErr string
+	}{
+		{raw: `true`, want: Flag{Enabled: true, Rollout: 100}},
+		{raw: `false`, want: Flag{Rollout: 100}},
+		{raw: `50`, want: Flag{Enabled: true, Value: 50, Rollout: 100}},
+		{raw: `0`, want: Flag{Rollout: 100}},
+		{raw: `2.5`, want: Flag{Enabled: true, Value: 2.5, Rollout: 100}},
+		// A rule is on for everybody unless it says otherwise.
+		{raw: `{}`, want: Flag{Enabled: true, Rollout: 100}},
+		{raw: `{"enabled": false}`, want: Flag{Rollout: 100}},
+		{raw: `{"value": 3}`, want: Flag{Enabled: true, Value: 3, Rollout: 100}},
+		{raw: `{"rollout": 25}`, want: Flag{Enabled: true, Rollout: 25}},
+		{raw: `{"rollout": 0}`, want: Flag{Enabled: true}},
+		// Targeting without a rollout is only on for the targets.
+		{raw: `{"users": [1, 2]}`, want: Flag{Enabled: true, Users: []int{1, 2}}},
+		{raw: `{"names": ["mario"], "rollout": 10}`, want: Flag{Enabled: true, Rollout: 10, Names: []string{"mario"}}},
+		{raw: `{"rolout": 25}`, wantErr: "unknown field"},
+		{raw: `{"rollout": 101}`, wantErr: "between 0 and 100"},
+		{raw: `{"rollout": -1}`, wantErr: "between 0 and 100"},
+		{raw: `{"users": ["mario"]}`, wantErr: "rule object"},
+		{raw: `"on"`, wantErr: "rule object"},
+		{raw: `[1]`, wantErr: "rule object"},
+	}
+	for _, tt := range tests {
+		got, err := parseFlag([]byte(tt.raw))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseFlag(%s): error %v, want %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFlag(%s): %v", tt.raw, err)
+			continue
+		}
+		if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", tt.want) {
+			t.Errorf("parseFlag(%s) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	flags, err := Parse([]byte(`{"appName": "x", "features": {"a": true, "b": 7}}`))
+	if err != nil || len(flags) != 2 || !flags["a"].Enabled || flags["b"].Value != 7 {
+		t.Errorf("Parse = %+v, %v", flags, err)
+	}
+	// The error names the broken flag.
+	if _, err := Parse([]byte(`{"features": {"good": true, "bad": {"rollout": 200}}}`)); err == nil || !strings.Contains(err.Error(), "features.bad") {
+		t.Errorf("got error %v, want one about features.bad", err)
+	}
+	if _, err := Parse([]byte(`{"features": `)); err == nil {
+		t.Error("Parse accepted invalid JSON")
+	}
+}
+
+func TestBucket(t *testing.T) {
+	target := Target{ID: 42, Name: "mario"}
+	if a, b := bucket("flag", target), bucket("flag", target); a != b {
+		t.Errorf("bucket changed from %d to %d", a, b)
+	}
+	// The name is not part of the bucket, so renaming a user keeps it.
+	if bucket("flag", target) != bucket("flag", Target{ID: 42, Name: "luigi"}) {
+		t.Error("the bucket depends on the user name")
+	}
+
+	// Users are spread evenly, and differently for every flag.
+	var quarterA, quarterB, both int
+	for id := 0; id < 10000; id++ {
+		a := bucket("a", Target{ID: id}) < 2500
+		b := bucket("b", Target{ID: id}) < 2500
+		if a {
+			quarterA++
+		}
+		if b {
+			quarterB++
+		}
+		if a && b {
+			both++
+		}
+	}
+	if quarterA < 2300 || quarterA > 2700 || quarterB < 2300 || quarterB > 2700 {
+		t.Errorf("%d and %d of 10000 users in the first quarter, want about 2500", quarterA, quarterB)
+	}
+	// Independent flags share about a quarter of a quarter.
+	if both < 450 || both > 800 {
+		t.Errorf("%d users in the first quarter of both flags, want about 625", both)
+	}
+}
+
+func TestRolloutMonotonic(t *testing.T) {
+	rollouts := []float64{0, 0.5, 10, 25, 50, 99.99, 100}
+	on := make([]int, len(rollouts))
+	for id := 0; id < 2000; id++ {
+		target := Target{ID: id}
+		was := false
+		for i, r := range rollouts {
+			s := New(map[string]Flag{"f": {Enabled: true, Rollout: r}})
+			is := s.EnabledFor("f", target)
+			if was && !is {
+				t.Fatalf("user %d is on at a lower rollout, but off at %g%%", id, r)
+			}
+			if is {
+				on[i]++
+			}
+			was = is
+		}
+	}
+	if on[0] != 0 || on[len(on)-1] != 2000 {
+		t.Errorf("users on per rollout %v, want none at 0%% and all at 100%%", on)
+	}
+	if on[3] < 400 || on[3] > 600 {
+		t.Errorf("%d of 2000 users on at 25%%", on[3])
+	}
+}
+
+func TestEnabledFor(t *testing.T) {
+	s := New(map[string]Flag{
+		"targeted": {Enabled: true, Users: []int{7}, Names: []string{"mario"}},
+		"off":      {Enabled: false, Rollout: 100, Users: []int{7}},
+		"all":      {Enabled: true, Rollout: 100},
+	})
+	tests := []struct {
+		flag   string
+		target Target
+		want   bool
+	}{
+		{"targeted", Target{ID: 7}, true},
+		{"targeted", Target{ID: 8, Name: "mario"}, true},
+		{"targeted", Target{ID: 8, Name: "luigi"}, false},
+		// A disabled flag is off even for its targets.
+		{"off", Target{ID: 7}, false},
+		{"all", Target{ID: 8}, true},
+		{"unknown", Target{ID: 7}, false},
+	}
+	for _, tt := range tests {
+		if got := s.EnabledFor(tt.flag, tt.target); got != tt.want {
+			t.Errorf("EnabledFor(%s, %+v) = %v, want %v", tt.flag, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	flags, err := Parse([]byte(`{"features": {"on": true, "partial": {"rollout": 50}, "max": 50, "ratio": 0.25}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(flags)
+	if !s.Bool("on") || s.Bool("partial") || s.Bool("unknown") {
+		t.Error("Bool is only true for flags that are on for everybody")
+	}
+	if s.Int("max", 10) != 50 || s.Int("unknown", 10) != 10 {
+		t.Errorf("Int returned %d and %d", s.Int("max", 10), s.Int("unknown", 10))
+	}
+	if s.Float("ratio", 1) != 0.25 || s.Float("unknown", 1) != 1 {
+		t.Errorf("Float returned %g and %g", s.Float("ratio", 1), s.Float("unknown", 1))
+	}
+	if got := strings.Join(s.Names(), " "); got != "max on partial ratio" {
+		t.Errorf("Names = %s", got)
+	}
+}
+
+// writeConfig writes a configuration with the given features section and
+// sets its modification time, so Watch notices every write.
+func writeConfig(t *testing.T, path, features string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(`{"features": `+features+`}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	now := time.Now()
+	writeConfig(t, path, `{"max": 1}`, now)
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken file keeps the old flags.
+	writeConfig(t, path, `{"max": {"rollout": 200}}`, now.Add(time.Second))
+	if err := s.Reload(); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Reload of a broken file returned %v", err)
+	}
+	if s.Int("max", 0) != 1 {
+		t.Errorf("max = %d after a failed reload, want the old 1", s.Int("max", 0))
+	}
+
+	writeConfig(t, path, `{"max": 2}`, now.Add(2*time.Second))
+	if err := s.Reload(); err != nil || s.Int("max", 0) != 2 {
+		t.Errorf("Reload = %v, max = %d, want 2", err, s.Int("max", 0))
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	now := time.Now()
+	writeConfig(t, path, `{"max": 1}`, now)
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Watch(ctx, 5*time.Millisecond, func(err error) { reloads <- err })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	next := func() error {
+		t.Helper()
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(2 * time.Second):
+			t.Fatal("no reload")
+			return nil
+		}
+	}
+
+	writeConfig(t, path, `{"max": 2}`, now.Add(time.Second))
+	if err := next(); err != nil || s.Int("max", 0) != 2 {
+		t.Errorf("reload: %v, max = %d, want 2", err, s.Int("max", 0))
+	}
+
+	writeConfig(t, path, `{"max": "two"}`, now.Add(2*time.Second))
+	if err := next(); err == nil {
+		t.Error("the broken file was not reported")
+	}
+	if s.Int("max", 0) != 2 {
+		t.Errorf("max = %d after a broken file, want the old 2", s.Int("max", 0))
+	}
+	// The broken version is reported once, not on every tick.
+	select {
+	case err := <-reloads:
+		t.Errorf("second report of the same file: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeConfig(t, path, `{"max": 3}`, now.Add(3*time.Second))
+	if err := next(); err != nil || s.Int("max", 0) != 3 {
+		t.Errorf("reload after the fix: %v, max = %d, want 3", err, s.Int("max", 0))
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+/**
+* Following a growing file, like `tail -f`.
+*
+* followReader is an io.Reader that does not stop at the end of the file,
+* but waits for more lines to be appended. It checks the file by polling,
+* which works on every platform and file system, and handles the two ways
+* log files are rotated:
+*
+* - The file is renamed and a new file is created at the path: the rest of
+*   the old file is read, then the new file is opened.
+* - The file is truncated (copytruncate): reading starts over at offset 0.
+**/
+
+// followOptions configures a followReader.
+type followOptions struct {
+	// FromStart reads the existing content first. Otherwise, only lines
+	// appended after opening are read.
+	FromStart bool
+	// Interval is how often the file is checked at its end (default
+	// 250ms).
+	Interval time.Duration
+}
+
+// followReader reads a file and the lines appended to it, until its
+// context is cancelled.
+type followReader struct {
+	ctx      context.Context
+	path     string
+	interval time.Duration
+
+	file   *os.File
+	offset int64
+	// next is the new file after a rotation, which is read once the
+	// old file is drained.
+	next *os.File
+	// midLine is true if the data read so far does not end with a line
+	// break. pendingNewline then ends that line before the content of a
+	// new or truncated file is read, so it is not glued to the first line
+	// of the new content.
+	midLine        bool
+	pendingNewline bool
+}
+
+// openFollow opens the file at path for following. Read returns ctx.Err()
+// once ctx is cancelled.
+func openFollow(ctx context.Context, path string, opts followOptions) (*followReader, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 250 * time.Millisecond
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &followReader{ctx: ctx, path: path, interval: opts.Interval, file: file}
+	if !opts.FromStart {
+		if f.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Read implements io.Reader. It blocks until data is available, the
+// context is cancelled or reading fails, and never returns io.EOF.
+func (f *followReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if f.pendingNewline {
+			f.pendingNewline, f.midLine = false, false
+			p[0] = '\n'
+			return 1, nil
+		}
+
+		n, err := f.file.Read(p)
+		if n > 0 {
+			f.offset += int64(n)
+			f.midLine = p[n-1] != '\n'
+			return n, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		// At the end of the file: switch to the new file after a
+		// rotation, start over after a truncation, or wait.
+		if f.next != nil {
+			f.file.Close()
+			f.file, f.next, f.offset = f.next, nil, 0
+			f.pendingNewline = f.midLine
+			continue
+		}
+		if switched, err := f.checkRotation(); err != nil {
+			return 0, err
+		} else if switched {
+			continue
+		}
+
+		select {
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		case <-time.After(f.interval):
+		}
+	}
+}
+
+// checkRotation reports whether the file was rotated or truncated, and
+// prepares reading the new content.
+func (f *followReader) checkRotation() (bool, error) {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Renamed, and the new file is not there yet.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(info, current) {
+		next, err := os.Open(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		slog.Info("Followed file was rotated, opening the new file", "path", f.path)
+		// Lines may have been appended to the old file since the last
+		// read, so read it to the end before switching.
+		f.next = next
+		return true, nil
+	}
+
+	if info.Size() < f.offset {
+		slog.Info("Followed file was truncated, reading from the start", "path", f.path)
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+		f.pendingNewline = f.midLine
+		return true, nil
+	}
+	return false, nil
+}
+
+// Close closes the file.
+func (f *followReader) Close() error {
+	if f.next != nil {
+		f.next.Close()
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// follow opens path for following and returns the lines read from it. The
+// reader is stopped when the test ends.
+func follow(t *testing.T, path string, fromStart bool) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := openFollow(ctx, path, followOptions{FromStart: fromStart, Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string, 100)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		r.Close()
+	})
+	return lines
+}
+
+// expectLines fails the test unless the next lines are want.
+func expectLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("read %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+// appendFile appends s to the file at path.
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "old:1\n")
+
+	lines := follow(t, path, false)
+	appendFile(t, path, "new:2\n")
+	expectLines(t, lines, "new:2")
+	// A line is passed on once it is complete.
+	appendFile(t, path, "new")
+	appendFile(t, path, ":3\n")
+	expectLines(t, lines, "new:3")
+}
+
+func TestFollowFromStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "old:1\n")
+
+	lines := follow(t, path, true)
+	appendFile(t, path, "new:2\n")
+	expectLines(t, lines, "old:1", "new:2")
+}
+
+func TestFollowRename(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "a:1\n")
+	lines := follow(t, path, true)
+	expectLines(t, lines, "a:1")
+
+	// Rotate like logrotate without copytruncate: rename the file, and
+	// create a new one. A writer that still has the old file open appends
+	// to it in between.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path+".1", "b:2\nhalf")
+	appendFile(t, path, "c:3\n")
+	// The rest of the old file comes first, and its unfinished line is
+	// not glued to the first line of the new file.
+	expectLines(t, lines, "b:2", "half", "c:3")
+
+	appendFile(t, path, "d:4\n")
+	expectLines(t, lines, "d:4")
+}
+
+func TestFollowRenameNewFileLate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "a:1\n")
+	lines := follow(t, path, true)
+	expectLines(t, lines, "a:1")
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is at the path for a while.
+	time.Sleep(30 * time.Millisecond)
+	appendFile(t, path, "b:2\n")
+	expectLines(t, lines, "b:2")
+}
+
+func TestFollowTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "first:1\nsecond:2\nunfinished")
+	lines := follow(t, path, true)
+	expectLines(t, lines, "first:1", "second:2")
+
+	// Rotate like logrotate with copytruncate: the content is copied
+	// elsewhere and the file is truncated in place, then written again
+	// by the same writer.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the reader to notice before writing, or the new content
+	// could be longer than what was read and the truncation unnoticeable.
+	time.Sleep(30 * time.Millisecond)
+	appendFile(t, path, "third:3\n")
+	expectLines(t, lines, "unfinished", "third:3")
+
+	appendFile(t, path, "fourth:4\n")
+	expectLines(t, lines, "fourth:4")
+}
+
+func TestFollowCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.log")
+	appendFile(t, path, "a:1\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := openFollow(ctx, path, followOptions{Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read returned %v, want context.Canceled", err)
+	}
+}
+
+func TestFollowMissingFile(t *testing.T) {
+	if _, err := openFollow(context.Background(), filepath.Join(t.TempDir(), "missing"), followOptions{}); err == nil {
+		t.Error("openFollow succeeded for a missing file")
+	}
+}
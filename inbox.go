@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/**
+* Inbox processing.
+*
+* Files dropped into the inbox directory are processed by their extension:
+*
+* .txt, .users   user records, decoded with decodeUsers
+* .csv           CSV records, read with readRecsCSV
+*
+* The result is written to the outbox directory under the same name. The
+* original file is then moved to the done/ directory of the inbox, or to
+* failed/ together with a NAME.error.txt report if it could not be
+* processed. See cmd_inbox.go for the watcher that calls process.
+**/
+
+// inbox processes the files of an inbox directory.
+type inbox struct {
+	dir    string
+	outbox string
+}
+
+// inboxHandlers maps file extensions to the function that processes them.
+// A handler reads src and writes its result to dst.
+var inboxHandlers = map[string]func(ctx context.Context, src, dst string) error{
+	".txt":   processUserFile,
+	".users": processUserFile,
+	".csv":   processCSVFile,
+}
+
+// setup creates the outbox and the done/ and failed/ directories.
+func (b *inbox) setup() error {
+	for _, dir := range []string{b.outbox, filepath.Join(b.dir, "done"), filepath.Join(b.dir, "failed")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process processes a file of the inbox and moves it to done/ or failed/.
+// It returns the error of the processing, after the file has been moved.
+func (b *inbox) process(ctx context.Context, path string) error {
+	// The watcher may report a file again after it has been moved.
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	name := filepath.Base(path)
+	started := time.Now()
+
+	err := b.handle(ctx, path)
+	if err != nil {
+		inboxFilesFailed.Inc()
+		slog.Error("Processing inbox file failed", "file", path, "err", err)
+		dest, moveErr := moveUnique(path, filepath.Join(b.dir, "failed"))
+		if moveErr != nil {
+			return errors.Join(err, moveErr)
+		}
+		report := fmt.Sprintf("File:     %s\nReceived: %s\nFailed:   %s\nError:    %s\n",
+			name, started.Format(time.RFC3339), time.Now().Format(time.RFC3339), err)
+		if werr := os.WriteFile(dest+".error.txt", []byte(report), 0644); werr != nil {
+			return errors.Join(err, werr)
+		}
+		return err
+	}
+
+	inboxFilesDone.Inc()
+	slog.Info("Processed inbox file", "file", path, "outbox", b.outbox, "duration", time.Since(started))
+	_, err = moveUnique(path, filepath.Join(b.dir, "done"))
+	return err
+}
+
+// handle runs the handler for the extension of the file. The result is
+// written under a temporary name and renamed when it is complete, so a
+// program that watches the outbox never sees half of a file.
+func (b *inbox) handle(ctx context.Context, path string) error {
+	name := filepath.Base(path)
+	handler, ok := inboxHandlers[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return fmt.Errorf("unsupported file type %q", filepath.Ext(name))
+	}
+
+	tmp := filepath.Join(b.outbox, "."+name+".tmp")
+	defer os.Remove(tmp)
+	if err := handler(ctx, path, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(b.outbox, name))
+}
+
+// processUserFile writes the users of a user file to dst. Comments are
+// dropped, and an invalid record fails the whole file.
+func processUserFile(ctx context.Context, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := newUserWriter(out, userWriterOptions{Sync: syncClose})
+	var n int
+	for u := range decodeUsers(ctx, in) {
+		if u.err != nil {
+			// Keep reading, so the decoder finishes.
+			if err == nil {
+				err = u.err
+			}
+			continue
+		}
+		if err == nil {
+			err = w.Write(ctx, u)
+			n++
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no user records found")
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// processCSVFile writes the records of a CSV file to dst.
+func processCSVFile(ctx context.Context, src, dst string) error {
+	recs, err := readRecsCSV(src)
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return errors.New("no CSV records found")
+	}
+	return writeCSVWriter(dst, recs)
+}
+
+// moveUnique moves the file at path into dir. If dir already has a file of
+// that name, a timestamp is added to the name, and a counter if that name
+// is taken too, since os.Rename replaces files. It returns the new path.
+func moveUnique(path, dir string) (string, error) {
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if exists(dest) {
+		ext := filepath.Ext(name)
+		stem := fmt.Sprintf("%s-%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102T150405.000"))
+		dest = filepath.Join(dir, stem+ext)
+		for i := 2; exists(dest); i++ {
+			dest = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		}
+	}
+	return dest, os.Rename(path, dest)
+}
+
+// exists reports whether there is a file at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
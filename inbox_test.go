@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestInbox returns an inbox in a temporary directory, with its outbox
+// next to it.
+func newTestInbox(t *testing.T) *inbox {
+	t.Helper()
+	dir := t.TempDir()
+	b := &inbox{dir: filepath.Join(dir, "inbox"), outbox: filepath.Join(dir, "outbox")}
+	if err := b.setup(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// drop writes a file into the inbox and returns its path.
+func (b *inbox) drop(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(b.dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// dirNames returns the names of the files in dir, sorted and separated by
+// spaces.
+func dirNames(t *testing.T, dir string) string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestInboxProcess(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"people.users", "# team\nmario:1\nluigi:2\n", "mario:1\nluigi:2\n"},
+		{"people.txt", "peach:3\n", "peach:3\n"},
+		// The extension is not case sensitive.
+		{"PEOPLE.USERS", "toad:4\n", "toad:4\n"},
+		{"pairs.csv", "a, b\nc,d\n", "a,b\nc,d\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestInbox(t)
+			path := b.drop(t, tt.name, tt.content)
+			if err := b.process(context.Background(), path); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, filepath.Join(b.outbox, tt.name)); got != tt.want {
+				t.Errorf("outbox has %q, want %q", got, tt.want)
+			}
+			if got := dirNames(t, b.outbox); got != tt.name {
+				t.Errorf("outbox has %s", got)
+			}
+			if got := dirNames(t, b.dir); got != "done failed" {
+				t.Errorf("inbox has %s", got)
+			}
+			if got := readFile(t, filepath.Join(b.dir, "done", tt.name)); got != tt.content {
+				t.Errorf("done/%s has %q", tt.name, got)
+			}
+		})
+	}
+}
+
+func TestInboxProcessFails(t *testing.T) {
+	tests := []struct {
+		name, content, wantErr string
+	}{
+		{"bad.users", "mario:1\nluigi\npeach:3\n", "not in the correct format"},
+		{"empty.users", "# nobody\n", "no user records"},
+		{"bad.csv", "a,b\nc\n", "wrong number of fields"},
+		{"report.pdf", "%PDF", `unsupported file type ".pdf"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestInbox(t)
+			path := b.drop(t, tt.name, tt.content)
+			err := b.process(context.Background(), path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			// Nothing is written to the outbox, not even a temporary file.
+			if got := dirNames(t, b.outbox); got != "" {
+				t.Errorf("outbox has %s", got)
+			}
+			failed := filepath.Join(b.dir, "failed")
+			if got := dirNames(t, failed); got != tt.name+" "+tt.name+".error.txt" {
+				t.Errorf("failed/ has %s", got)
+			}
+			if got := readFile(t, filepath.Join(failed, tt.name)); got != tt.content {
+				t.Errorf("failed/%s has %q", tt.name, got)
+			}
+			report := readFile(t, filepath.Join(failed, tt.name+".error.txt"))
+			if !strings.Contains(report, "File:     "+tt.name+"\n") || !strings.Contains(report, tt.wantErr) {
+				t.Errorf("report:\n%s", report)
+			}
+		})
+	}
+}
+
+func TestInboxProcessMissingFile(t *testing.T) {
+	// The watcher may report a file that was already processed.
+	b := newTestInbox(t)
+	if err := b.process(context.Background(), filepath.Join(b.dir, "gone.users")); err != nil {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestInboxProcessSameName(t *testing.T) {
+	b := newTestInbox(t)
+	for i := 0; i < 3; i++ {
+		if err := b.process(context.Background(), b.drop(t, "a.users", "mario:1\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := dirNames(t, filepath.Join(b.dir, "done")); !strings.HasPrefix(got, "a-") || strings.Count(got, " ") != 2 {
+		t.Errorf("done/ has %s, want three files", got)
+	}
+}
+
+func TestMoveUnique(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	var dests []string
+	// Within the same millisecond, the names must still differ.
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(src, "data.csv")
+		if err := os.WriteFile(path, []byte{byte('0' + i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		dest, err := moveUnique(path, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dests = append(dests, dest)
+	}
+
+	if dests[0] != filepath.Join(dir, "data.csv") {
+		t.Errorf("the first file was moved to %s", dests[0])
+	}
+	for i, dest := range dests {
+		if got := readFile(t, dest); got != string(rune('0'+i)) {
+			t.Errorf("%s has %q, want file %d", dest, got, i)
+		}
+		if i > 0 && (!strings.HasPrefix(filepath.Base(dest), "data-") || filepath.Ext(dest) != ".csv") {
+			t.Errorf("file %d was moved to %s", i, dest)
+		}
+	}
+	if got := dirNames(t, dir); strings.Count(got, " ") != 4 {
+		t.Errorf("%s has %s, want five files", dir, got)
+	}
+}
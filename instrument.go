@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go_for_devops/fetch"
+	"go_for_devops/metrics"
+)
+
+/**
+* Metrics.
+*
+* The numbers below are collected in the default metrics registry. The
+* serve subcommand exposes them on GET /metrics, and the -metrics flag
+* writes them to a file (or "-" for stderr) at the end of a run:
+*
+* go run . -metrics - report -print
+**/
+
+// Metrics of decodeUsers.
+var (
+	userLinesRead = metrics.NewCounter("users_lines_read_total", "Lines read from user record streams.")
+	usersDecoded  = metrics.NewCounter("users_decoded_total", "User records decoded successfully.")
+	usersSkipped  = metrics.NewCounter("users_skipped_total", "Comment lines skipped in user record streams.")
+	usersRejected = metrics.NewCounter("users_rejected_total", "User records that could not be decoded.")
+)
+
+// Metrics of userWriter.
+var (
+	usersWritten       = metrics.NewCounter("users_written_total", "User records written by batching writers.")
+	userBatchesWritten = metrics.NewCounter("users_batches_written_total", "Batches of user records written.")
+)
+
+// Metrics of the CSV readers and writers.
+var (
+	csvLinesRead       = metrics.NewCounter("csv_lines_read_total", "Lines read from CSV files.")
+	csvRecordsRead     = metrics.NewCounter("csv_records_read_total", "Valid records read from CSV files.")
+	csvRecordsRejected = metrics.NewCounter("csv_records_rejected_total", "Invalid records found in CSV files.")
+	csvRecordsWritten  = metrics.NewCounter("csv_records_written_total", "Records written to CSV files.")
+)
+
+// Metrics of the inbox, see inbox.go.
+var (
+	inboxFilesDone   = metrics.NewCounter("inbox_files_total", "Files processed from the inbox, by result.", metrics.Labels{"result": "done"})
+	inboxFilesFailed = metrics.NewCounter("inbox_files_total", "Files processed from the inbox, by result.", metrics.Labels{"result": "failed"})
+)
+
+// Metrics of the fetchers, see observeFetch. The request counter has a
+// code label, so it is registered per status code when first seen and
+// then kept in fetchRequests.
+var (
+	fetchDuration = metrics.NewHistogram("fetch_duration_seconds", "Time until the response header of a fetch was received.", nil)
+	fetchRequests sync.Map // code -> *metrics.Counter
+)
+
+// Metrics of the HTTP API server, see instrumentHandler.
+var (
+	httpInFlight = metrics.NewGauge("http_requests_in_flight", "Requests the API server is currently handling.")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds", "Time taken to handle API requests.", nil)
+)
+
+// observeFetch records a round trip of a fetch.Fetcher. Pass it to the
+// fetchers with fetch.WithObserver.
+func observeFetch(e fetch.RequestEvent) {
+	code := "error"
+	if e.Err == nil {
+		code = strconv.Itoa(e.StatusCode)
+	}
+	fetchRequestsCounter(code).Inc()
+	fetchDuration.Observe(e.Duration.Seconds())
+}
+
+// fetchRequestsCounter returns the request counter for a status code.
+// Registering is cheap, but it takes the lock of the registry, which every
+// round trip of every fetcher would otherwise contend for.
+func fetchRequestsCounter(code string) *metrics.Counter {
+	if c, ok := fetchRequests.Load(code); ok {
+		return c.(*metrics.Counter)
+	}
+	c := metrics.NewCounter("fetch_requests_total", "HTTP requests sent by fetchers, by status code.", metrics.Labels{"code": code})
+	fetchRequests.Store(code, c)
+	return c
+}
+
+// instrumentHandler tracks the requests in flight and their duration.
+func instrumentHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		httpDuration.Observe(time.Since(start).Seconds())
+	})
+}
+
+// dumpMetrics writes the metrics to path, or to stderr if path is "-". It
+// does nothing if path is empty.
+func dumpMetrics(path string) {
+	if path == "" {
+		return
+	}
+	if path == "-" {
+		if err := metrics.Default.WriteText(os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, "writing metrics:", err)
+		}
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "writing metrics:", err)
+		return
+	}
+	err = metrics.Default.WriteText(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "writing metrics:", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Package logging sets up structured logging with log/slog from the
+// logging section of config.json.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"go_for_devops/config"
+)
+
+// New creates a logger from the logging configuration:
+//
+//   - Level filters out records below debug, info, warn or error.
+//   - Format selects slog's text or JSON handler.
+//   - File is the log file, which is rotated once it reaches MaxSizeMB.
+//     Without a file, the log is written to stderr.
+//
+// The returned closer closes the log file. It is a no-op for stderr.
+func New(cfg config.Logging) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, fmt.Errorf("invalid log level %q", cfg.Level)
+	}
+
+	var w io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.File != "" {
+		f, err := OpenRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		w.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+	return slog.New(h), w, nil
+}
+
+// nopCloser does not close the wrapped writer, so New never closes stderr.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close implements the io.Closer interface.
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readLog returns the content of a log file, or "-" if it does not exist.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "-"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "app.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Every record is 5 bytes, so each file holds two of them.
+	for _, rec := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := f.Write([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "gggg\n",
+		path + ".1": "eeee\nffff\n",
+		path + ".2": "cccc\ndddd\n",
+		// The oldest records are gone, as only two backups are kept.
+		path + ".3": "-",
+	}
+	for p, w := range want {
+		if got := readLog(t, p); got != w {
+			t.Errorf("%s: %q, want %q", filepath.Base(p), got, w)
+		}
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("12345678"), 0644)
+
+	// The size of the existing file counts towards maxSize.
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("abc"))
+	f.Close()
+	if got := readLog(t, path+".1"); got != "12345678" {
+		t.Errorf("backup %q, want the existing content", got)
+	}
+	if got := readLog(t, path); got != "abc" {
+		t.Errorf("log %q", got)
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, rec := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := f.Write([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readLog(t, path); got != "cccc\n" {
+		t.Errorf("log %q, want the file to start over", got)
+	}
+	if got := readLog(t, path+".1"); got != "-" {
+		t.Errorf("a backup was kept with maxBackups 0: %q", got)
+	}
+}
+
+func TestRotatingFileLargeRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotatingFile(path, 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A record larger than maxSize is written as a whole, and an empty
+	// file is never rotated.
+	big := strings.Repeat("x", 25)
+	f.Write([]byte(big))
+	f.Write([]byte("y"))
+	if got := readLog(t, path+".1"); got != big {
+		t.Errorf("backup %q, want the large record", got)
+	}
+	if got := readLog(t, path+".2"); got != "-" {
+		t.Errorf("an empty file was rotated: %q", got)
+	}
+}
+
+func TestRotatingFileRotationFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// A non-empty directory in the place of the first backup makes the
+	// rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("aaaa\nbbbb\n"))
+	n, err := f.Write([]byte("cccc\n"))
+	if err == nil || !strings.Contains(err.Error(), "rotating log file") {
+		t.Errorf("got error %v, want the rotation error", err)
+	}
+	if n != 5 {
+		t.Errorf("wrote %d bytes, want the record in the current file", n)
+	}
+
+	// Logging goes on in the same file, and rotates once that is possible
+	// again.
+	if _, err := f.Write([]byte("dddd\n")); err == nil {
+		t.Error("the second write should fail to rotate too")
+	}
+	os.RemoveAll(path + ".1")
+	if _, err := f.Write([]byte("eeee\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLog(t, path+".1"); got != "aaaa\nbbbb\ncccc\ndddd\n" {
+		t.Errorf("backup %q", got)
+	}
+	if got := readLog(t, path); got != "eeee\n" {
+		t.Errorf("log %q", got)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go_for_devops/config"
+	"go_for_devops/logging"
+)
+
+// setupLogging makes the logger configured in the logging section of the
+// configuration file the default slog logger, which is also used by the
+// standard log package. If the configuration cannot be used, slog's
+// default (text to stderr, info level) is kept.
+//
+// The returned function closes the log file.
+func setupLogging(path string) func() {
+	cfg, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Logging to stderr, cannot load configuration:", err)
+		return func() {}
+	}
+	logger, closer, err := logging.New(cfg.Logging)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Logging to stderr, cannot set up logging:", err)
+		return func() {}
+	}
+	slog.SetDefault(logger.With("app", cfg.AppName))
+	return func() { closer.Close() }
+}
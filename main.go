@@ -17,12 +17,17 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"go_for_devops/config"
+	"go_for_devops/counter"
+	"go_for_devops/fetch"
+	"go_for_devops/mirror"
+	"go_for_devops/pipeline"
 	"go_for_devops/say"
+	"go_for_devops/walk"
 	"io"
-	"io/fs"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -32,6 +37,34 @@ import (
 )
 
 func main() {
+	// Flags for the examples themselves, e.g. `go run . -offline`, and for
+	// every run, e.g. `go run . -metrics - crawl https://example.com/`.
+	offline := flag.Bool("offline", false, "serve remote pages from the HTTP cache only, without network access")
+	metricsFile := flag.String("metrics", "", `write the collected metrics to this file at the end of the run ("-" for stderr)`)
+	flag.Parse()
+
+	// Run a subcommand (see commands.go) instead of the examples below,
+	// e.g. `go run . crawl https://www.devdungeon.com/`.
+	if flag.NArg() > 0 {
+		code := runCommand(flag.Arg(0), flag.Args()[1:])
+		// os.Exit does not run deferred calls, so dump the metrics first.
+		dumpMetrics(*metricsFile)
+		os.Exit(code)
+	}
+	defer dumpMetrics(*metricsFile)
+
+	// Diagnostics go to the log configured in json_data/config.json,
+	// while the results of the examples are printed to stdout.
+	closeLog := setupLogging(config.DefaultPath)
+	defer closeLog()
+
+	// Remote pages are cached on disk, so repeated runs are fast and
+	// also work without a network connection (see -offline).
+	httpCache, err := newHTTPCache(httpCacheDir, *offline)
+	if err != nil {
+		slog.Error("Creating HTTP cache failed", "dir", httpCacheDir, "err", err)
+	}
+
 	// Declare and instantiate a variable.
 	myvar := "Just a test"
 	_ = myvar
@@ -630,6 +663,36 @@ func main() {
 	sumWg.Wait()
 	fmt.Println("Final sum: ", mySum.get())
 
+	// Pipelines.
+	// Goroutines connected by channels form a pipeline: every stage receives
+	// values from the previous stage, works on them and sends the results on.
+	// The pipeline package does the plumbing (goroutines, channels, closing
+	// the channels, cancelling on the first error), so only the work of
+	// each stage has to be written. This pipeline squares the numbers with
+	// 4 workers (fan-out), keeps the even squares and adds them up in
+	// batches of 10.
+	squares := pipeline.New(context.Background(), "squares")
+	numbers := pipeline.FromSlice(squares, "numbers", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19})
+	squared := pipeline.Map(numbers, "square", func(_ context.Context, n int) (int, error) {
+		return n * n, nil
+	}, pipeline.Workers(4))
+	even := pipeline.Filter(squared, "even", func(n int) bool { return n%2 == 0 })
+	batches := pipeline.Batch(even, "batch", 10, 10*time.Millisecond)
+	pipelineSum := &sum{}
+	pipeline.Sink(batches, "sum", func(_ context.Context, batch []int) error {
+		for _, n := range batch {
+			pipelineSum.add(n)
+		}
+		return nil
+	})
+	if err := squares.Wait(); err != nil {
+		slog.Error("Pipeline failed", "err", err)
+	}
+	fmt.Println("Sum of the even squares below 400:", pipelineSum.get())
+	for _, st := range squares.Stats() {
+		fmt.Printf("  stage %-8s in: %2d, out: %2d\n", st.Stage, st.In, st.Out)
+	}
+
 	/**
 	*
 	*
@@ -657,14 +720,20 @@ func main() {
 	//
 	// A context can be canceled by calling the cancel function or with a timeout.
 	// When a context is canceled, all child contexts are also canceled.
+	//
+	// The fetcher passes the context on to the HTTP request, so the request
+	// is aborted once the 50 milliseconds have passed.
 	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
-	gatherDataResponse, gatherDataErr := GatherData(ctx, "https://www.devdungeon.com/content/web-scraping-go")
+	fetcher := fetch.New(fetch.WithCache(httpCache), fetch.WithObserver(observeFetch))
+	gatherDataResponse, gatherDataErr := fetcher.Get(ctx, "https://www.devdungeon.com/content/web-scraping-go")
 	cancel()
 	if gatherDataErr != nil {
-		fmt.Println("Error gathering data:", gatherDataErr)
+		slog.Error("Gathering data failed", "err", gatherDataErr)
+	} else {
+		// Display the first 800 characters of the data.
+		// fetch.Preview does not panic if the body is shorter than that.
+		fmt.Printf("Data gathered (first 800 chars): %s... \n", fetch.Preview(gatherDataResponse.Body, 800))
 	}
-	// Display the first 800 characters of the data.
-	fmt.Printf("Data gathered (first 100 chars): %s... \n", gatherDataResponse[0:800])
 
 	// Exampole: Use Context to pass a value through a chain of function calls ("call chain")
 	//
@@ -727,23 +796,33 @@ func main() {
 	}
 
 	// Reading remote files.
-	remoteClient := &http.Client{}
-	remoteReq, err := http.NewRequest("GET", "https://www.devdungeon.com/content/web-scraping-go", nil)
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-	}
-	remoteResp, err := remoteClient.Do(remoteReq)
-	if err != nil {
-		fmt.Println("Error making request:", err)
-	}
-	// remoteResp contains an io.ReaderCloser that we can read as a file.
-	// Let's use io.ReadAll to read the entier content to data.
-	remoteData, err := io.ReadAll(remoteResp.Body)
+	//
+	// Remote servers can fail temporarily, so the fetcher retries failed
+	// requests (network errors, 5xx and 429 responses) with exponential
+	// backoff. A circuit breaker stops calling a host that keeps failing.
+	retryPolicy := fetch.DefaultRetryPolicy()
+	retryPolicy.OnRetry = func(e fetch.RetryEvent) {
+		slog.Warn("Request failed, retrying", "url", e.URL, "attempt", e.Attempt, "err", e.Err, "delay", e.Delay)
+	}
+	remoteFetcher := fetch.New(
+		fetch.WithCache(httpCache),
+		fetch.WithRetry(retryPolicy),
+		fetch.WithObserver(observeFetch),
+		fetch.WithBreaker(fetch.NewBreaker(fetch.BreakerConfig{
+			OnStateChange: func(host string, from, to fetch.State) {
+				slog.Warn("Circuit breaker changed state", "host", host, "from", from, "to", to)
+			},
+		})),
+	)
+	var remoteData []byte
+	remoteResp, err := remoteFetcher.Get(context.Background(), "https://www.devdungeon.com/content/web-scraping-go")
 	if err != nil {
-		fmt.Println("Error reading remote data:", err)
+		slog.Error("Fetching remote data failed", "err", err)
+	} else {
+		// The fetcher has already read the entire response body into a slice of bytes.
+		remoteData = remoteResp.Body
+		fmt.Printf("Remote data: %s...\n", fetch.Preview(remoteData, 850))
 	}
-	remoteResp.Body.Close()
-	fmt.Printf("Remote data: %s...\n", string(remoteData[0:850]))
 
 	// Writing remote content to local file using os.OpenFile.
 	// Define several flags for how to interact with a file.
@@ -752,26 +831,33 @@ func main() {
 	// os.O_WRONLY: Open the file for writing only.
 	// os.O_TRUNC: Truncate the file to 0 bytes.
 	localFileFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
-	localFile, err := os.OpenFile("remoteData.html", localFileFlags, 0644)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-	}
-	defer localFile.Close()
-	// In Go, when you read the contents of an HTTP response body
-	// using io.ReadAll (or any reader function that consumes the body),
-	// you're reading from a stream. Once you read the stream to its end,
-	// there's no more data to read, and the stream does not automatically
-	// reset to the beginning. This means if you try to read from the same
-	// response body a second time with io.ReadAll, you won't get the data again;
-	// instead, you'll get an empty result because the stream is already at the end.
-	//
-	// Workaround: If you need to read the response body more than once,
-	// you will need to read it into a buffer and then work with that buffer
-	// multiple times, like so:
-	newReader := bytes.NewReader(remoteData)
-	// Write the remote data to the local file.
-	if _, err := io.Copy(localFile, newReader); err != nil {
-		fmt.Println("Error writing remote data to loca file: ", err)
+	// Only overwrite the local copy if the remote data could be fetched.
+	if remoteData != nil {
+		localFile, err := os.OpenFile("remoteData.html", localFileFlags, 0644)
+		if err != nil {
+			slog.Error("Opening file failed", "file", "remoteData.html", "err", err)
+		}
+		defer localFile.Close()
+		// In Go, when you read the contents of an HTTP response body
+		// using io.ReadAll (or any reader function that consumes the body),
+		// you're reading from a stream. Once you read the stream to its end,
+		// there's no more data to read, and the stream does not automatically
+		// reset to the beginning. This means if you try to read from the same
+		// response body a second time with io.ReadAll, you won't get the data again;
+		// instead, you'll get an empty result because the stream is already at the end.
+		//
+		// Workaround: If you need to read the response body more than once,
+		// you will need to read it into a buffer and then work with that buffer
+		// multiple times, like so:
+		newReader := bytes.NewReader(remoteData)
+		// Write the remote data to the local file.
+		//
+		// This keeps the whole page in memory, which is fine for a web page.
+		// Large files should be streamed straight to disk instead, see the
+		// download subcommand (`go run . download URL`) and fetch.Download.
+		if _, err := io.Copy(localFile, newReader); err != nil {
+			slog.Error("Writing remote data to local file failed", "file", "remoteData.html", "err", err)
+		}
 	}
 
 	// Using stdin/stdou/sterr: They are just files!
@@ -789,7 +875,7 @@ func main() {
 	// Reading data out of a stream: User records.
 	userFile, err := os.Open("users_source.txt")
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		slog.Error("Opening file failed", "file", "users_source.txt", "err", err)
 	}
 	defer userFile.Close()
 	// The return value of `decodeUsers` is a channel.
@@ -800,7 +886,7 @@ func main() {
 	fmt.Println("Decoding users from file:")
 	for user := range decodeUsers(context.Background(), userFile) {
 		if user.err != nil {
-			fmt.Println("Error decoding user:", user.err)
+			slog.Error("Decoding user failed", "err", user.err)
 			continue
 		}
 		fmt.Println(user)
@@ -809,7 +895,7 @@ func main() {
 	// We can write data into a stream (a file), using the user list as a source.
 	userTargetFile, err := os.OpenFile("users_processed.txt", localFileFlags, 0644)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		slog.Error("Opening file failed", "file", "users_processed.txt", "err", err)
 	}
 	defer userTargetFile.Close()
 
@@ -821,13 +907,26 @@ func main() {
 	// @see https://chat.openai.com/share/bae4fda7-314b-4aa2-b98e-233b87b0f3be for details.
 	_, err = userFile.Seek(0, 0)
 	if err != nil {
-		fmt.Println("Error seeking file:", err)
+		slog.Error("Seeking file failed", "file", "users_source.txt", "err", err)
 	}
+	//
+	// Writing every user with its own Write call means a system call per
+	// user. A userWriter collects the users and writes them in batches
+	// instead, and syncs the file to the disk when it is closed.
+	userWriter := newUserWriter(userTargetFile, userWriterOptions{Sync: syncClose})
 	for u := range decodeUsers(context.Background(), userFile) {
-		if err := writeUser(context.Background(), userTargetFile, u); err != nil {
-			fmt.Println("Error writing user:", err)
+		if u.err != nil {
+			slog.Error("Decoding user failed", "err", u.err)
+			continue
+		}
+		if err := userWriter.Write(context.Background(), u); err != nil {
+			slog.Error("Writing user failed", "err", err)
+			break
 		}
 	}
+	if err := userWriter.Close(); err != nil {
+		slog.Error("Writing users failed", "file", "users_processed.txt", "err", err)
+	}
 
 	// Os-agnostic pathing.
 	// Print out all OS types and hardware architecture supported by go:
@@ -892,8 +991,10 @@ func main() {
 
 	// Create a new file in the temporary directory.
 	tmpPath := filepath.Join(os.TempDir(), filename)
-	// Open the temporary file.
-	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY, 0644)
+	// Open the temporary file. O_TRUNC empties the file if it already
+	// exists; without it, a longer old file would keep its stale bytes after
+	// the end of the copy.
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		fmt.Println("Could not open a new temporary file", err)
 	}
@@ -913,6 +1014,17 @@ func main() {
 	fmt.Printf("Temporary file - size: %d bytes\n", tmpFileInfo.Size())
 	fmt.Printf("Temporary file - modified time: %s\n", tmpFileInfo.ModTime())
 
+	// io.Copy only copies the content: the copy has the mode passed to
+	// OpenFile, and the current time as modification time. mirror.CopyFile
+	// also keeps the permissions and the modification time, and writes to
+	// a temporary file first, so an interrupted copy never leaves half a
+	// file behind. See mirror/mirror.go and the sync subcommand.
+	if err := mirror.CopyFile(sourceFilePath, tmpPath); err != nil {
+		fmt.Println("Error copying file", err)
+	} else if tmpFileInfo, err = os.Stat(tmpPath); err == nil {
+		fmt.Printf("Copy with metadata - modified time: %s\n", tmpFileInfo.ModTime())
+	}
+
 	// Using files embedded in the binary through the `embed` package, see `embed.go`
 	fmt.Printf("Embedded users source file:\n %s\n", userSource)
 	embeddedConfig, err := modulesFs.ReadFile("json_data/config.json")
@@ -923,40 +1035,23 @@ func main() {
 
 	// Walking any filesystem using the io/fs package (in this case it's an embedded one)
 	// The io/fs package provides an interface for reading files from a filesystem.
-	err = fs.WalkDir(
-		modulesFs,
-		".",
-		func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			if !d.IsDir() && filepath.Ext(path) == ".json" {
-				fmt.Println("JSON file:", path)
-			}
-
-			return nil
-		},
-	)
+	// walk.Walk builds on fs.WalkDir and adds filters such as glob patterns,
+	// see walk/walk.go and the walk subcommand.
+	err = walk.Walk(modulesFs, ".", walk.Options{Include: []string{"*.json"}}, func(e walk.Entry) error {
+		fmt.Println("JSON file:", e.Path)
+		return nil
+	})
 	if err != nil {
 		fmt.Println("Error walking directory:", err)
 	}
 
-	// Walk the filesystem of this module.
+	// Walk the filesystem of this module. MaxDepth 1 stays in the top
+	// directory, and ".*" skips hidden files and directories.
 	fmt.Println("Module files, excluding subdirectories")
-	err = fs.WalkDir(
-		os.DirFS("."),
-		".",
-		func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			// Exclude hidden files, directories, and files in subdirectories.
-			if !strings.HasPrefix(path, ".") && !d.IsDir() && !strings.Contains(path, string(os.PathSeparator)) {
-				fmt.Println("Regular file (not hidden, directory, file in subdir):", path)
-			}
-			return nil
-		},
-	)
+	err = walk.Walk(os.DirFS("."), ".", walk.Options{MaxDepth: 1, Exclude: []string{".*"}}, func(e walk.Entry) error {
+		fmt.Println("Regular file (not hidden, directory, file in subdir):", e.Path)
+		return nil
+	})
 	if err != nil {
 		fmt.Println("Error walking directory:", err)
 	}
@@ -971,7 +1066,7 @@ func main() {
 	csvOutfile := "csv_data/names_sorted.csv"
 	csvRecs, err := readRecs(csvInfile, true)
 	if err != nil {
-		fmt.Println("Error reading CSV records:", err)
+		slog.Error("Reading CSV records failed", "file", csvInfile, "err", err)
 	}
 	fmt.Println("CSV records (last, first):")
 	for _, rec := range csvRecs {
@@ -981,7 +1076,7 @@ func main() {
 	// Read byte records.
 	csvByteRecs, err := readRecsBytes(csvInfile, true)
 	if err != nil {
-		fmt.Println("Error reading CSV byte records:", err)
+		slog.Error("Reading CSV byte records failed", "file", csvInfile, "err", err)
 	}
 	fmt.Println("CVS records again, but read by a bufio scanner (first, last):")
 	for _, rec := range csvByteRecs {
@@ -989,23 +1084,35 @@ func main() {
 	}
 
 	// Write the slice of records sorted to a new outfile.
-	writeRecs(csvOutfile, csvByteRecs)
+	if err := writeRecs(csvOutfile, csvByteRecs); err != nil {
+		slog.Error("Writing CSV records failed", "file", csvOutfile, "err", err)
+	}
 
 	// Read records using the encoding/csv package.
 	csvRecsEncoding, err := readRecsCSV(csvInfile)
 	if err != nil {
-		fmt.Println("Error reading CSV records with encoding/csv:", err)
+		slog.Error("Reading CSV records with encoding/csv failed", "file", csvInfile, "err", err)
 	}
 	fmt.Println("CSV records using encoding/csv (first, last):")
 	for _, rec := range csvRecsEncoding {
 		fmt.Printf("%s %s\n", rec.first(), rec.last())
 	}
 
+	// Count the records per initial of the last name. A CounterMap is
+	// safe to update from multiple goroutines, like the sum type above,
+	// but keeps one total per key.
+	var initials counter.CounterMap[string, int]
+	for _, rec := range csvRecsEncoding {
+		if rec.last() != "" {
+			initials.Inc(strings.ToUpper(rec.last()[:1]))
+		}
+	}
+	fmt.Println("CSV records per initial of the last name:", initials.Snapshot())
+
 	// Write the slice of recrds to a new outfile.
 	csvOutfileWriter := "csv_data/names_writer.csv"
-	writeCSVWriter(csvOutfileWriter, csvRecsEncoding)
-	if err != nil {
-		fmt.Println("Error writing CSV records with encoding/csv:", err)
+	if err := writeCSVWriter(csvOutfileWriter, csvRecsEncoding); err != nil {
+		slog.Error("Writing CSV records with encoding/csv failed", "file", csvOutfileWriter, "err", err)
 	}
 }
 
@@ -1094,28 +1201,6 @@ func printStuff() (value string) {
 	return ""
 }
 
-/**
- * Example function to make a web request and return the response.
- */
-func GatherData(ctx context.Context, url string) (string, error) {
-	// Make an HTTP GET request.
-	response, err := http.Get(url)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Close the response body once the function completes.
-	defer response.Body.Close()
-
-	// Copy data from the response body to a byte slice.
-	data, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(data), nil
-}
-
 /**
  * Define a custom string type for a context.
  */
@@ -0,0 +1,352 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text format, e.g. on a /metrics endpoint or in a file
+// at the end of a CLI run.
+//
+// Metrics are registered once, usually in package-level variables, and are
+// safe for concurrent use:
+//
+//	var linesRead = metrics.NewCounter("users_lines_read_total", "Lines read from user files.")
+//
+//	linesRead.Inc()
+//
+// A metric name can be registered several times with different labels,
+// e.g. fetch_requests_total{code="200"} and fetch_requests_total{code="404"}.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go_for_devops/counter"
+)
+
+// Labels are the label names and values of a metric.
+type Labels map[string]string
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric // by name and labels
+	kinds   map[string]string // metric type by name
+}
+
+// Default is the registry used by the package-level constructors.
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}, kinds: map[string]string{}}
+}
+
+// metric is implemented by Counter, Gauge and Histogram.
+type metric interface {
+	desc() *desc
+	// write writes the samples of the metric.
+	write(w io.Writer)
+}
+
+// desc describes a metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string // counter, gauge or histogram
+	labels string // formatted, e.g. {code="200"}, or empty
+	// lbls are the labels as given, for histograms to add le.
+	lbls Labels
+}
+
+// register adds m to the registry. If a metric with the same name and
+// labels exists, that metric is returned instead, so registering twice is
+// harmless. Registering a name with a different type panics, because it is
+// a programming error.
+func (r *Registry) register(m metric) metric {
+	d := m.desc()
+	key := d.name + d.labels
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if kind, ok := r.kinds[d.name]; ok && kind != d.kind {
+		panic(fmt.Sprintf("metrics: %s registered as %s and %s", d.name, kind, d.kind))
+	}
+	r.kinds[d.name] = d.kind
+	if existing, ok := r.metrics[key]; ok {
+		return existing
+	}
+	r.metrics[key] = m
+	return m
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format,
+// sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	ms := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		ms = append(ms, m)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(ms, func(i, j int) bool {
+		a, b := ms[i].desc(), ms[j].desc()
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		return a.labels < b.labels
+	})
+
+	// Remember the first write error, so the metric types do not need
+	// to check every write.
+	ew := &errWriter{w: w}
+	var last string
+	for _, m := range ms {
+		d := m.desc()
+		if d.name != last {
+			fmt.Fprintf(ew, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+			fmt.Fprintf(ew, "# TYPE %s %s\n", d.name, d.kind)
+			last = d.name
+		}
+		m.write(ew)
+	}
+	return ew.err
+}
+
+// Handler returns an HTTP handler that serves the metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// Counter is a value that only goes up, e.g. the number of lines read.
+type Counter struct {
+	d desc
+	v counter.AtomicFloat
+}
+
+// NewCounter registers a counter in the Default registry.
+func NewCounter(name, help string, labels ...Labels) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter.
+func (r *Registry) NewCounter(name, help string, labels ...Labels) *Counter {
+	return r.register(&Counter{d: newDesc(name, help, "counter", labels)}).(*Counter)
+}
+
+// Inc adds 1.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add adds n, which must not be negative.
+func (c *Counter) Add(n float64) {
+	if n < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(n)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 {
+	return c.v.Value()
+}
+
+func (c *Counter) desc() *desc { return &c.d }
+
+func (c *Counter) write(w io.Writer) {
+	fmt.Fprintf(w, "%s%s %s\n", c.d.name, c.d.labels, formatFloat(c.v.Value()))
+}
+
+// Gauge is a value that can go up and down, e.g. the number of running
+// workers.
+type Gauge struct {
+	d  desc
+	mu sync.Mutex
+	v  float64
+}
+
+// NewGauge registers a gauge in the Default registry.
+func NewGauge(name, help string, labels ...Labels) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string, labels ...Labels) *Gauge {
+	return r.register(&Gauge{d: newDesc(name, help, "gauge", labels)}).(*Gauge)
+}
+
+// Set sets the value.
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.v = v
+}
+
+// Add adds n, which may be negative.
+func (g *Gauge) Add(n float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.v += n
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.v
+}
+
+func (g *Gauge) desc() *desc { return &g.d }
+
+func (g *Gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "%s%s %s\n", g.d.name, g.d.labels, formatFloat(g.Value()))
+}
+
+// DefaultBuckets are the histogram buckets for latencies in seconds, from
+// 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations, e.g. request latencies, in buckets.
+type Histogram struct {
+	d       desc
+	buckets []float64
+	counts  []counter.AtomicInt // one per bucket, not cumulative
+	sum     counter.AtomicFloat
+	count   counter.AtomicInt
+}
+
+// NewHistogram registers a histogram in the Default registry. If buckets
+// is nil, DefaultBuckets are used.
+func NewHistogram(name, help string, buckets []float64, labels ...Labels) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram. If buckets is nil, DefaultBuckets
+// are used.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...Labels) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{
+		d:       newDesc(name, help, "histogram", labels),
+		buckets: buckets,
+		counts:  make([]counter.AtomicInt, len(buckets)),
+	}
+	return r.register(h).(*Histogram)
+}
+
+// Observe records the value v.
+func (h *Histogram) Observe(v float64) {
+	// Values above the largest bucket are only counted in +Inf, which
+	// is the total count.
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i].Inc()
+	}
+	h.sum.Add(v)
+	h.count.Inc()
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() int64 {
+	return h.count.Value()
+}
+
+func (h *Histogram) desc() *desc { return &h.d }
+
+func (h *Histogram) write(w io.Writer) {
+	// Prometheus buckets are cumulative: le="0.1" counts all values
+	// up to 0.1, including those in smaller buckets.
+	var cum int64
+	for i, upper := range h.buckets {
+		cum += h.counts[i].Value()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, formatLabels(h.d.lbls, "le", formatFloat(upper)), cum)
+	}
+	count := h.count.Value()
+	fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, formatLabels(h.d.lbls, "le", "+Inf"), count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", h.d.name, h.d.labels, formatFloat(h.sum.Value()))
+	fmt.Fprintf(w, "%s_count%s %d\n", h.d.name, h.d.labels, count)
+}
+
+// newDesc creates the description of a metric. Only the first Labels
+// argument is used; it is variadic to make labels optional.
+func newDesc(name, help, kind string, labels []Labels) desc {
+	d := desc{name: name, help: help, kind: kind}
+	if len(labels) > 0 {
+		d.lbls = labels[0]
+		d.labels = formatLabels(d.lbls, "", "")
+	}
+	return d
+}
+
+// formatLabels formats labels as {a="1",b="2"}, sorted by name, with an
+// optional extra label appended.
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, name, escapeLabel(labels[name])))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabel escapes backslashes, quotes and line breaks in label values.
+// Unlike %q, it keeps non-ASCII characters, which Prometheus expects as
+// UTF-8.
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeHelp escapes backslashes and line breaks in help texts.
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// formatFloat formats a sample value.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// errWriter remembers the first write error.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.err = err
+	return n, err
+}
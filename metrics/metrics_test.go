@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	a := r.NewCounter("requests_total", "Requests.", Labels{"code": "200"})
+	b := r.NewCounter("requests_total", "Requests.", Labels{"code": "200"})
+	c := r.NewCounter("requests_total", "Requests.", Labels{"code": "404"})
+	if a != b {
+		t.Error("registering the same name and labels twice gave two counters")
+	}
+	if a == c {
+		t.Error("different labels gave the same counter")
+	}
+}
+
+func TestRegisterKindConflict(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("jobs", "Jobs.", Labels{"queue": "a"})
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a counter name as a gauge did not panic")
+		}
+	}()
+	// The labels differ, but the name is taken by a counter.
+	r.NewGauge("jobs", "Jobs.", Labels{"queue": "b"})
+}
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Requests\nsent.", Labels{"code": "404"}).Add(2)
+	r.NewCounter("requests_total", "Requests\nsent.", Labels{"code": "200"}).Inc()
+	r.NewGauge("workers", "Running workers.").Set(3)
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1})
+	for _, v := range []float64{0.05, 0.5, 5} {
+		h.Observe(v)
+	}
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP requests_total Requests\nsent.
+# TYPE requests_total counter
+requests_total{code="200"} 1
+requests_total{code="404"} 2
+# HELP workers Running workers.
+# TYPE workers gauge
+workers 3
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// BenchmarkRegister measures registering an existing metric, which is what
+// code does that looks up a labelled counter per event. It must not depend
+// on the number of metrics in the registry.
+func BenchmarkRegister(b *testing.B) {
+	r := NewRegistry()
+	for i := 0; i < 1000; i++ {
+		r.NewCounter("other_total", "Other.", Labels{"n": strconv.Itoa(i)})
+	}
+	labels := Labels{"code": "200"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.NewCounter("requests_total", "Requests.", labels)
+	}
+}
@@ -0,0 +1,404 @@
+// Package mirror copies a directory tree to another directory, like a
+// simple rsync. Files that are already up to date are skipped, so syncing
+// the same trees again only copies what changed:
+//
+//	stats, err := mirror.Sync(ctx, "csv_data", "/backup/csv_data", mirror.Options{
+//		Delete: true,
+//		Verify: true,
+//	})
+//
+// Every file is copied to a temporary file next to its destination and
+// renamed when it is complete, so an interrupted sync never leaves half a
+// file behind. The copies keep the permissions and the modification time of
+// the source files.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go_for_devops/walk"
+)
+
+// Options configures Sync.
+type Options struct {
+	// Walk selects the files to copy. Only regular files are copied,
+	// symbolic links and other special files are skipped.
+	Walk walk.Options
+	// Checksum compares the content of files that have the same size,
+	// instead of their modification time. It is slower, since both files
+	// are read, but also finds changes that kept the modification time.
+	Checksum bool
+	// Delete removes the files in the destination that are not in the
+	// source. Files that Walk excludes are kept, like with rsync.
+	Delete bool
+	// DryRun reports what would be done, without changing anything.
+	DryRun bool
+	// Verify compares the SHA-256 digest of every source file and its
+	// copy after the sync.
+	Verify bool
+	// OnAction is called for every file that is copied, updated or deleted.
+	OnAction func(Action)
+}
+
+// Op is the operation of an Action.
+type Op int
+
+const (
+	// Copy copies a file that is missing in the destination.
+	Copy Op = iota
+	// Update replaces a file that differs from the source.
+	Update
+	// Touch only fixes the mode or modification time of a file with the
+	// same content.
+	Touch
+	// Delete removes a file that is not in the source.
+	Delete
+
+	// upToDate is returned by compare for files that need no change.
+	upToDate Op = -1
+)
+
+func (op Op) String() string {
+	switch op {
+	case Copy:
+		return "copy"
+	case Update:
+		return "update"
+	case Touch:
+		return "touch"
+	case Delete:
+		return "delete"
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Action is a change made by Sync. Path is relative to the source and
+// destination directories.
+type Action struct {
+	Op   Op
+	Path string
+	Size int64
+}
+
+// Stats sums up a sync.
+type Stats struct {
+	Copied, Updated, Touched, Deleted, Unchanged int
+	// Bytes is the number of bytes copied.
+	Bytes int64
+}
+
+// ErrMismatch is returned by the verification of Sync if a copy differs
+// from its source.
+var ErrMismatch = errors.New("copy differs from source")
+
+// Sync copies the files of the directory src into dst, which is created if
+// it does not exist. src and dst must not contain each other: the copies
+// would end up in the source, or Delete would remove the source.
+func Sync(ctx context.Context, src, dst string, opts Options) (Stats, error) {
+	var stats Stats
+	if inside(dst, src) {
+		return stats, fmt.Errorf("destination %s is inside the source %s", dst, src)
+	}
+	if inside(src, dst) {
+		return stats, fmt.Errorf("source %s is inside the destination %s", src, dst)
+	}
+
+	// List the source before copying anything, so the list is not
+	// affected by the copies.
+	var files []walk.Entry
+	err := walk.Walk(os.DirFS(src), ".", opts.Walk, func(e walk.Entry) error {
+		if e.Mode.IsRegular() {
+			files = append(files, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	report := func(op Op, path string, size int64) {
+		if opts.OnAction != nil {
+			opts.OnAction(Action{Op: op, Path: path, Size: size})
+		}
+	}
+
+	for _, e := range files {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		from := filepath.Join(src, filepath.FromSlash(e.Path))
+		to := filepath.Join(dst, filepath.FromSlash(e.Path))
+
+		op, err := compare(from, to, e, opts.Checksum)
+		if err != nil {
+			return stats, err
+		}
+		switch op {
+		case upToDate:
+			stats.Unchanged++
+			continue
+		case Copy:
+			stats.Copied++
+		case Update:
+			stats.Updated++
+		case Touch:
+			stats.Touched++
+		}
+		report(op, e.Path, e.Size)
+		if opts.DryRun {
+			continue
+		}
+		if op == Touch {
+			err = setMeta(to, e.Mode, e.ModTime)
+		} else {
+			err = CopyFile(from, to)
+			stats.Bytes += e.Size
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	if opts.Delete {
+		deleted, err := deleteExtraneous(src, dst, files, opts, report)
+		stats.Deleted = deleted
+		if err != nil {
+			return stats, err
+		}
+	}
+
+	if opts.Verify && !opts.DryRun {
+		if err := verify(ctx, src, dst, files); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// compare decides what to do with the source file from, described by e,
+// and its destination to. It returns upToDate if to is up to date.
+func compare(from, to string, e walk.Entry, checksum bool) (Op, error) {
+	info, err := os.Stat(to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Copy, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", to)
+	}
+	if info.Size() != e.Size {
+		return Update, nil
+	}
+	sameMeta := info.Mode().Perm() == e.Mode.Perm() && sameTime(info.ModTime(), e.ModTime)
+	if !checksum {
+		if sameMeta {
+			return upToDate, nil
+		}
+		// Without comparing the content, a different time means the file
+		// may have changed.
+		if !sameTime(info.ModTime(), e.ModTime) {
+			return Update, nil
+		}
+		return Touch, nil
+	}
+
+	same, err := sameContent(from, to)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case !same:
+		return Update, nil
+	case !sameMeta:
+		return Touch, nil
+	}
+	return upToDate, nil
+}
+
+// sameTime compares modification times to the second, like rsync, since
+// some file systems do not store fractions of seconds.
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// CopyFile copies the file src to dst, with the permissions and the
+// modification time of src. The content is written to a temporary file in
+// the directory of dst and renamed to dst when it is complete, so dst is
+// either the old or the new file, never a mix of both. Missing directories
+// of dst are created.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	// Sync before the rename, or a crash could leave an empty file under
+	// the final name.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := setMeta(tmp.Name(), info.Mode(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// setMeta sets the permissions and the modification time of a file.
+func setMeta(path string, mode fs.FileMode, modTime time.Time) error {
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(path, time.Time{}, modTime)
+}
+
+// deleteExtraneous removes the files in dst that are not among the source
+// files. Directories that are left empty are removed too, unless they
+// exist in the source.
+func deleteExtraneous(src, dst string, files []walk.Entry, opts Options, report func(Op, string, int64)) (int, error) {
+	keep := make(map[string]bool, len(files))
+	for _, e := range files {
+		keep[e.Path] = true
+	}
+
+	// The size and time filters select what to copy, not what to protect,
+	// so only the patterns, the depth and .gitignore files (which protect
+	// the .git directory) apply to the destination.
+	var extra []walk.Entry
+	dstOpts := walk.Options{
+		Include:   opts.Walk.Include,
+		Exclude:   opts.Walk.Exclude,
+		GitIgnore: opts.Walk.GitIgnore,
+		MaxDepth:  opts.Walk.MaxDepth,
+	}
+	err := walk.Walk(os.DirFS(dst), ".", dstOpts, func(e walk.Entry) error {
+		if !keep[e.Path] && !isTemp(e.Path) {
+			extra = append(extra, e)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var dirs []string
+	for _, e := range extra {
+		report(Delete, e.Path, e.Size)
+		if opts.DryRun {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dst, filepath.FromSlash(e.Path))); err != nil {
+			return 0, err
+		}
+		for d := path.Dir(e.Path); d != "."; d = path.Dir(d) {
+			dirs = append(dirs, d)
+		}
+	}
+
+	// Remove the deepest directories first. Removing a directory that is
+	// not empty fails, which is what we want.
+	slices.SortFunc(dirs, func(a, b string) int { return strings.Count(b, "/") - strings.Count(a, "/") })
+	for _, d := range slices.Compact(dirs) {
+		if _, err := os.Stat(filepath.Join(src, filepath.FromSlash(d))); err == nil {
+			continue
+		}
+		os.Remove(filepath.Join(dst, filepath.FromSlash(d)))
+	}
+	return len(extra), nil
+}
+
+// isTemp reports whether path is a temporary file of CopyFile, which an
+// interrupted sync may leave behind.
+func isTemp(p string) bool {
+	name := path.Base(p)
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp")
+}
+
+// verify compares every source file with its copy.
+func verify(ctx context.Context, src, dst string, files []walk.Entry) error {
+	var errs []error
+	for _, e := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		same, err := sameContent(filepath.Join(src, filepath.FromSlash(e.Path)), filepath.Join(dst, filepath.FromSlash(e.Path)))
+		if err == nil && !same {
+			err = fmt.Errorf("%s: %w", e.Path, ErrMismatch)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sameContent compares the SHA-256 digests of two files.
+func sameContent(a, b string) (bool, error) {
+	sumA, err := hashFile(a)
+	if err != nil {
+		return false, err
+	}
+	sumB, err := hashFile(b)
+	if err != nil {
+		return false, err
+	}
+	return sumA == sumB, nil
+}
+
+// hashFile returns the SHA-256 digest of a file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return walk.Hash(f)
+}
+
+// inside reports whether the path dir is inside (or equal to) the path
+// parent.
+func inside(dir, parent string) bool {
+	absDir, err1 := filepath.Abs(dir)
+	absParent, err2 := filepath.Abs(parent)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absParent, absDir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
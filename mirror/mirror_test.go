@@ -0,0 +1,289 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go_for_devops/walk"
+)
+
+// writeFiles creates the files in dir, by slash-separated path.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles returns the slash-separated paths of the files and directories
+// below dir.
+func listFiles(t *testing.T, dir string) string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if d.IsDir() {
+			rel += "/"
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(names, " ")
+}
+
+// syncActions runs Sync and returns the actions it reported, sorted.
+func syncActions(t *testing.T, src, dst string, opts Options) (Stats, string) {
+	t.Helper()
+	var actions []string
+	opts.OnAction = func(a Action) { actions = append(actions, fmt.Sprintf("%s %s", a.Op, a.Path)) }
+	stats, err := Sync(context.Background(), src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(actions)
+	return stats, strings.Join(actions, ", ")
+}
+
+func TestSync(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "new")
+	writeFiles(t, src, map[string]string{"a": "aaa", "sub/b": "bb", "sub/deep/c": "c"})
+	os.Chmod(filepath.Join(src, "a"), 0600)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filepath.Join(src, "sub/b"), time.Time{}, old)
+
+	stats, actions := syncActions(t, src, dst, Options{Verify: true})
+	if want := (Stats{Copied: 3, Bytes: 6}); stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	if actions != "copy a, copy sub/b, copy sub/deep/c" {
+		t.Errorf("actions %s", actions)
+	}
+	if got := listFiles(t, dst); got != "a sub/ sub/b sub/deep/ sub/deep/c" {
+		t.Errorf("destination has %s", got)
+	}
+	if info, _ := os.Stat(filepath.Join(dst, "a")); info.Mode().Perm() != 0600 {
+		t.Errorf("copy of a has mode %v", info.Mode())
+	}
+	if info, _ := os.Stat(filepath.Join(dst, "sub/b")); !info.ModTime().Equal(old) {
+		t.Errorf("copy of sub/b was modified at %v, want %v", info.ModTime(), old)
+	}
+
+	// Nothing changed, so nothing is done.
+	stats, actions = syncActions(t, src, dst, Options{Verify: true})
+	if want := (Stats{Unchanged: 3}); stats != want || actions != "" {
+		t.Errorf("second sync: stats %+v, actions %q", stats, actions)
+	}
+}
+
+func TestSyncIntoSource(t *testing.T) {
+	src := t.TempDir()
+	if _, err := Sync(context.Background(), src, filepath.Join(src, "backup"), Options{}); err == nil {
+		t.Error("syncing into the source succeeded")
+	}
+}
+
+func TestSyncFromDestination(t *testing.T) {
+	dst := t.TempDir()
+	writeFiles(t, dst, map[string]string{"b/x.txt": "x"})
+	// The source is not in the files of the destination, so Delete would
+	// remove it.
+	if _, err := Sync(context.Background(), filepath.Join(dst, "b"), dst, Options{Delete: true}); err == nil {
+		t.Error("syncing from inside the destination succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "b/x.txt")); err != nil {
+		t.Errorf("the source is gone: %v", err)
+	}
+}
+
+func TestSyncDelete(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"a": "a", "sub/b": "b"})
+	writeFiles(t, dst, map[string]string{
+		"extra":         "x",
+		"sub/extra":     "x",
+		"old/dir/extra": "x",
+		"old/dir/more":  "x",
+		// Left by an interrupted sync.
+		".a.123.tmp": "partial",
+		// Excluded from the sync, so protected.
+		"notes.keep": "x",
+	})
+	opts := Options{Walk: walk.Options{Exclude: []string{"*.keep"}}}
+
+	// Without Delete, the extra files stay.
+	syncActions(t, src, dst, opts)
+	before := listFiles(t, dst)
+	if !strings.Contains(before, "old/dir/extra") {
+		t.Fatalf("a sync without Delete deleted files: %s", before)
+	}
+
+	// A dry run only reports.
+	opts.Delete, opts.DryRun = true, true
+	stats, actions := syncActions(t, src, dst, opts)
+	want := "delete extra, delete old/dir/extra, delete old/dir/more, delete sub/extra"
+	if actions != want || stats.Deleted != 4 {
+		t.Errorf("dry run: actions %s, %d deleted", actions, stats.Deleted)
+	}
+	if got := listFiles(t, dst); got != before {
+		t.Errorf("the dry run changed the destination to %s", got)
+	}
+
+	opts.DryRun = false
+	stats, actions = syncActions(t, src, dst, opts)
+	if actions != want || stats.Deleted != 4 {
+		t.Errorf("actions %s, %d deleted", actions, stats.Deleted)
+	}
+	// old/dir and old are left empty and removed, sub is in the source.
+	if got := listFiles(t, dst); got != ".a.123.tmp a notes.keep sub/ sub/b" {
+		t.Errorf("destination has %s", got)
+	}
+}
+
+func TestSyncDeleteKeepsEmptySourceDirs(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"a": "a"})
+	os.Mkdir(filepath.Join(src, "empty"), 0755)
+	writeFiles(t, dst, map[string]string{"empty/extra": "x"})
+
+	if _, actions := syncActions(t, src, dst, Options{Delete: true}); actions != "copy a, delete empty/extra" {
+		t.Errorf("actions %s", actions)
+	}
+	if got := listFiles(t, dst); got != "a empty/" {
+		t.Errorf("destination has %s", got)
+	}
+}
+
+func TestIsTemp(t *testing.T) {
+	tests := map[string]bool{
+		".a.123.tmp":          true,
+		"sub/.data.csv.9.tmp": true,
+		"a.tmp":               false,
+		".hidden":             false,
+		".tmp/file":           false,
+		"sub/.a.tmp/file":     false,
+	}
+	for p, want := range tests {
+		if got := isTemp(p); got != want {
+			t.Errorf("isTemp(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		name     string
+		dst      string // content of the destination, "" if missing
+		mode     fs.FileMode
+		modTime  time.Time
+		checksum bool
+		want     Op
+	}{
+		{"missing", "", 0644, modTime, false, Copy},
+		{"same", "source", 0644, modTime, false, upToDate},
+		{"same with checksum", "source", 0644, modTime, true, upToDate},
+		{"fraction of a second", "source", 0644, modTime.Add(300 * time.Millisecond), false, upToDate},
+		{"other size", "longer source", 0644, modTime, false, Update},
+		{"other size with checksum", "longer source", 0644, modTime, true, Update},
+		// The mode alone does not change the content.
+		{"other mode", "source", 0600, modTime, false, Touch},
+		{"other mode with checksum", "source", 0600, modTime, true, Touch},
+		// Without the checksum, another time may mean another content.
+		{"other time", "source", 0644, modTime.Add(time.Hour), false, Update},
+		{"other time with checksum", "source", 0644, modTime.Add(time.Hour), true, Touch},
+		// Only the checksum finds changes that kept size and time.
+		{"other content", "SOURCE", 0644, modTime, false, upToDate},
+		{"other content with checksum", "SOURCE", 0644, modTime, true, Update},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+			writeFiles(t, dir, map[string]string{"from": "source"})
+			if tt.dst != "" {
+				writeFiles(t, dir, map[string]string{"to": tt.dst})
+				if err := setMeta(to, tt.mode, tt.modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			e := walk.Entry{Path: "from", Size: 6, Mode: 0644, ModTime: modTime}
+			got, err := compare(from, to, e, tt.checksum)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("compare = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareNotRegular(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "to"), 0755)
+	e := walk.Entry{Path: "from", Size: 1, Mode: 0644}
+	if _, err := compare(filepath.Join(dir, "from"), filepath.Join(dir, "to"), e, false); err == nil {
+		t.Error("compare accepted a directory as destination")
+	}
+}
+
+func TestSyncTouch(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"a": "same"})
+	syncActions(t, src, dst, Options{})
+	to := filepath.Join(dst, "a")
+	os.Chmod(to, 0600)
+
+	stats, actions := syncActions(t, src, dst, Options{})
+	if stats.Touched != 1 || stats.Bytes != 0 || actions != "touch a" {
+		t.Errorf("stats %+v, actions %s, want a touch without copying", stats, actions)
+	}
+	if info, _ := os.Stat(to); info.Mode().Perm() != 0644 {
+		t.Errorf("mode %v after the touch", info.Mode())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{"a": "same", "b": "same"})
+	if _, err := Sync(context.Background(), src, dst, Options{Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt a copy.
+	writeFiles(t, dst, map[string]string{"b": "SAME"})
+	files := []walk.Entry{{Path: "a"}, {Path: "b"}, {Path: "missing"}}
+	err := verify(context.Background(), src, dst, files)
+	if !errors.Is(err, ErrMismatch) || !strings.Contains(err.Error(), "b: ") {
+		t.Errorf("got error %v, want a mismatch of b", err)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want the missing file too", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := verify(ctx, src, dst, files); !errors.Is(err, context.Canceled) {
+		t.Errorf("verify with a cancelled context returned %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package notify sends email notifications, such as run reports, over SMTP
+// with the settings of the email section of config.json.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"go_for_devops/config"
+)
+
+// ErrNoSTARTTLS is returned when TLS is required, but the server does not
+// offer STARTTLS.
+var ErrNoSTARTTLS = errors.New("smtp server does not support STARTTLS")
+
+// DefaultTimeout bounds a Send call if the context has no deadline.
+const DefaultTimeout = 30 * time.Second
+
+// Message is an email with a plain-text and an optional HTML body.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends messages through the configured SMTP server.
+type Mailer struct {
+	cfg config.Email
+
+	// TLSConfig is used for STARTTLS. If nil, the server certificate is
+	// verified against the system roots and the SMTP host name.
+	TLSConfig *tls.Config
+}
+
+// NewMailer creates a Mailer for the email configuration.
+func NewMailer(cfg config.Email) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers msg to all its recipients.
+//
+// The connection is upgraded with STARTTLS if the configuration has
+// useTLS set; a server without STARTTLS is then an error rather than a
+// reason to send credentials in plain text. The server must accept all
+// recipients, otherwise nothing is sent.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", m.cfg.From, err)
+	}
+	var to []string
+	for _, addr := range msg.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, a.Address)
+	}
+
+	data, err := buildMessage(from, msg)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+	return m.send(ctx, from.Address, to, data)
+}
+
+// send runs the SMTP conversation.
+func (m *Mailer) send(ctx context.Context, from string, to []string, data []byte) error {
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// net/smtp does not take a context, so close the connection when
+	// the context is done. This unblocks any pending read or write.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return ctxErr(ctx, err)
+	}
+	defer c.Close()
+
+	if err := m.converse(c, from, to, data); err != nil {
+		return ctxErr(ctx, err)
+	}
+	return nil
+}
+
+// converse sends the SMTP commands for a single message.
+func (m *Mailer) converse(c *smtp.Client, from string, to []string, data []byte) error {
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if m.cfg.UseTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrNoSTARTTLS
+		}
+		tlsConfig := m.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: m.cfg.SMTPHost}
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		// PlainAuth refuses to send the password over a connection
+		// without TLS, unless the server runs on localhost.
+		auth := smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// ctxErr prefers the context error over the error of the closed
+// connection, which only says "use of closed network connection".
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// buildMessage formats msg as a MIME message. With an HTML body, it is a
+// multipart/alternative message, so mail clients can pick either part.
+func buildMessage(from *mail.Address, msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	// Header fields are written in this order. textproto.MIMEHeader would
+	// rewrite names such as Message-ID to Message-Id.
+	fields := [][2]string{
+		{"From", from.String()},
+		{"To", strings.Join(msg.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(from)},
+		{"MIME-Version", "1.0"},
+	}
+
+	if msg.HTML == "" {
+		fields = append(fields,
+			[2]string{"Content-Type", "text/plain; charset=utf-8"},
+			[2]string{"Content-Transfer-Encoding", "quoted-printable"})
+		writeHeader(&b, fields)
+		if err := writeQuotedPrintable(&b, msg.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&b)
+	fields = append(fields, [2]string{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()})
+	writeHeader(&b, fields)
+
+	// Clients show the last part they understand, so HTML goes last.
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeHeader writes the header fields followed by the empty line that
+// ends the header.
+func writeHeader(w io.Writer, fields [][2]string) {
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s: %s\r\n", f[0], f[1])
+	}
+	fmt.Fprint(w, "\r\n")
+}
+
+// writeQuotedPrintable encodes s, which keeps lines short and ASCII-only
+// as SMTP requires.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qw, s); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// messageID returns a unique Message-ID in the domain of the sender.
+func messageID(from *mail.Address) string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	domain := "localhost"
+	if at := strings.LastIndexByte(from.Address, '@'); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain)
+}
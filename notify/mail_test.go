@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"go_for_devops/config"
+	"go_for_devops/notify/smtptest"
+)
+
+// newServer starts a smtptest server and returns a Mailer configured for it.
+func newServer(t *testing.T, useTLS bool) (*smtptest.Server, *Mailer) {
+	t.Helper()
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	m := NewMailer(config.Email{
+		SMTPHost: srv.Host(),
+		SMTPPort: srv.Port(),
+		From:     "Reports <reports@example.com>",
+		Username: "reporter",
+		Password: "secret",
+		UseTLS:   useTLS,
+	})
+	m.TLSConfig = srv.ClientTLSConfig()
+	return srv, m
+}
+
+// parts returns the decoded bodies of a multipart message by content type.
+func parts(t *testing.T, msg *mail.Message) map[string]string {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	bodies := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		// NextPart undoes the quoted-printable encoding.
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		bodies[contentType] = string(b)
+	}
+	return bodies
+}
+
+func TestSendReport(t *testing.T) {
+	srv, m := newServer(t, true)
+
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	report := Report{
+		App:      "go_for_devops",
+		Title:    "CSV validation",
+		Started:  started,
+		Finished: started.Add(1500 * time.Millisecond),
+		Summary:  []Stat{{Name: "Records", Value: 42}},
+		Failures: []Failure{{Source: "users.csv", Line: 3, Err: "bad email <script>"}},
+	}
+	msg, err := report.Message("Ops <ops@example.com>", "dev@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.Messages()
+	if len(got) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(got))
+	}
+	rec := got[0]
+	if !rec.TLS {
+		t.Error("the message was sent without STARTTLS")
+	}
+	if rec.Username != "reporter" {
+		t.Errorf("AUTH PLAIN user %q, want reporter", rec.Username)
+	}
+	if rec.From != "reports@example.com" {
+		t.Errorf("MAIL FROM %q", rec.From)
+	}
+	if strings.Join(rec.To, " ") != "ops@example.com dev@example.com" {
+		t.Errorf("RCPT TO %q, want the bare addresses", rec.To)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(rec.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "[go_for_devops] CSV validation: 1 failures" {
+		t.Errorf("subject %q", subject)
+	}
+	if to := parsed.Header.Get("To"); !strings.Contains(to, "ops@example.com") || !strings.Contains(to, "dev@example.com") {
+		t.Errorf("To header %q", to)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID %q, want one in the sender's domain", id)
+	}
+
+	bodies := parts(t, parsed)
+	text := bodies["text/plain"]
+	for _, want := range []string{"CSV validation", "Records", "42", "2024-05-01 12:00:00", "1.5s", "users.csv:3: bad email <script>"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part does not contain %q:\n%s", want, text)
+		}
+	}
+	html := bodies["text/html"]
+	for _, want := range []string{"<h2>CSV validation</h2>", "Failures (1)", "<code>users.csv:3</code>", "bad email &lt;script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML part does not contain %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("the HTML part contains an unescaped value")
+	}
+}
+
+func TestSendPlainText(t *testing.T) {
+	srv, m := newServer(t, false)
+
+	// PlainAuth sends the password without TLS only to localhost, which
+	// is where the test server runs.
+	msg := Message{To: []string{"ops@example.com"}, Subject: "Grüße", Text: "a line that is longer than seventy-six characters, so quoted-printable has to wrap it"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := srv.Messages()[0]
+	if rec.TLS {
+		t.Error("STARTTLS was used although useTLS is off")
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(rec.Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := parsed.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "Grüße" {
+		t.Errorf("subject %q", subject)
+	}
+	// The server has turned CRLF into LF already.
+	for _, line := range strings.Split(string(rec.Data), "\n") {
+		if len(line) > 78 {
+			t.Errorf("line of %d characters: %q", len(line), line)
+		}
+	}
+}
+
+func TestSendInvalidAddresses(t *testing.T) {
+	srv, m := newServer(t, true)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"no recipients", Message{Subject: "x"}, "no recipients"},
+		{"bad recipient", Message{To: []string{"not an address"}}, "invalid recipient"},
+	}
+	for _, tt := range tests {
+		if err := m.Send(ctx, tt.msg); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Errorf("%d invalid messages were sent", n)
+	}
+}
+
+func TestSendContextCanceled(t *testing.T) {
+	_, m := newServer(t, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := m.Send(ctx, Message{To: []string{"ops@example.com"}, Text: "x"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+)
+
+// templates holds the plain-text and HTML templates of a Report.
+//
+//go:embed templates
+var templates embed.FS
+
+var (
+	reportText = template.Must(template.ParseFS(templates, "templates/report.txt.tmpl"))
+	// html/template escapes the values, so file names and error messages
+	// cannot inject markup into the mail.
+	reportHTML = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/report.html.tmpl"))
+)
+
+// Report summarises a run, e.g. a CSV validation or a user import.
+type Report struct {
+	// App is the application name, shown in the subject and the footer.
+	App string
+	// Title describes the run, e.g. "CSV validation".
+	Title    string
+	Started  time.Time
+	Finished time.Time
+	// Summary lists key figures, e.g. the number of records read.
+	Summary []Stat
+	// Failures lists the problems found during the run.
+	Failures []Failure
+}
+
+// Stat is a named figure of a Report.
+type Stat struct {
+	Name  string
+	Value any
+}
+
+// Failure is a problem found in a source (e.g. a file) during a run.
+type Failure struct {
+	Source string
+	// Line is the line number in the source, or 0 if it does not apply.
+	Line int
+	Err  string
+}
+
+// Duration returns how long the run took.
+func (r Report) Duration() time.Duration {
+	return r.Finished.Sub(r.Started).Round(time.Millisecond)
+}
+
+// Subject returns the subject line of the report, which tells at a glance
+// whether the run failed.
+func (r Report) Subject() string {
+	status := "OK"
+	if len(r.Failures) > 0 {
+		status = fmt.Sprintf("%d failures", len(r.Failures))
+	}
+	return fmt.Sprintf("[%s] %s: %s", r.App, r.Title, status)
+}
+
+// Message renders the report as a message to the given recipients.
+func (r Report) Message(to ...string) (Message, error) {
+	var text, html bytes.Buffer
+	if err := reportText.Execute(&text, r); err != nil {
+		return Message{}, err
+	}
+	if err := reportHTML.Execute(&html, r); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: r.Subject(), Text: text.String(), HTML: html.String()}, nil
+}
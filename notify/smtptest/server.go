@@ -0,0 +1,290 @@
+// Package smtptest provides a local SMTP server that records the messages
+// it receives, for testing code that sends mail. It is the SMTP
+// counterpart of net/http/httptest.
+//
+// The server supports EHLO, STARTTLS (with a self-signed certificate),
+// AUTH PLAIN, MAIL, RCPT, DATA, RSET, NOOP and QUIT. It accepts any
+// credentials and delivers nothing.
+package smtptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message received by the server.
+type Message struct {
+	From string
+	To   []string
+	// Data is the raw message, with the header and the body.
+	Data []byte
+	// TLS reports whether the message was sent after STARTTLS.
+	TLS bool
+	// Username is the user name of AUTH PLAIN, if the client logged in.
+	Username string
+}
+
+// Server is a local SMTP server.
+type Server struct {
+	// Addr is the address the server listens on, e.g. 127.0.0.1:45123.
+	Addr string
+
+	listener net.Listener
+	tlsCert  tls.Certificate
+	certPool *x509.CertPool
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Message
+	received chan struct{}
+}
+
+// NewServer starts a server on a random port of the loopback interface.
+// Call Close when done.
+func NewServer() (*Server, error) {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		listener: l,
+		tlsCert:  cert,
+		certPool: pool,
+		received: make(chan struct{}, 1),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Host returns the host part of Addr.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr)
+	return host
+}
+
+// Port returns the port part of Addr.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// ClientTLSConfig returns a TLS configuration that trusts the server's
+// self-signed certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.certPool, ServerName: s.Host()}
+}
+
+// Messages returns the messages received so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Received returns a channel that receives a value whenever a message has
+// been received. Values are dropped if nobody is waiting.
+func (s *Server) Received() <-chan struct{} {
+	return s.received
+}
+
+// Close stops the server and waits for open connections to finish.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// serve accepts connections until the listener is closed.
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			// Do not let a stuck client block Close forever.
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			s.handle(conn)
+		}()
+	}
+}
+
+// session is the state of an SMTP conversation.
+type session struct {
+	tls      bool
+	username string
+	from     string
+	to       []string
+}
+
+// handle runs the SMTP conversation on conn.
+func (s *Server) handle(conn net.Conn) {
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 smtptest ready")
+
+	var sess session
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			tp.PrintfLine("250-smtptest greets %s", arg)
+			if !sess.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250-AUTH PLAIN")
+			tp.PrintfLine("250 8BITMIME")
+		case "HELO":
+			tp.PrintfLine("250 smtptest")
+		case "STARTTLS":
+			if sess.tls {
+				tp.PrintfLine("503 TLS already active")
+				continue
+			}
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.tlsCert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			// The client starts over with EHLO after the handshake.
+			conn = tlsConn
+			tp = textproto.NewConn(tlsConn)
+			sess = session{tls: true}
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mech, "PLAIN") {
+				tp.PrintfLine("504 Unrecognized authentication type")
+				continue
+			}
+			if resp == "" {
+				tp.PrintfLine("334 ")
+				if resp, err = tp.ReadLine(); err != nil {
+					return
+				}
+			}
+			// The response is "authzid\x00username\x00password".
+			dec, err := base64.StdEncoding.DecodeString(resp)
+			parts := strings.Split(string(dec), "\x00")
+			if err != nil || len(parts) != 3 {
+				tp.PrintfLine("501 Malformed AUTH response")
+				continue
+			}
+			sess.username = parts[1]
+			tp.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			sess.from = addrArg(arg, "FROM:")
+			sess.to = nil
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			if sess.from == "" {
+				tp.PrintfLine("503 MAIL first")
+				continue
+			}
+			sess.to = append(sess.to, addrArg(arg, "TO:"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			if len(sess.to) == 0 {
+				tp.PrintfLine("503 RCPT first")
+				continue
+			}
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			// DotReader undoes the dot-stuffing and stops at the final ".".
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.record(Message{From: sess.from, To: sess.to, Data: data, TLS: sess.tls, Username: sess.username})
+			sess.from, sess.to = "", nil
+			tp.PrintfLine("250 OK: queued")
+		case "RSET":
+			sess.from, sess.to = "", nil
+			tp.PrintfLine("250 OK")
+		case "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// record stores a received message.
+func (s *Server) record(m Message) {
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	s.mu.Unlock()
+
+	select {
+	case s.received <- struct{}{}:
+	default:
+	}
+}
+
+// addrArg extracts the address from an argument such as
+// "FROM:<a@example.com> BODY=8BITMIME".
+func addrArg(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// selfSignedCert creates a certificate for 127.0.0.1 and localhost, and a
+// pool that trusts it.
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"smtptest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
@@ -0,0 +1,204 @@
+// Package pipeline connects typed processing stages with channels, so the
+// goroutine, channel and context plumbing of a concurrent data flow is
+// written once instead of in every function:
+//
+//	p := pipeline.New(ctx, "users")
+//	lines := pipeline.Lines(p, "read", file)
+//	users := pipeline.Map(lines, "decode", func(ctx context.Context, l pipeline.Line) (User, error) {
+//		return getUser(l.Text)
+//	})
+//	all, err := pipeline.Collect(users)
+//
+// Every stage runs in its own goroutines and passes its output to the next
+// stage through a bounded channel, so a slow stage slows down the stages
+// before it instead of letting the buffers grow.
+//
+// Errors follow the semantics of errgroup: the first stage that fails
+// cancels the context of all stages, and Wait returns that first error.
+//
+// Every stage counts the items it receives and emits, and its errors, in
+// the default metrics registry, labelled with the pipeline and stage name.
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"go_for_devops/counter"
+	"go_for_devops/metrics"
+)
+
+// DefaultBuffer is the channel capacity between two stages, unless the
+// Buffer option says otherwise.
+const DefaultBuffer = 16
+
+// Pipeline is a set of connected stages.
+type Pipeline struct {
+	name string
+	g    *errgroup.Group
+	ctx  context.Context
+
+	mu     sync.Mutex
+	stages []*stage
+}
+
+// New creates a pipeline. Its stages stop when ctx is cancelled. The name
+// labels the metrics of the stages.
+func New(ctx context.Context, name string) *Pipeline {
+	g, ctx := errgroup.WithContext(ctx)
+	return &Pipeline{name: name, g: g, ctx: ctx}
+}
+
+// Context returns the context of the stages. It is cancelled when a stage
+// fails or the parent context is cancelled.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Wait waits for all stages to finish and returns the first error.
+func (p *Pipeline) Wait() error {
+	return p.g.Wait()
+}
+
+// Stats returns the counts of every stage, in the order the stages were
+// added.
+func (p *Pipeline) Stats() []Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]Stats, len(p.stages))
+	for i, s := range p.stages {
+		stats[i] = Stats{Stage: s.name, In: s.in.Value(), Out: s.out.Value(), Errors: s.errors.Value()}
+	}
+	return stats
+}
+
+// Stats are the counts of a stage.
+type Stats struct {
+	Stage string
+	// In is the number of items received, and Out the number emitted.
+	// A Filter emits fewer items than it receives, and a Batch emits one
+	// item per batch.
+	In, Out int64
+	Errors  int64
+}
+
+// Stream is the output of a stage, which is the input of the next stage.
+type Stream[T any] struct {
+	p  *Pipeline
+	ch <-chan T
+}
+
+// Pipeline returns the pipeline the stream belongs to.
+func (s Stream[T]) Pipeline() *Pipeline {
+	return s.p
+}
+
+// Option configures a stage.
+type Option func(*options)
+
+type options struct {
+	buffer  int
+	workers int
+}
+
+// Buffer sets the capacity of the output channel of a stage. 0 makes it
+// unbuffered.
+func Buffer(n int) Option {
+	return func(o *options) {
+		o.buffer = n
+	}
+}
+
+// Workers runs a Map, Filter or Sink stage in n goroutines that take items
+// from the same input (fan-out) and send to the same output (fan-in). With
+// more than one worker, items can leave the stage in a different order.
+func Workers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+func buildOptions(opts []Option) options {
+	o := options{buffer: DefaultBuffer, workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.buffer < 0 {
+		o.buffer = 0
+	}
+	if o.workers < 1 {
+		o.workers = 1
+	}
+	return o
+}
+
+// stage holds the counts and metrics of a stage.
+type stage struct {
+	name               string
+	in, out, errors    counter.AtomicInt
+	mIn, mOut, mErrors *metrics.Counter
+}
+
+// addStage registers a stage and its metrics.
+func (p *Pipeline) addStage(name string) *stage {
+	labels := metrics.Labels{"pipeline": p.name, "stage": name}
+	s := &stage{
+		name:    name,
+		mIn:     metrics.NewCounter("pipeline_items_in_total", "Items received by pipeline stages.", labels),
+		mOut:    metrics.NewCounter("pipeline_items_out_total", "Items emitted by pipeline stages.", labels),
+		mErrors: metrics.NewCounter("pipeline_errors_total", "Errors returned by pipeline stages.", labels),
+	}
+	p.mu.Lock()
+	p.stages = append(p.stages, s)
+	p.mu.Unlock()
+	return s
+}
+
+func (s *stage) received() {
+	s.in.Inc()
+	s.mIn.Inc()
+}
+
+func (s *stage) emitted() {
+	s.out.Inc()
+	s.mOut.Inc()
+}
+
+// fail counts err, if it is not nil, and returns it.
+func (s *stage) fail(err error) error {
+	if err != nil {
+		s.errors.Inc()
+		s.mErrors.Inc()
+	}
+	return err
+}
+
+// send sends v on ch, unless ctx is cancelled first.
+func send[T any](ctx context.Context, ch chan<- T, v T) error {
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run starts n workers of a stage, and calls done, e.g. to close the
+// output channel, when all of them have returned.
+func (p *Pipeline) run(s *stage, n int, work func(ctx context.Context) error, done func()) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for range n {
+		p.g.Go(func() error {
+			defer wg.Done()
+			return s.fail(work(p.ctx))
+		})
+	}
+	p.g.Go(func() error {
+		wg.Wait()
+		done()
+		return nil
+	})
+}
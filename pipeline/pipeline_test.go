@@ -0,0 +1,239 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// numbers returns the numbers from 1 to n.
+func numbers(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i + 1
+	}
+	return s
+}
+
+// checkNoLeak fails the test if goroutines started during the test are
+// still running shortly after it.
+func checkNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	t.Cleanup(func() {
+		// Goroutines that are about to return may need a moment.
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := runtime.NumGoroutine(); n > before {
+			buf := make([]byte, 1<<16)
+			t.Errorf("%d goroutines leaked:\n%s", n-before, buf[:runtime.Stack(buf, true)])
+		}
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background(), "test")
+	in := FromSlice(p, "numbers", numbers(10))
+	even := Filter(in, "even", func(n int) bool { return n%2 == 0 })
+	squares := Map(even, "square", func(_ context.Context, n int) (int, error) { return n * n, nil })
+	batches := Batch(squares, "batch", 2, 0)
+	got, err := Collect(batches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[[4 16] [36 64] [100]]" {
+		t.Errorf("got %v", got)
+	}
+
+	want := []Stats{
+		{Stage: "numbers", In: 0, Out: 10},
+		{Stage: "even", In: 10, Out: 5},
+		{Stage: "square", In: 5, Out: 5},
+		{Stage: "batch", In: 5, Out: 3},
+		{Stage: "collect", In: 3, Out: 0},
+	}
+	stats := p.Stats()
+	if len(stats) != len(want) {
+		t.Fatalf("stats %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stage %d: %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+}
+
+func TestFirstErrorCancels(t *testing.T) {
+	checkNoLeak(t)
+	first := errors.New("first")
+
+	p := New(context.Background(), "test")
+	in := Source(p, "endless", func(ctx context.Context, emit func(int) error) error {
+		for n := 0; ; n++ {
+			if err := emit(n); err != nil {
+				return err
+			}
+		}
+	})
+	out := Map(in, "fail", func(_ context.Context, n int) (int, error) {
+		if n == 100 {
+			return 0, first
+		}
+		return n, nil
+	})
+	Sink(out, "slow", func(ctx context.Context, n int) error {
+		select {
+		case <-ctx.Done():
+			return errors.New("second")
+		case <-time.After(time.Millisecond):
+			return nil
+		}
+	})
+
+	if err := p.Wait(); err != first {
+		t.Errorf("Wait returned %v, want the first error", err)
+	}
+	if p.Context().Err() == nil {
+		t.Error("the context of the stages was not cancelled")
+	}
+
+	var failed int64
+	for _, s := range p.Stats() {
+		failed += s.Errors
+		if s.Stage == "fail" && s.Errors != 1 {
+			t.Errorf("stage fail counted %d errors, want 1", s.Errors)
+		}
+	}
+	// The source and possibly the sink stop with the context error.
+	if failed < 2 {
+		t.Errorf("%d errors in all stages, want the other stages to stop with an error too", failed)
+	}
+}
+
+func TestParentCancel(t *testing.T) {
+	checkNoLeak(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx, "test")
+	in := Source(p, "endless", func(ctx context.Context, emit func(int) error) error {
+		for n := 0; ; n++ {
+			if err := emit(n); err != nil {
+				return err
+			}
+		}
+	}, Buffer(0))
+	var seen atomic.Int64
+	Sink(in, "count", func(ctx context.Context, n int) error {
+		if seen.Add(1) == 50 {
+			cancel()
+		}
+		return nil
+	})
+	if err := p.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait returned %v, want context.Canceled", err)
+	}
+}
+
+// TestNoLeakWhenSinkStops checks that every stage returns when the last
+// stage stops early, even when the stages before it are blocked sending
+// to full channels.
+func TestNoLeakWhenSinkStops(t *testing.T) {
+	stop := errors.New("stop")
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint(workers, " workers"), func(t *testing.T) {
+			checkNoLeak(t)
+			p := New(context.Background(), "test")
+			in := FromSlice(p, "numbers", numbers(10000), Buffer(1))
+			even := Filter(in, "even", func(n int) bool { return n%2 == 0 }, Workers(workers), Buffer(1))
+			doubled := Map(even, "double", func(_ context.Context, n int) (int, error) { return 2 * n, nil }, Workers(workers), Buffer(1))
+			batches := Batch(doubled, "batch", 3, time.Millisecond, Buffer(1))
+			merged := Merge("merge", batches, FromSlice(p, "more", [][]int{{1}, {2}, {3}}))
+			var n int
+			Sink(merged, "stop early", func(_ context.Context, b []int) error {
+				if n++; n == 3 {
+					return stop
+				}
+				return nil
+			})
+			if err := p.Wait(); err != stop {
+				t.Errorf("Wait returned %v, want the error of the sink", err)
+			}
+		})
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	checkNoLeak(t)
+	var running, most atomic.Int32
+	p := New(context.Background(), "test")
+	in := FromSlice(p, "numbers", numbers(40))
+	out := Map(in, "slow", func(_ context.Context, n int) (int, error) {
+		cur := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := most.Load()
+			if cur <= m || most.CompareAndSwap(m, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return n, nil
+	}, Workers(4))
+	got, err := Collect(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most.Load() < 2 || most.Load() > 4 {
+		t.Errorf("up to %d items were processed at once, want 2 to 4", most.Load())
+	}
+	// The order may change, but no item is lost.
+	sort.Ints(got)
+	if fmt.Sprint(got) != fmt.Sprint(numbers(40)) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestBatchMaxWait(t *testing.T) {
+	checkNoLeak(t)
+	p := New(context.Background(), "test")
+	in := Source(p, "slow", func(ctx context.Context, emit func(int) error) error {
+		emit(1)
+		emit(2)
+		// The batch of 1 and 2 must be passed on before 3 arrives.
+		time.Sleep(100 * time.Millisecond)
+		return emit(3)
+	})
+	var times []time.Duration
+	start := time.Now()
+	batches := Batch(in, "batch", 10, 20*time.Millisecond)
+	Sink(batches, "record", func(_ context.Context, b []int) error {
+		times = append(times, time.Since(start))
+		return nil
+	})
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || times[0] > 80*time.Millisecond {
+		t.Errorf("batches passed on after %v, want the first one after about 20ms", times)
+	}
+}
+
+func TestLines(t *testing.T) {
+	input := "first\r\nsecond\n\nlast"
+	p := New(context.Background(), "test")
+	lines, err := Collect(Lines(p, "lines", strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Line{{1, "first", 7}, {2, "second", 14}, {3, "", 15}, {4, "last", 19}}
+	if fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", lines, want)
+	}
+}
@@ -0,0 +1,232 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"time"
+)
+
+// Source starts a stream with the items that fn emits. emit returns an
+// error once the pipeline is cancelled, which fn should return.
+func Source[T any](p *Pipeline, name string, fn func(ctx context.Context, emit func(T) error) error, opts ...Option) Stream[T] {
+	o := buildOptions(opts)
+	s := p.addStage(name)
+	out := make(chan T, o.buffer)
+	p.run(s, 1, func(ctx context.Context) error {
+		return fn(ctx, func(v T) error {
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+			s.emitted()
+			return nil
+		})
+	}, func() { close(out) })
+	return Stream[T]{p: p, ch: out}
+}
+
+// FromSlice starts a stream with the items of a slice.
+func FromSlice[T any](p *Pipeline, name string, items []T, opts ...Option) Stream[T] {
+	return Source(p, name, func(ctx context.Context, emit func(T) error) error {
+		for _, v := range items {
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts...)
+}
+
+// Line is a line of text read by Lines.
+type Line struct {
+	// Num is the line number, starting at 1.
+	Num  int
+	Text string
+	// End is the byte offset in the input right after the line and its
+	// line ending, i.e. where the next line starts. A reader can Seek to
+	// it to continue after this line.
+	End int64
+}
+
+// Lines starts a stream with the lines of r, without the line endings.
+func Lines(p *Pipeline, name string, r io.Reader, opts ...Option) Stream[Line] {
+	return Source(p, name, func(ctx context.Context, emit func(Line) error) error {
+		scanner := bufio.NewScanner(r)
+		// Count the bytes the scanner consumes, to know the offset of
+		// every line.
+		var offset int64
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+			offset += int64(advance)
+			return advance, token, err
+		})
+		for n := 1; scanner.Scan(); n++ {
+			if err := emit(Line{Num: n, Text: scanner.Text(), End: offset}); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}, opts...)
+}
+
+// Map converts every item of a stream with fn. An error of fn stops the
+// pipeline.
+func Map[T, U any](in Stream[T], name string, fn func(ctx context.Context, v T) (U, error), opts ...Option) Stream[U] {
+	p := in.p
+	o := buildOptions(opts)
+	s := p.addStage(name)
+	out := make(chan U, o.buffer)
+	p.run(s, o.workers, func(ctx context.Context) error {
+		for v := range in.ch {
+			s.received()
+			u, err := fn(ctx, v)
+			if err != nil {
+				return err
+			}
+			if err := send(ctx, out, u); err != nil {
+				return err
+			}
+			s.emitted()
+		}
+		return nil
+	}, func() { close(out) })
+	return Stream[U]{p: p, ch: out}
+}
+
+// Filter passes on the items for which keep returns true.
+func Filter[T any](in Stream[T], name string, keep func(v T) bool, opts ...Option) Stream[T] {
+	p := in.p
+	o := buildOptions(opts)
+	s := p.addStage(name)
+	out := make(chan T, o.buffer)
+	p.run(s, o.workers, func(ctx context.Context) error {
+		for v := range in.ch {
+			s.received()
+			if !keep(v) {
+				continue
+			}
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+			s.emitted()
+		}
+		return nil
+	}, func() { close(out) })
+	return Stream[T]{p: p, ch: out}
+}
+
+// Batch groups the items of a stream into slices of up to size items. A
+// batch that is not full is passed on after maxWait, counted from its first
+// item, so a slow source does not hold items back for long. A maxWait of 0
+// waits until the batch is full or the stream ends.
+func Batch[T any](in Stream[T], name string, size int, maxWait time.Duration, opts ...Option) Stream[[]T] {
+	p := in.p
+	o := buildOptions(opts)
+	s := p.addStage(name)
+	out := make(chan []T, o.buffer)
+	size = max(size, 1)
+	p.run(s, 1, func(ctx context.Context) error {
+		var batch []T
+		// A nil channel blocks forever, so the timer case of the select
+		// is only active while a batch waits.
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		flush := func() error {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := send(ctx, out, batch); err != nil {
+				return err
+			}
+			s.emitted()
+			batch = nil
+			return nil
+		}
+
+		for {
+			select {
+			case v, ok := <-in.ch:
+				if !ok {
+					return flush()
+				}
+				s.received()
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = time.NewTimer(maxWait)
+					timeout = timer.C
+				}
+				if len(batch) >= size {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			case <-timeout:
+				if err := flush(); err != nil {
+					return err
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}, func() { close(out) })
+	return Stream[[]T]{p: p, ch: out}
+}
+
+// Merge combines one or more streams of the same pipeline into one
+// (fan-in). The order of the items of different streams is not defined.
+func Merge[T any](name string, ins ...Stream[T]) Stream[T] {
+	p := ins[0].p
+	s := p.addStage(name)
+	out := make(chan T, DefaultBuffer)
+	// One worker per input, so a slow input does not block the others.
+	next := make(chan Stream[T], len(ins))
+	for _, in := range ins {
+		next <- in
+	}
+	close(next)
+	p.run(s, len(ins), func(ctx context.Context) error {
+		in := <-next
+		for v := range in.ch {
+			s.received()
+			if err := send(ctx, out, v); err != nil {
+				return err
+			}
+			s.emitted()
+		}
+		return nil
+	}, func() { close(out) })
+	return Stream[T]{p: p, ch: out}
+}
+
+// Sink ends a stream by calling fn for every item. An error of fn stops
+// the pipeline. Call Wait on the pipeline to wait for the sink to finish.
+func Sink[T any](in Stream[T], name string, fn func(ctx context.Context, v T) error, opts ...Option) {
+	p := in.p
+	o := buildOptions(opts)
+	s := p.addStage(name)
+	p.run(s, o.workers, func(ctx context.Context) error {
+		for v := range in.ch {
+			s.received()
+			if err := fn(ctx, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func() {})
+}
+
+// Collect ends a stream by collecting its items in a slice, waits for the
+// pipeline, and returns the items and the first error.
+func Collect[T any](in Stream[T]) ([]T, error) {
+	var items []T
+	Sink(in, "collect", func(_ context.Context, v T) error {
+		items = append(items, v)
+		return nil
+	})
+	err := in.p.Wait()
+	return items, err
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go_for_devops/config"
+	"go_for_devops/flags"
+	"go_for_devops/metrics"
+)
+
+/**
+* HTTP API server.
+*
+* Exposes the users, CSV and config data of this project over HTTP:
+*
+* GET /users             list all users
+* GET /users/{id}        get a single user by ID
+* POST /users            create a user
+* PUT /users/{id}        create or replace a user
+* DELETE /users/{id}     delete a user
+* GET /csv/{file}        query the rows of a CSV file in the CSV directory
+* GET /config            the effective configuration, with secrets redacted
+* GET /healthz           liveness: the process is up
+* GET /readyz            readiness: the data files are reachable
+* GET /metrics           metrics in the Prometheus text format
+*
+* Users are kept in the UserStore selected by the storage section of the
+* configuration. By default this is the processed users file, which starts
+* out as a copy of the source file.
+**/
+
+// apiServer holds the data sources of the HTTP API.
+type apiServer struct {
+	users  UserStore
+	csvDir string
+	cfg    *config.Config
+	// flags are reloaded from the configuration file while the server
+	// runs, unlike cfg.
+	flags *flags.Set
+
+	// writeMu makes the existence check and the write of createUser and
+	// putUser atomic.
+	writeMu sync.Mutex
+
+	// shuttingDown makes /readyz fail while the server drains connections,
+	// so load balancers stop sending new requests.
+	shuttingDown atomic.Bool
+}
+
+// routes returns the HTTP handler with all API endpoints.
+func (s *apiServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", s.listUsers)
+	mux.HandleFunc("GET /users/{id}", s.getUser)
+	mux.HandleFunc("POST /users", s.createUser)
+	mux.HandleFunc("PUT /users/{id}", s.putUser)
+	mux.HandleFunc("DELETE /users/{id}", s.deleteUser)
+	mux.HandleFunc("GET /csv/{file}", s.queryCSV)
+	mux.HandleFunc("GET /config", s.getConfig)
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.Handle("GET /metrics", metrics.Default.Handler())
+	return instrumentHandler(mux)
+}
+
+// listUsers handles GET /users.
+func (s *apiServer) listUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.users.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// getUser handles GET /users/{id}.
+func (s *apiServer) getUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := s.users.Get(r.Context(), id)
+	if errors.Is(err, errUserNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("user %d not found", id))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// createUser handles POST /users.
+func (s *apiServer) createUser(w http.ResponseWriter, r *http.Request) {
+	u, hasID, err := decodeUserBody(r)
+	if err != nil {
+		writeError(w, bodyErrorStatus(err), err)
+		return
+	}
+	if !hasID {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("id is required"))
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_, err = s.users.Get(r.Context(), u.ID)
+	if err == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("user %d already exists", u.ID))
+		return
+	}
+	if !errors.Is(err, errUserNotFound) {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.users.Put(r.Context(), u); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/users/%d", u.ID))
+	writeJSON(w, http.StatusCreated, u)
+}
+
+// putUser handles PUT /users/{id}. The ID in the body is optional, but must
+// match the ID in the path if it is given.
+func (s *apiServer) putUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	u, hasID, err := decodeUserBody(r)
+	if err != nil {
+		writeError(w, bodyErrorStatus(err), err)
+		return
+	}
+	if hasID && u.ID != id {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("user ID %d in the body does not match %d in the path", u.ID, id))
+		return
+	}
+	u.ID = id
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	status := http.StatusOK
+	_, err = s.users.Get(r.Context(), id)
+	if errors.Is(err, errUserNotFound) {
+		status = http.StatusCreated
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.users.Put(r.Context(), u); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, status, u)
+}
+
+// deleteUser handles DELETE /users/{id}.
+func (s *apiServer) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := userID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.users.Delete(r.Context(), id)
+	if errors.Is(err, errUserNotFound) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("user %d not found", id))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// userID parses the {id} path value.
+func userID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, fmt.Errorf("user ID must be numeric")
+	}
+	return id, nil
+}
+
+// maxUserBody limits the size of request bodies with a user record.
+const maxUserBody = 4 << 10
+
+// decodeUserBody reads a user from the request body. The body is either
+// JSON ({"name": "mario", "id": 295303}) or, with Content-Type text/plain,
+// a record in the file format (mario:295303), which is parsed by getUser.
+// hasID reports whether the body contained an ID.
+func decodeUserBody(r *http.Request) (u User, hasID bool, err error) {
+	body := http.MaxBytesReader(nil, r.Body, maxUserBody)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return User{}, false, err
+		}
+		u, err := getUser(strings.TrimSpace(string(b)))
+		return u, err == nil, err
+	}
+
+	var in struct {
+		Name *string         `json:"name"`
+		ID   json.RawMessage `json:"id"`
+	}
+	if err := json.NewDecoder(body).Decode(&in); err != nil {
+		return User{}, false, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if in.Name == nil {
+		return User{}, false, fmt.Errorf("name is required")
+	}
+
+	u = User{Name: strings.TrimSpace(*in.Name)}
+	if len(in.ID) > 0 && string(in.ID) != "null" {
+		// Accept both 42 and "42", but nothing that is not a whole number.
+		id, err := strconv.Atoi(strings.Trim(string(in.ID), `"`))
+		if err != nil {
+			return User{}, false, fmt.Errorf("user ID must be numeric")
+		}
+		u.ID = id
+		hasID = true
+	}
+	if err := u.validate(); err != nil {
+		return User{}, false, err
+	}
+	return u, hasID, nil
+}
+
+// bodyErrorStatus returns the status code for an error of decodeUserBody:
+// 413 if the body is too large, 400 otherwise.
+func bodyErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// csvRow is a CSV record as returned by the API.
+type csvRow struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+// queryCSV handles GET /csv/{file}. Rows can be filtered with the first
+// and last query parameters (case-insensitive substring match) and paged
+// with offset and limit. The first line is treated as a header unless
+// header=false is passed.
+func (s *apiServer) queryCSV(w http.ResponseWriter, r *http.Request) {
+	// Only allow plain file names, so requests cannot escape the CSV directory.
+	name := r.PathValue("file")
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".csv" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid CSV file name %q", name))
+		return
+	}
+
+	q := r.URL.Query()
+	offset, err := intParam(q.Get("offset"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("offset: %w", err))
+		return
+	}
+	limit, err := intParam(q.Get("limit"), s.flags.Int("maxItemsToShow", s.cfg.Features.MaxItemsToShow))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("limit: %w", err))
+		return
+	}
+
+	recs, err := readRecsCSV(filepath.Join(s.csvDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("CSV file %q not found", name))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if q.Get("header") != "false" && len(recs) > 0 {
+		recs = recs[1:]
+	}
+
+	first := strings.ToLower(q.Get("first"))
+	last := strings.ToLower(q.Get("last"))
+	rows := []csvRow{}
+	for _, rec := range recs {
+		if !strings.Contains(strings.ToLower(rec.first()), first) || !strings.Contains(strings.ToLower(rec.last()), last) {
+			continue
+		}
+		rows = append(rows, csvRow{First: rec.first(), Last: rec.last()})
+	}
+
+	// Compare against what is left instead of computing offset+limit, which
+	// overflows for huge limits.
+	total := len(rows)
+	start, end := min(offset, total), total
+	if limit < total-start {
+		end = start + limit
+	}
+	rows = rows[start:end]
+	writeJSON(w, http.StatusOK, map[string]any{
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+		"rows":   rows,
+	})
+}
+
+// getConfig handles GET /config.
+func (s *apiServer) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Redacted())
+}
+
+// healthz handles GET /healthz.
+func (s *apiServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz handles GET /readyz.
+func (s *apiServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if s.shuttingDown.Load() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("shutting down"))
+		return
+	}
+	// Reading the first user is enough to know the store works.
+	err := s.users.Iterate(r.Context(), func(User) error {
+		return errStopIteration
+	})
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if _, err := os.Stat(s.csvDir); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// intParam parses a non-negative integer query parameter, returning def if
+// it is empty.
+func intParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a non-negative number")
+	}
+	return n, nil
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError writes err as a JSON error response.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// runServe implements the serve subcommand. It runs the HTTP API until the
+// context is cancelled (SIGINT or SIGTERM), then shuts down gracefully:
+// it stops accepting connections and waits for running requests to finish.
+func runServe(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fset.String("addr", ":8080", "address to listen on")
+	backend := fset.String("storage", "", "user storage backend: file, memory, bolt or mysql (default from the config)")
+	usersFile := fset.String("users", "", "file with the initial user records (default from the config)")
+	processedFile := fset.String("processed", "", "file or database the user records are stored in (default from the config)")
+	csvDir := fset.String("csv", "csv_data", "directory with the CSV files")
+	cfgPath := fset.String("config", config.DefaultPath, "configuration file")
+	grace := fset.Duration("grace", 10*time.Second, "how long to wait for running requests on shutdown")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+
+	// Flags override the storage section of the configuration.
+	if *backend != "" {
+		cfg.Storage.Backend = *backend
+	}
+	if *usersFile != "" {
+		cfg.Storage.Source = *usersFile
+	}
+	if *processedFile != "" {
+		cfg.Storage.Path = *processedFile
+	}
+	users, err := newUserStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer users.Close()
+
+	featureFlags, err := flags.Load(*cfgPath)
+	if err != nil {
+		return err
+	}
+	go featureFlags.Watch(ctx, 5*time.Second, func(err error) {
+		if err != nil {
+			slog.Error("Reloading feature flags failed", "err", err)
+			return
+		}
+		slog.Info("Reloaded feature flags", "flags", featureFlags.Names())
+	})
+
+	s := &apiServer{
+		users:  users,
+		csvDir: *csvDir,
+		cfg:    cfg,
+		flags:  featureFlags,
+	}
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Run the server in a goroutine, so we can wait for either the server
+	// to fail or the context to be cancelled.
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", *addr, "storage", cfg.Storage.Backend)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down", "grace", *grace)
+	s.shuttingDown.Store(true)
+
+	// The signal context is already cancelled, so the shutdown needs a
+	// fresh context for its own deadline.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	// ListenAndServe returns http.ErrServerClosed after a Shutdown.
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go_for_devops/config"
+	"go_for_devops/flags"
+)
+
+// csvServer returns an API server whose CSV directory holds people.csv
+// with a header and five rows.
+func csvServer(t *testing.T) http.Handler {
+	dir := t.TempDir()
+	data := "first,last\nAda,Lovelace\nAlan,Turing\nGrace,Hopper\nLinus,Torvalds\nKen,Thompson\n"
+	if err := os.WriteFile(filepath.Join(dir, "people.csv"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Features.MaxItemsToShow = 2
+	s := &apiServer{csvDir: dir, cfg: &cfg, flags: flags.New(nil)}
+	return s.routes()
+}
+
+func TestQueryCSVPaging(t *testing.T) {
+	h := csvServer(t)
+	tests := []struct {
+		query string
+		want  string // last names of the returned rows
+	}{
+		{"", "Lovelace Turing"},
+		{"?limit=10", "Lovelace Turing Hopper Torvalds Thompson"},
+		{"?offset=3", "Torvalds Thompson"},
+		{"?offset=4&limit=2", "Thompson"},
+		{"?offset=5", ""},
+		{"?offset=100&limit=1", ""},
+		{"?limit=0", ""},
+		{"?offset=5&limit=9223372036854775807", ""},
+		{"?offset=1&limit=9223372036854775807", "Turing Hopper Torvalds Thompson"},
+		{"?offset=9223372036854775807&limit=9223372036854775807", ""},
+		{"?first=a&limit=10", "Lovelace Turing Hopper"},
+		{"?header=false&limit=1", "last"}, // the header is a row
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/csv/people.csv"+tt.query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Rows []csvRow `json:"rows"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range resp.Rows {
+				got = append(got, r.Last)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("rows %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryCSVBadRequests(t *testing.T) {
+	h := csvServer(t)
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/csv/people.csv?offset=-1", http.StatusBadRequest},
+		{"/csv/people.csv?limit=-1", http.StatusBadRequest},
+		{"/csv/people.csv?limit=lots", http.StatusBadRequest},
+		{"/csv/people.csv?offset=99999999999999999999", http.StatusBadRequest},
+		{"/csv/.hidden.csv", http.StatusBadRequest},
+		{"/csv/people.txt", http.StatusBadRequest},
+		{"/csv/missing.csv", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.path, rec.Code, tt.code)
+		}
+	}
+}
+
+// usersServer returns an API server backed by a memory store with the
+// user mario:1.
+func usersServer(t *testing.T) (http.Handler, *memoryUserStore) {
+	store := newMemoryUserStore()
+	if err := store.Put(context.Background(), User{Name: "mario", ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	s := &apiServer{users: store, cfg: &cfg, flags: flags.New(nil)}
+	return s.routes(), store
+}
+
+// serve sends a request with a JSON body, or a text/plain body if
+// contentType says so, and returns the response.
+func serve(h http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCreateUser(t *testing.T) {
+	h, store := usersServer(t)
+
+	rec := serve(h, "POST", "/users", "", `{"name": " luigi ", "id": 2}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/users/2" {
+		t.Errorf("Location %q, want /users/2", loc)
+	}
+	if u, err := store.Get(context.Background(), 2); err != nil || u.Name != "luigi" {
+		t.Errorf("stored %v, %v, want luigi:2", u, err)
+	}
+
+	// The ID may be a string, as long as it is a number.
+	if rec := serve(h, "POST", "/users", "", `{"name": "peach", "id": "3"}`); rec.Code != http.StatusCreated {
+		t.Errorf("ID as a string: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(h, "POST", "/users", "", `{"name": "wario", "id": 1}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate ID: status %d, want 409", rec.Code)
+	}
+	if u, _ := store.Get(context.Background(), 1); u.Name != "mario" {
+		t.Errorf("the duplicate replaced the user with %v", u)
+	}
+}
+
+func TestPutUser(t *testing.T) {
+	h, store := usersServer(t)
+
+	// Replacing an existing user returns 200, creating one 201.
+	if rec := serve(h, "PUT", "/users/1", "", `{"name": "super mario"}`); rec.Code != http.StatusOK {
+		t.Errorf("replace: status %d: %s", rec.Code, rec.Body)
+	}
+	if u, _ := store.Get(context.Background(), 1); u.Name != "super mario" {
+		t.Errorf("stored %v after replacing", u)
+	}
+	if rec := serve(h, "PUT", "/users/7", "", `{"name": "toad", "id": 7}`); rec.Code != http.StatusCreated {
+		t.Errorf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	if _, err := store.Get(context.Background(), 7); err != nil {
+		t.Errorf("the created user is missing: %v", err)
+	}
+}
+
+func TestUserRecordBody(t *testing.T) {
+	h, store := usersServer(t)
+	rec := serve(h, "POST", "/users", "text/plain; charset=utf-8", "yoshi:4\n")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if u, err := store.Get(context.Background(), 4); err != nil || u.Name != "yoshi" {
+		t.Errorf("stored %v, %v, want yoshi:4", u, err)
+	}
+	if rec := serve(h, "PUT", "/users/4", "text/plain", "yoshi:5"); rec.Code != http.StatusBadRequest {
+		t.Errorf("record with another ID: status %d, want 400", rec.Code)
+	}
+}
+
+func TestUserWriteBadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"ID mismatch", "PUT", "/users/1", "", `{"name": "mario", "id": 2}`, http.StatusBadRequest},
+		{"non-numeric path ID", "PUT", "/users/one", "", `{"name": "mario"}`, http.StatusBadRequest},
+		{"non-numeric body ID", "POST", "/users", "", `{"name": "mario", "id": "one"}`, http.StatusBadRequest},
+		{"fractional ID", "POST", "/users", "", `{"name": "mario", "id": 1.5}`, http.StatusBadRequest},
+		{"missing ID", "POST", "/users", "", `{"name": "mario"}`, http.StatusBadRequest},
+		{"missing name", "POST", "/users", "", `{"id": 9}`, http.StatusBadRequest},
+		{"empty name", "POST", "/users", "", `{"name": "  ", "id": 9}`, http.StatusBadRequest},
+		{"colon in name", "POST", "/users", "", `{"name": "a:b", "id": 9}`, http.StatusBadRequest},
+		{"line break in name", "PUT", "/users/9", "", `{"name": "a\nb"}`, http.StatusBadRequest},
+		{"invalid JSON", "POST", "/users", "", `{"name": `, http.StatusBadRequest},
+		{"invalid record", "POST", "/users", "text/plain", "a:b:9", http.StatusBadRequest},
+		{"record with a non-numeric ID", "POST", "/users", "text/plain", "mario:one", http.StatusBadRequest},
+		{"oversized JSON", "POST", "/users", "", `{"name": "` + strings.Repeat("m", maxUserBody) + `", "id": 9}`, http.StatusRequestEntityTooLarge},
+		{"oversized record", "POST", "/users", "text/plain", strings.Repeat("m", maxUserBody) + ":9", http.StatusRequestEntityTooLarge},
+		{"non-numeric delete ID", "DELETE", "/users/one", "", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store := usersServer(t)
+			rec := serve(h, tt.method, tt.path, tt.contentType, tt.body)
+			if rec.Code != tt.code {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+			// A rejected request changes nothing.
+			if users, _ := store.List(context.Background()); len(users) != 1 || users[0] != (User{Name: "mario", ID: 1}) {
+				t.Errorf("the store has %v", users)
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	h, store := usersServer(t)
+	if rec := serve(h, "DELETE", "/users/1", "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("status %d, want 204", rec.Code)
+	}
+	if _, err := store.Get(context.Background(), 1); !errors.Is(err, errUserNotFound) {
+		t.Errorf("the user is still there: %v", err)
+	}
+	if rec := serve(h, "DELETE", "/users/1", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", rec.Code)
+	}
+	if rec := serve(h, "GET", "/users/1", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: status %d, want 404", rec.Code)
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"strconv"
 	"strings"
+
+	"go_for_devops/pipeline"
 )
 
 // Define a User struct.
 type User struct {
-	Name string
-	ID   int
+	Name string `json:"name"`
+	ID   int    `json:"id"`
 	err  error
 }
 
@@ -38,86 +41,166 @@ func getUser(s string) (User, error) {
 		return User{}, fmt.Errorf("record (%s) had a non-numeric ID", s)
 	}
 
-	// Return a new User struct.
-	return User{Name: strings.TrimSpace(sp[0]), ID: id, err: nil}, nil
+	// Return a new User struct, if it is valid.
+	u := User{Name: strings.TrimSpace(sp[0]), ID: id, err: nil}
+	if err := u.validate(); err != nil {
+		return User{}, fmt.Errorf("record (%s) is invalid: %w", s, err)
+	}
+	return u, nil
+}
+
+// Validate the user, so it can be written as a "name:id" record and read back.
+func (u User) validate() error {
+	if strings.TrimSpace(u.Name) == "" {
+		return errors.New("name cannot be empty")
+	}
+	// A colon or a line break in the name would break the record format.
+	if strings.ContainsAny(u.Name, ":\r\n") {
+		return errors.New("name cannot contain colons or line breaks")
+	}
+	return nil
 }
 
 // Read in a stream andw rites the User records to a channel.
 // decodeUsers reads data from the provided reader and decodes it into User structs.
 // It returns a channel of User structs that are read from the reader.
 // The channel has a buffer of 1 to allow non-blocking sending of User structs.
-// The function runs in a separate goroutine and closes the channel when it completes.
+// The decoding runs in separate goroutines and the channel is closed when it completes.
 // If the provided context is canceled, it sends a User struct with the error set to the context error.
 // If there is an error while decoding a line of data, it sends a User struct with the error set to the decoding error.
 func decodeUsers(ctx context.Context, r io.Reader) chan User {
 	// Create a channel of User structs, with a buffer of 1.
 	ch := make(chan User, 1)
 
+	// The pipeline package runs every step in its own goroutine and
+	// connects the steps with channels: read the lines, skip the
+	// comments, decode the records and send the users to ch.
+	// @see pipeline/pipeline.go
+	p := pipeline.New(ctx, "decode_users")
+	records := decodeUserRecords(p, r)
+
+	// Send the User structs on the channel, and stop at the first
+	// invalid record.
+	var sentErr error
+	pipeline.Sink(records, "send", func(ctx context.Context, rec userRecord) error {
+		u := rec.User
+		select {
+		case ch <- u:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		sentErr = u.err
+		return u.err
+	})
+
 	go func() {
-		// Defer the closing of the channel until the function completes.
+		// Defer the closing of the channel until the pipeline completes.
 		defer close(ch)
 
-		// Create a new Scanner using the bufio (buffer input/output) package.
-		// Scanner provides a convenient interface for reading data such as a file of
-		// newline-delimited lines of text.
-		scanner := bufio.NewScanner(r)
-
-		// Iterate over the lines of the input file.
-		// By default, the scanner splits the input into lines using the newline character.
-		// The io.Reder returns an error, io.EOF, when the end of the file is reached.
-		// This will stop the loop.
-		//
-		// During the loop, Scanner will return the bytes read from the input file.
-		// They can be retrieved with the Text() method.
-		for scanner.Scan() {
-			// If the provided context is canceled, it sends a User
-			// struct with the error set to the context error.
-			if ctx.Err() != nil {
-				ch <- User{err: ctx.Err()}
-				return
-			}
-
-			// Decode the line into a User struct.
-			fmt.Printf("Current line being processed: %s\n", scanner.Text())
-
-			// If this line is a comment (indicated by either `//` or `#`), skip it.
-			if strings.HasPrefix(scanner.Text(), "//") || strings.HasPrefix(scanner.Text(), "#") {
-				fmt.Printf("Skip the current line (%s) - it is a comment\n", scanner.Text())
-				continue
-			}
-
-			u, err := getUser(scanner.Text())
-			// If there is an error while decoding a line of data, it sends a User
-			// struct with the error set to the decoding error.
-			if err != nil {
-				u.err = err
-				ch <- u
-				return
-			}
-
-			// Send the User struct on the channel.
-			ch <- u
+		// Other errors, such as a canceled context or a failed read, are
+		// sent as a User struct with the error set, like decoding errors.
+		if err := p.Wait(); err != nil && err != sentErr {
+			ch <- User{err: err}
 		}
 	}()
 
 	return ch
 }
 
-// Write a user record into a Writer (e.g. a file.)
-func writeUser(ctx context.Context, w io.Writer, u User) error {
-	if ctx.Err() != nil {
-		return ctx.Err()
+// followUsers decodes the user records of the file at path like decodeUsers,
+// but keeps following the file like `tail -f`: users appended to the file
+// are sent on the channel until the context is canceled, even if the file
+// is rotated or truncated (see follow.go).
+//
+// Unlike decodeUsers, an invalid record does not end the decoding. It is
+// sent as a User struct with a *userRecordError, and the following records
+// are decoded as usual. The channel is closed after a User struct with the
+// error that ended the decoding, usually the context error.
+func followUsers(ctx context.Context, path string, opts followOptions) (chan User, error) {
+	p := pipeline.New(ctx, "follow_users")
+	// Use the context of the pipeline, so reading stops if a stage fails.
+	r, err := openFollow(p.Context(), path, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// Write the user record to the writer.
-	if _, err := w.Write([]byte(u.String())); err != nil {
-		return err
-	}
+	ch := make(chan User, 1)
+	records := decodeUserRecords(p, r)
+	pipeline.Sink(records, "send", func(ctx context.Context, rec userRecord) error {
+		u := rec.User
+		if u.err != nil {
+			u.err = &userRecordError{Line: rec.Line.Num, Err: u.err}
+		}
+		select {
+		case ch <- u:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
 
-	// Write a newline character to separate the records.
-	if _, err := w.Write([]byte("\n")); err != nil {
-		return err
-	}
+	go func() {
+		defer close(ch)
+		err := p.Wait()
+		// All stages have returned, so the reader is no longer in use.
+		r.Close()
+		ch <- User{err: err}
+	}()
 
-	return nil
+	return ch, nil
+}
+
+// userRecordError is the error of an invalid user record.
+type userRecordError struct {
+	// Line is the line number of the record. When following a file, it
+	// keeps counting across rotations.
+	Line int
+	Err  error
+}
+
+func (e *userRecordError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *userRecordError) Unwrap() error {
+	return e.Err
+}
+
+// userRecord is a decoded user and the line it was read from, e.g. to
+// continue reading after it (see cmd_import.go).
+type userRecord struct {
+	User User
+	Line pipeline.Line
+}
+
+// decodeUserRecords adds the stages that decode the user records of r to
+// the pipeline p. Comment lines are skipped. An invalid record is passed on
+// with the error set on its User, so the users before it still reach the
+// end of the pipeline, and the last stage decides whether to stop.
+func decodeUserRecords(p *pipeline.Pipeline, r io.Reader) pipeline.Stream[userRecord] {
+	lines := pipeline.Lines(p, "read", r)
+
+	// If a line is a comment (indicated by either `//` or `#`), skip it.
+	records := pipeline.Filter(lines, "skip_comments", func(l pipeline.Line) bool {
+		userLinesRead.Inc()
+		slog.Debug("Decoding user record", "line", l.Text)
+		if strings.HasPrefix(l.Text, "//") || strings.HasPrefix(l.Text, "#") {
+			slog.Debug("Skipping comment line", "line", l.Text)
+			usersSkipped.Inc()
+			return false
+		}
+		return true
+	})
+
+	// Decode the line into a User struct.
+	return pipeline.Map(records, "decode", func(_ context.Context, l pipeline.Line) (userRecord, error) {
+		u, err := getUser(l.Text)
+		if err != nil {
+			usersRejected.Inc()
+			u.err = err
+		} else {
+			usersDecoded.Inc()
+		}
+		return userRecord{User: u, Line: l}, nil
+	})
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go_for_devops/config"
+	"go_for_devops/db"
+)
+
+/**
+* Storage backends for user records.
+*
+* UserStore hides where users are kept. There are four implementations:
+* - file:   the colon-separated text file read by decodeUsers (userstore_file.go)
+* - memory: a map, e.g. for tests or throw-away runs
+* - bolt:   an embedded bbolt key-value database (userstore_bolt.go)
+* - mysql:  the users table of the configured database (userstore_sql.go)
+*
+* The backend is selected by the storage section of config.json.
+**/
+
+// errUserNotFound is returned when a user ID does not exist in a store.
+var errUserNotFound = errors.New("user not found")
+
+// errStopIteration can be returned by the function passed to Iterate to
+// stop early. Iterate then returns nil.
+var errStopIteration = errors.New("stop iteration")
+
+// UserStore stores User records by ID.
+type UserStore interface {
+	// Get returns the user with the given ID, or errUserNotFound.
+	Get(ctx context.Context, id int) (User, error)
+	// List returns all users.
+	List(ctx context.Context) ([]User, error)
+	// Put creates the user, or replaces the user with the same ID.
+	Put(ctx context.Context, u User) error
+	// Delete removes the user with the given ID, or returns errUserNotFound.
+	Delete(ctx context.Context, id int) error
+	// Iterate calls fn for every user until fn returns an error.
+	Iterate(ctx context.Context, fn func(User) error) error
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// newUserStore creates the UserStore selected by the storage section of
+// the configuration. The mysql backend connects to the configured database
+// and migrates its schema.
+func newUserStore(ctx context.Context, cfg *config.Config) (UserStore, error) {
+	switch cfg.Storage.Backend {
+	case "file", "":
+		policy, err := parseSyncPolicy(cfg.Storage.Sync)
+		if err != nil {
+			return nil, err
+		}
+		return &fileUserStore{path: cfg.Storage.Path, source: cfg.Storage.Source, sync: policy}, nil
+	case "memory":
+		return newMemoryUserStore(), nil
+	case "bolt":
+		return openBoltUserStore(cfg.Storage.Path)
+	case "mysql":
+		conn, err := db.OpenConfig(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := conn.Migrate(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return openSQLUserStore(conn), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want file, memory, bolt or mysql)", cfg.Storage.Backend)
+	}
+}
+
+// listUsers collects all users of a store through Iterate. Stores can use it
+// to implement List.
+func listUsers(ctx context.Context, s UserStore) ([]User, error) {
+	users := []User{}
+	err := s.Iterate(ctx, func(u User) error {
+		users = append(users, u)
+		return nil
+	})
+	return users, err
+}
+
+// memoryUserStore keeps users in a map. Its contents are lost when the
+// process exits.
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[int]User
+}
+
+// newMemoryUserStore creates an empty memoryUserStore.
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{users: map[int]User{}}
+}
+
+// Get implements UserStore.
+func (s *memoryUserStore) Get(ctx context.Context, id int) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return User{}, errUserNotFound
+	}
+	return u, nil
+}
+
+// List implements UserStore.
+func (s *memoryUserStore) List(ctx context.Context) ([]User, error) {
+	return listUsers(ctx, s)
+}
+
+// Put implements UserStore.
+func (s *memoryUserStore) Put(ctx context.Context, u User) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.ID] = u
+	return nil
+}
+
+// Delete implements UserStore.
+func (s *memoryUserStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return errUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// Iterate implements UserStore. Users are visited in order of their ID.
+// fn is called on a snapshot, so it may call other methods of the store.
+func (s *memoryUserStore) Iterate(ctx context.Context, fn func(User) error) error {
+	s.mu.RLock()
+	users := make([]User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	for _, u := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(u); err != nil {
+			if errors.Is(err, errStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements UserStore.
+func (s *memoryUserStore) Close() error {
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// usersBucket is the bbolt bucket that holds the user records.
+var usersBucket = []byte("users")
+
+// boltUserStore stores users in an embedded bbolt database. Each user is
+// a key-value pair: the key is the ID, the value the "name:id" record.
+//
+// bbolt allows only one process to open the database at a time, and
+// serialises writes itself, so no extra locking is needed.
+type boltUserStore struct {
+	db *bolt.DB
+}
+
+// openBoltUserStore opens (or creates) the database file at path.
+func openBoltUserStore(path string) (*boltUserStore, error) {
+	// Without a timeout, Open blocks forever if another process holds
+	// the database.
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltUserStore{db: db}, nil
+}
+
+// userKey encodes an ID as a key. bbolt sorts keys byte-wise, so the ID is
+// stored big-endian with the sign bit flipped; this sorts negative IDs
+// before positive ones.
+func userKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id)^(1<<63))
+	return key
+}
+
+// Get implements UserStore.
+func (s *boltUserStore) Get(ctx context.Context, id int) (User, error) {
+	var u User
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(usersBucket).Get(userKey(id))
+		if v == nil {
+			return errUserNotFound
+		}
+		var err error
+		u, err = getUser(string(v))
+		return err
+	})
+	return u, err
+}
+
+// List implements UserStore.
+func (s *boltUserStore) List(ctx context.Context) ([]User, error) {
+	return listUsers(ctx, s)
+}
+
+// Put implements UserStore.
+func (s *boltUserStore) Put(ctx context.Context, u User) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).Put(userKey(u.ID), []byte(u.String()))
+	})
+}
+
+// Delete implements UserStore.
+func (s *boltUserStore) Delete(ctx context.Context, id int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usersBucket)
+		if b.Get(userKey(id)) == nil {
+			return errUserNotFound
+		}
+		return b.Delete(userKey(id))
+	})
+}
+
+// Iterate implements UserStore. Users are visited in order of their ID.
+//
+// fn runs inside a read transaction, so it must not write to the store:
+// bbolt may deadlock if a goroutine opens a write transaction while it
+// holds a read transaction.
+func (s *boltUserStore) Iterate(ctx context.Context, fn func(User) error) error {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			u, err := getUser(string(v))
+			if err != nil {
+				return err
+			}
+			return fn(u)
+		})
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Close implements UserStore.
+func (s *boltUserStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileUserStore stores users in the colon-separated file format (e.g.
+// users_processed.txt). Until the first update, it reads the records of
+// the source file (e.g. users_source.txt).
+//
+// Updates rewrite the whole file. They are serialised with a mutex (for
+// goroutines in this process) and a lock file (for other processes), and
+// the new content is renamed into place, so readers never see a partially
+// written file.
+type fileUserStore struct {
+	path   string
+	source string
+	sync   syncPolicy
+
+	mu sync.Mutex
+}
+
+// open opens the file to read the records from.
+func (f *fileUserStore) open() (*os.File, error) {
+	file, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		file, err = os.Open(f.source)
+	}
+	return file, err
+}
+
+// Iterate implements UserStore. Users are visited in file order.
+func (f *fileUserStore) Iterate(ctx context.Context, fn func(User) error) error {
+	file, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Cancel the decoder and drain its channel when we stop early, so
+	// the goroutine in decodeUsers does not leak.
+	ctx, cancel := context.WithCancel(ctx)
+	ch := decodeUsers(ctx, file)
+	defer func() {
+		cancel()
+		for range ch {
+		}
+	}()
+
+	for u := range ch {
+		if u.err != nil {
+			return u.err
+		}
+		if err := fn(u); err != nil {
+			if errors.Is(err, errStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// List implements UserStore.
+func (f *fileUserStore) List(ctx context.Context) ([]User, error) {
+	return listUsers(ctx, f)
+}
+
+// Get implements UserStore.
+func (f *fileUserStore) Get(ctx context.Context, id int) (User, error) {
+	var found *User
+	err := f.Iterate(ctx, func(u User) error {
+		if u.ID == id {
+			found = &u
+			return errStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	if found == nil {
+		return User{}, errUserNotFound
+	}
+	return *found, nil
+}
+
+// update reads all records, passes them to fn and writes the records fn
+// returns. If fn returns an error, the file is left unchanged.
+func (f *fileUserStore) update(ctx context.Context, fn func([]User) ([]User, error)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Lock a separate file, because the data file itself is replaced
+	// by the rename below.
+	lock, err := os.OpenFile(f.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	users, err := f.List(ctx)
+	if err != nil {
+		return err
+	}
+	users, err = fn(users)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Remove the temporary file if anything goes wrong. After a
+	// successful rename this is a no-op.
+	defer os.Remove(tmp.Name())
+
+	// With the default sync policy, the new content is synced once at the
+	// end, so the rename below never replaces the data file with a file
+	// whose content is not on the disk yet.
+	w := newUserWriter(tmp, userWriterOptions{Sync: f.sync})
+	for _, u := range users {
+		if err := w.Write(ctx, u); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates files with mode 0600, use the usual mode instead.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// Put implements UserStore.
+func (f *fileUserStore) Put(ctx context.Context, u User) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	return f.update(ctx, func(users []User) ([]User, error) {
+		for i, existing := range users {
+			if existing.ID == u.ID {
+				users[i] = u
+				return users, nil
+			}
+		}
+		return append(users, u), nil
+	})
+}
+
+// Delete implements UserStore.
+func (f *fileUserStore) Delete(ctx context.Context, id int) error {
+	return f.update(ctx, func(users []User) ([]User, error) {
+		for i, existing := range users {
+			if existing.ID == id {
+				return append(users[:i], users[i+1:]...), nil
+			}
+		}
+		return nil, errUserNotFound
+	})
+}
+
+// Close implements UserStore.
+func (f *fileUserStore) Close() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go_for_devops/db"
+)
+
+// sqlUserStore stores users in the users table of the SQL database.
+type sqlUserStore struct {
+	db    *db.DB
+	users *db.Users
+}
+
+// openSQLUserStore wraps a database connection, whose schema must be
+// migrated, in a UserStore.
+func openSQLUserStore(conn *db.DB) *sqlUserStore {
+	return &sqlUserStore{db: conn, users: conn.Users()}
+}
+
+// Get implements UserStore.
+func (s *sqlUserStore) Get(ctx context.Context, id int) (User, error) {
+	row, err := s.users.Get(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return User{}, errUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return User{Name: row.Name, ID: row.ID}, nil
+}
+
+// List implements UserStore.
+func (s *sqlUserStore) List(ctx context.Context) ([]User, error) {
+	return listUsers(ctx, s)
+}
+
+// Put implements UserStore.
+func (s *sqlUserStore) Put(ctx context.Context, u User) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	return s.users.Put(ctx, db.User{ID: u.ID, Name: u.Name})
+}
+
+// Delete implements UserStore.
+func (s *sqlUserStore) Delete(ctx context.Context, id int) error {
+	err := s.users.Delete(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return errUserNotFound
+	}
+	return err
+}
+
+// Iterate implements UserStore. Users are visited in order of their ID.
+func (s *sqlUserStore) Iterate(ctx context.Context, fn func(User) error) error {
+	err := s.users.Iterate(ctx, func(row db.User) error {
+		return fn(User{Name: row.Name, ID: row.ID})
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Close implements UserStore.
+func (s *sqlUserStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// userStores creates an empty store of every backend that works without
+// a server.
+var userStores = []struct {
+	name string
+	open func(t *testing.T) UserStore
+	// sorted is true if Iterate visits users by ID, false if in the
+	// order they were added.
+	sorted bool
+}{
+	{"memory", func(t *testing.T) UserStore { return newMemoryUserStore() }, true},
+	{"file", func(t *testing.T) UserStore {
+		dir := t.TempDir()
+		source := filepath.Join(dir, "users_source.txt")
+		if err := os.WriteFile(source, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return &fileUserStore{path: filepath.Join(dir, "users_processed.txt"), source: source}
+	}, false},
+	{"bolt", func(t *testing.T) UserStore {
+		s, err := openBoltUserStore(filepath.Join(t.TempDir(), "users.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}, true},
+}
+
+// userIDs returns the IDs of the users in the order of Iterate.
+func userIDs(t *testing.T, s UserStore) string {
+	t.Helper()
+	var ids []int
+	err := s.Iterate(context.Background(), func(u User) error {
+		ids = append(ids, u.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprint(ids)
+}
+
+func TestUserStores(t *testing.T) {
+	ctx := context.Background()
+	for _, backend := range userStores {
+		t.Run(backend.name, func(t *testing.T) {
+			s := backend.open(t)
+			defer s.Close()
+
+			if _, err := s.Get(ctx, 1); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Get in an empty store: %v, want errUserNotFound", err)
+			}
+			if users, err := s.List(ctx); err != nil || users == nil || len(users) != 0 {
+				t.Errorf("List of an empty store: %#v, %v, want an empty slice", users, err)
+			}
+
+			for _, u := range []User{{Name: "c", ID: 30}, {Name: "a", ID: 10}, {Name: "neg", ID: -5}, {Name: "b", ID: 20}} {
+				if err := s.Put(ctx, u); err != nil {
+					t.Fatalf("Put(%v): %v", u, err)
+				}
+			}
+			if u, err := s.Get(ctx, 10); err != nil || u != (User{Name: "a", ID: 10}) {
+				t.Errorf("Get(10) = %v, %v", u, err)
+			}
+
+			want := "[30 10 -5 20]"
+			if backend.sorted {
+				want = "[-5 10 20 30]"
+			}
+			if got := userIDs(t, s); got != want {
+				t.Errorf("Iterate visited %s, want %s", got, want)
+			}
+
+			// Put replaces the user with the same ID, in place.
+			if err := s.Put(ctx, User{Name: "A", ID: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if u, _ := s.Get(ctx, 10); u.Name != "A" {
+				t.Errorf("Get(10) = %v after replacing", u)
+			}
+			if got := userIDs(t, s); got != want {
+				t.Errorf("Iterate visited %s after replacing, want %s", got, want)
+			}
+
+			// errStopIteration ends Iterate without an error, other
+			// errors are returned.
+			var n int
+			err := s.Iterate(ctx, func(User) error {
+				if n++; n == 2 {
+					return errStopIteration
+				}
+				return nil
+			})
+			if err != nil || n != 2 {
+				t.Errorf("Iterate stopped after %d users with %v, want 2 and nil", n, err)
+			}
+			boom := errors.New("boom")
+			if err := s.Iterate(ctx, func(User) error { return boom }); !errors.Is(err, boom) {
+				t.Errorf("Iterate returned %v, want the error of fn", err)
+			}
+
+			for _, u := range []User{{Name: "", ID: 1}, {Name: " ", ID: 2}, {Name: "a:b", ID: 3}, {Name: "a\nb", ID: 4}} {
+				if err := s.Put(ctx, u); err == nil {
+					t.Errorf("Put(%q) succeeded", u.Name)
+				}
+			}
+
+			if err := s.Delete(ctx, 20); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get(ctx, 20); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Get after Delete: %v, want errUserNotFound", err)
+			}
+			if err := s.Delete(ctx, 20); !errors.Is(err, errUserNotFound) {
+				t.Errorf("second Delete: %v, want errUserNotFound", err)
+			}
+			if users, err := s.List(ctx); err != nil || len(users) != 3 {
+				t.Errorf("List = %v, %v, want 3 users", users, err)
+			}
+		})
+	}
+}
+
+func TestFileUserStoreSource(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "users_source.txt")
+	if err := os.WriteFile(source, []byte("mario:1\n# a comment\nluigi:2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &fileUserStore{path: filepath.Join(dir, "users_processed.txt"), source: source}
+
+	// Until path exists, the users come from the source.
+	if u, err := s.Get(ctx, 2); err != nil || u.Name != "luigi" {
+		t.Errorf("Get(2) = %v, %v, want luigi from the source", u, err)
+	}
+
+	// The first update writes path, and leaves the source alone.
+	if err := s.Put(ctx, User{Name: "peach", ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil || string(data) != "mario:1\nluigi:2\npeach:3\n" {
+		t.Errorf("path contains %q, %v", data, err)
+	}
+	if data, _ := os.ReadFile(source); string(data) != "mario:1\n# a comment\nluigi:2\n" {
+		t.Errorf("the source changed to %q", data)
+	}
+
+	// From now on, path is read.
+	os.WriteFile(source, []byte("bowser:9\n"), 0644)
+	if got := userIDs(t, s); got != "[1 2 3]" {
+		t.Errorf("Iterate visited %s, want the users of path", got)
+	}
+}
+
+func TestFileUserStoreMissing(t *testing.T) {
+	dir := t.TempDir()
+	s := &fileUserStore{path: filepath.Join(dir, "out.txt"), source: filepath.Join(dir, "missing.txt")}
+	if _, err := s.Get(context.Background(), 1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get without any file: %v, want os.ErrNotExist", err)
+	}
+}
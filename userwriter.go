@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/**
+* Batching user writer.
+*
+* Writing every record straight to the file means a system call per user.
+* userWriter collects the records in memory and writes them in one call per
+* batch. A batch is written when it has enough records or bytes, or when
+* its oldest record has waited for the flush interval.
+*
+* Writes happen in the goroutine that adds the record which fills the
+* batch, while holding the lock, so a producer that is faster than the disk
+* is slowed down to its pace instead of filling the memory.
+**/
+
+// syncPolicy decides when a userWriter calls Sync on its file, which makes
+// the operating system write its caches to the disk. Syncing is slow, but
+// without it, records that were written can still be lost on a power cut.
+type syncPolicy int
+
+const (
+	// syncNever leaves it to the operating system.
+	syncNever syncPolicy = iota
+	// syncBatch syncs after every batch.
+	syncBatch
+	// syncClose syncs once, when the writer is closed.
+	syncClose
+)
+
+// String returns the name of the policy, as accepted by parseSyncPolicy.
+func (p syncPolicy) String() string {
+	switch p {
+	case syncBatch:
+		return "batch"
+	case syncClose:
+		return "close"
+	default:
+		return "never"
+	}
+}
+
+// parseSyncPolicy parses "never", "batch" or "close".
+func parseSyncPolicy(s string) (syncPolicy, error) {
+	for _, p := range []syncPolicy{syncNever, syncBatch, syncClose} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return syncNever, fmt.Errorf("unknown sync policy %q (must be never, batch or close)", s)
+}
+
+// userWriterOptions configures a userWriter. Zero values select the
+// defaults.
+type userWriterOptions struct {
+	// BatchSize is the number of records that are written together
+	// (default 256).
+	BatchSize int
+	// MaxBytes writes the batch early once it is this large (default
+	// 64 KiB).
+	MaxBytes int
+	// FlushInterval is the longest time a record waits in the batch. 0
+	// waits until the batch is full or the writer is flushed.
+	FlushInterval time.Duration
+	// Sync is the sync policy (default syncNever).
+	Sync syncPolicy
+}
+
+// userWriteError is returned if a batch could not be written. User is the
+// first record of the batch that did not make it into the file completely.
+type userWriteError struct {
+	User User
+	Err  error
+}
+
+func (e *userWriteError) Error() string {
+	return fmt.Sprintf("writing user %s: %s", e.User, e.Err)
+}
+
+func (e *userWriteError) Unwrap() error {
+	return e.Err
+}
+
+// userWriter writes user records in batches. It is safe for concurrent use.
+type userWriter struct {
+	w    io.Writer
+	opts userWriterOptions
+
+	mu sync.Mutex
+	// buf holds the records of the batch, and ends the offset in buf
+	// where each of them ends.
+	buf     []byte
+	ends    []int
+	pending []User
+	timer   *time.Timer
+	// err is the first error. The writer refuses to write after it,
+	// because the records in the file would have a gap.
+	err    error
+	closed bool
+}
+
+// newUserWriter creates a userWriter that writes to w.
+func newUserWriter(w io.Writer, opts userWriterOptions) *userWriter {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 64 << 10
+	}
+	return &userWriter{w: w, opts: opts}
+}
+
+// Write adds a user to the batch, and writes the batch if it is full.
+func (w *userWriter) Write(ctx context.Context, u User) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// An invalid user would break the record format of the whole file.
+	if err := u.validate(); err != nil {
+		return &userWriteError{User: u, Err: err}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return errors.New("user writer is closed")
+	}
+
+	w.buf = append(w.buf, u.String()...)
+	w.buf = append(w.buf, '\n')
+	w.ends = append(w.ends, len(w.buf))
+	w.pending = append(w.pending, u)
+
+	if len(w.pending) >= w.opts.BatchSize || len(w.buf) >= w.opts.MaxBytes {
+		return w.flushLocked()
+	}
+	// Start the clock with the first record of a batch.
+	if w.timer == nil && w.opts.FlushInterval > 0 {
+		w.timer = time.AfterFunc(w.opts.FlushInterval, w.timedFlush)
+	}
+	return nil
+}
+
+// Flush writes the records of the current batch.
+func (w *userWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flushLocked()
+}
+
+// Close writes the remaining records and, depending on the sync policy,
+// syncs the file. Like gzip.Writer, it does not close the underlying
+// writer, which belongs to the caller.
+func (w *userWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if w.opts.Sync == syncClose {
+		return w.sync()
+	}
+	return nil
+}
+
+// timedFlush writes a batch that has waited for the flush interval. Nobody
+// waits for its result, so an error is kept, together with the time it
+// happened, and returned by the next call of the writer.
+func (w *userWriter) timedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The timer may fire while Write, Flush or Close already handle the
+	// batch, and then find an empty or a new batch.
+	if w.closed || w.err != nil {
+		return
+	}
+	if err := w.flushLocked(); err != nil {
+		w.err = fmt.Errorf("timed flush at %s: %w", time.Now().Format(time.RFC3339Nano), err)
+	}
+}
+
+// flushLocked writes the batch. w.mu must be held.
+func (w *userWriter) flushLocked() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	n, err := w.w.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		// Report the first record that was not written completely.
+		i := 0
+		for i < len(w.ends)-1 && w.ends[i] <= n {
+			i++
+		}
+		w.err = &userWriteError{User: w.pending[i], Err: err}
+		return w.err
+	}
+	usersWritten.Add(float64(len(w.pending)))
+	userBatchesWritten.Inc()
+
+	w.buf, w.ends, w.pending = w.buf[:0], w.ends[:0], w.pending[:0]
+	if w.opts.Sync == syncBatch {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync syncs the underlying writer, if it is a file.
+func (w *userWriter) sync() error {
+	s, ok := w.w.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+	if err := s.Sync(); err != nil {
+		w.err = fmt.Errorf("syncing users: %w", err)
+		return w.err
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFile records the writes and syncs of a userWriter. If limit is
+// positive, it accepts only that many bytes in total and fails with err
+// after that.
+type fakeFile struct {
+	mu     sync.Mutex
+	writes []string
+	// syncsAt is the number of writes at every sync.
+	syncsAt []int
+	limit   int
+	written int
+	err     error
+	syncErr error
+}
+
+func (f *fakeFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(p)
+	if f.limit > 0 && f.written+n > f.limit {
+		n = f.limit - f.written
+	}
+	f.writes = append(f.writes, string(p[:n]))
+	f.written += n
+	if n < len(p) {
+		return n, f.err
+	}
+	return n, nil
+}
+
+func (f *fakeFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.syncsAt = append(f.syncsAt, len(f.writes))
+	return f.syncErr
+}
+
+func (f *fakeFile) numWrites() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.writes)
+}
+
+func (f *fakeFile) content() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.writes, "")
+}
+
+// testUser returns the user with ID i. Its record is 8 bytes long.
+func testUser(i int) User {
+	return User{Name: "user", ID: 100 + i}
+}
+
+func writeUsers(t *testing.T, w *userWriter, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := w.Write(context.Background(), testUser(i)); err != nil {
+			t.Fatalf("writing user %d: %v", i, err)
+		}
+	}
+}
+
+func TestUserWriterBatchSize(t *testing.T) {
+	f := &fakeFile{}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 3})
+	writeUsers(t, w, 0, 7)
+	if n := f.numWrites(); n != 2 {
+		t.Errorf("%d writes after 7 users, want 2 full batches", n)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.numWrites(); n != 3 {
+		t.Errorf("%d writes after Close, want the last batch written", n)
+	}
+	if f.writes[0] != "user:100\nuser:101\nuser:102\n" {
+		t.Errorf("first batch %q", f.writes[0])
+	}
+	if err := w.Write(context.Background(), testUser(8)); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+}
+
+func TestUserWriterMaxBytes(t *testing.T) {
+	f := &fakeFile{}
+	// Records are 9 bytes with the line break, so 3 of them reach 20 bytes.
+	w := newUserWriter(f, userWriterOptions{BatchSize: 100, MaxBytes: 20})
+	writeUsers(t, w, 0, 5)
+	if n := f.numWrites(); n != 1 || len(f.writes[0]) != 27 {
+		t.Errorf("writes %q, want one of 3 records", f.writes)
+	}
+	w.Flush()
+	if n := f.numWrites(); n != 2 {
+		t.Errorf("%d writes after Flush, want 2", n)
+	}
+	// An empty batch is not written.
+	w.Flush()
+	if n := f.numWrites(); n != 2 {
+		t.Errorf("%d writes after a second Flush, want 2", n)
+	}
+}
+
+func TestUserWriterFlushInterval(t *testing.T) {
+	f := &fakeFile{}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 100, FlushInterval: 20 * time.Millisecond})
+	defer w.Close()
+
+	writeUsers(t, w, 0, 2)
+	if n := f.numWrites(); n != 0 {
+		t.Fatalf("%d writes right away, want the batch to wait", n)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for f.numWrites() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if f.content() != "user:100\nuser:101\n" {
+		t.Errorf("after the flush interval: %q", f.content())
+	}
+
+	// The clock starts again with the next record.
+	writeUsers(t, w, 2, 3)
+	time.Sleep(60 * time.Millisecond)
+	if n := f.numWrites(); n != 2 {
+		t.Errorf("%d writes, want a second timed flush", n)
+	}
+}
+
+func TestUserWriterShortWrite(t *testing.T) {
+	// The file takes 2 records and half of the third.
+	diskFull := errors.New("disk full")
+	f := &fakeFile{limit: 22, err: diskFull}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 5})
+
+	writeUsers(t, w, 0, 4)
+	err := w.Write(context.Background(), testUser(4))
+	var we *userWriteError
+	if !errors.As(err, &we) {
+		t.Fatalf("got error %v, want a *userWriteError", err)
+	}
+	if we.User != testUser(2) {
+		t.Errorf("error names %v, want the first user not written completely, %v", we.User, testUser(2))
+	}
+	if !errors.Is(err, diskFull) {
+		t.Errorf("error %v does not wrap the error of the file", err)
+	}
+
+	// The file would have a gap, so every later call fails.
+	if err := w.Write(context.Background(), testUser(5)); !errors.Is(err, diskFull) {
+		t.Errorf("Write after the error: %v", err)
+	}
+	if err := w.Flush(); !errors.Is(err, diskFull) {
+		t.Errorf("Flush after the error: %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, diskFull) {
+		t.Errorf("Close after the error: %v", err)
+	}
+	if n := f.numWrites(); n != 1 {
+		t.Errorf("%d writes, want none after the error", n)
+	}
+}
+
+func TestUserWriterShortWriteWithoutError(t *testing.T) {
+	// A writer that returns n < len(p) without an error breaks the
+	// io.Writer contract, but must not lose records silently.
+	f := &fakeFile{limit: 9}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 2})
+	writeUsers(t, w, 0, 1)
+	err := w.Write(context.Background(), testUser(1))
+	var we *userWriteError
+	if !errors.Is(err, io.ErrShortWrite) || !errors.As(err, &we) || we.User != testUser(1) {
+		t.Errorf("got error %v, want io.ErrShortWrite for the second user", err)
+	}
+}
+
+func TestUserWriterTimedFlushError(t *testing.T) {
+	diskFull := errors.New("disk full")
+	f := &fakeFile{limit: 1, err: diskFull}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+
+	before := time.Now()
+	writeUsers(t, w, 0, 1)
+	deadline := time.Now().Add(2 * time.Second)
+	for f.numWrites() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The error of the timed flush is returned by the next call, and says
+	// where and when it happened.
+	err := w.Write(context.Background(), testUser(1))
+	if err == nil {
+		t.Fatal("Write after a failed timed flush succeeded")
+	}
+	var we *userWriteError
+	if !errors.Is(err, diskFull) || !errors.As(err, &we) || we.User != testUser(0) {
+		t.Errorf("got error %v, want the write error of user 0", err)
+	}
+	rest, ok := strings.CutPrefix(err.Error(), "timed flush at ")
+	if !ok {
+		t.Fatalf("error %q does not mention the timed flush", err)
+	}
+	ts, _, _ := strings.Cut(rest, ": ")
+	if at, perr := time.Parse(time.RFC3339Nano, ts); perr != nil || at.Before(before) || at.After(time.Now()) {
+		t.Errorf("error %q does not have the time of the flush: %v", err, perr)
+	}
+	if err := w.Close(); !errors.Is(err, diskFull) {
+		t.Errorf("Close: %v, want the error of the timed flush", err)
+	}
+}
+
+func TestUserWriterSyncPolicies(t *testing.T) {
+	tests := []struct {
+		policy  syncPolicy
+		syncsAt []int // number of writes at every sync
+	}{
+		{syncNever, nil},
+		{syncBatch, []int{1, 2, 3}},
+		{syncClose, []int{3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			f := &fakeFile{}
+			w := newUserWriter(f, userWriterOptions{BatchSize: 2, Sync: tt.policy})
+			writeUsers(t, w, 0, 5)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(f.syncsAt) != fmt.Sprint(tt.syncsAt) {
+				t.Errorf("synced after writes %v, want %v", f.syncsAt, tt.syncsAt)
+			}
+		})
+	}
+}
+
+func TestUserWriterSyncError(t *testing.T) {
+	f := &fakeFile{syncErr: errors.New("I/O error")}
+	w := newUserWriter(f, userWriterOptions{BatchSize: 1, Sync: syncBatch})
+	if err := w.Write(context.Background(), testUser(0)); err == nil || !strings.Contains(err.Error(), "syncing users") {
+		t.Errorf("got error %v, want the sync error", err)
+	}
+	if err := w.Write(context.Background(), testUser(1)); err == nil {
+		t.Error("Write after a failed sync succeeded")
+	}
+}
+
+func TestUserWriterRejectsInvalidUsers(t *testing.T) {
+	f := &fakeFile{}
+	w := newUserWriter(f, userWriterOptions{})
+	for _, u := range []User{{Name: "", ID: 1}, {Name: "a:b", ID: 2}, {Name: "a\nb", ID: 3}} {
+		if err := w.Write(context.Background(), u); err == nil {
+			t.Errorf("Write(%q) succeeded", u.Name)
+		}
+	}
+	// An invalid user does not stop the writer.
+	writeUsers(t, w, 0, 1)
+	w.Close()
+	if f.content() != "user:100\n" {
+		t.Errorf("file %q", f.content())
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, p := range []syncPolicy{syncNever, syncBatch, syncClose} {
+		if got, err := parseSyncPolicy(p.String()); err != nil || got != p {
+			t.Errorf("parseSyncPolicy(%q) = %v, %v", p, got, err)
+		}
+	}
+	if _, err := parseSyncPolicy("always"); err == nil {
+		t.Error("parseSyncPolicy accepted an unknown policy")
+	}
+}
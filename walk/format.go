@@ -0,0 +1,133 @@
+package walk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Formats are the output formats of NewWriter.
+var Formats = []string{"text", "json", "csv"}
+
+// Writer writes entries in an output format. Call Close after the last
+// entry, to complete the output.
+type Writer interface {
+	Write(e Entry) error
+	Close() error
+}
+
+// NewWriter returns a Writer for one of the Formats:
+//
+//   - text: aligned columns, like `ls -l`
+//   - json: a JSON array of objects
+//   - csv: a header line, and a line per entry
+//
+// The hash column is only written if withHash is set.
+func NewWriter(w io.Writer, format string, withHash bool) (Writer, error) {
+	switch format {
+	case "text":
+		return &textWriter{tw: tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight), withHash: withHash}, nil
+	case "json":
+		return &jsonWriter{w: w, withHash: withHash}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w), withHash: withHash}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (must be text, json or csv)", format)
+}
+
+// textWriter writes aligned columns. tabwriter buffers the lines to align
+// them, so the output appears on Close.
+type textWriter struct {
+	tw       *tabwriter.Writer
+	withHash bool
+}
+
+func (t *textWriter) Write(e Entry) error {
+	// With AlignRight, every cell is right-aligned, so the path is the last
+	// column and not followed by a tab.
+	var err error
+	if t.withHash {
+		_, err = fmt.Fprintf(t.tw, "%s\t%d\t%s\t%s\t %s\n", e.Mode, e.Size, e.ModTime.Format(time.DateTime), e.SHA256, e.Path)
+	} else {
+		_, err = fmt.Fprintf(t.tw, "%s\t%d\t%s\t %s\n", e.Mode, e.Size, e.ModTime.Format(time.DateTime), e.Path)
+	}
+	return err
+}
+
+func (t *textWriter) Close() error {
+	return t.tw.Flush()
+}
+
+// jsonEntry is the JSON form of an Entry.
+type jsonEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// jsonWriter writes the entries as they come, instead of collecting them
+// for json.Marshal, so large trees do not have to fit into memory.
+type jsonWriter struct {
+	w        io.Writer
+	withHash bool
+	n        int
+}
+
+func (j *jsonWriter) Write(e Entry) error {
+	b, err := json.Marshal(jsonEntry{Path: e.Path, Size: e.Size, Mode: e.Mode.String(), ModTime: e.ModTime, SHA256: e.SHA256})
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if j.n == 0 {
+		sep = "[\n  "
+	}
+	j.n++
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, b)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// csvWriter writes a header and a record per entry.
+type csvWriter struct {
+	w        *csv.Writer
+	withHash bool
+	header   bool
+}
+
+func (c *csvWriter) Write(e Entry) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(c.row("path", "size", "mode", "modTime", "sha256")); err != nil {
+			return err
+		}
+	}
+	return c.w.Write(c.row(e.Path, strconv.FormatInt(e.Size, 10), e.Mode.String(), e.ModTime.Format(time.RFC3339), e.SHA256))
+}
+
+// row drops the hash column if there are no hashes.
+func (c *csvWriter) row(fields ...string) []string {
+	if !c.withHash {
+		return fields[:len(fields)-1]
+	}
+	return fields
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
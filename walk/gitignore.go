@@ -0,0 +1,84 @@
+package walk
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ignoreRule is a line of a .gitignore file.
+type ignoreRule struct {
+	// dir is the directory of the .gitignore file. The rule only applies
+	// to paths below it.
+	dir     string
+	pattern string
+	// negate re-includes files ignored by an earlier rule ("!pattern").
+	negate bool
+	// dirOnly only matches directories ("pattern/").
+	dirOnly bool
+}
+
+// readIgnoreFile reads the rules of the .gitignore file in dir, if there is
+// one.
+func readIgnoreFile(fsys fs.FS, dir string) ([]ignoreRule, error) {
+	f, err := fsys.Open(path.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := ignoreRule{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		// A leading backslash escapes a # or ! that is part of the name.
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// Like in Match, a slash at the start or in the middle anchors
+		// the pattern to the directory of the .gitignore file.
+		r.pattern = line
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored reports whether the path p is ignored by the rules. As in git,
+// the last matching rule decides.
+func ignored(rules []ignoreRule, p string, isDir bool) bool {
+	ignore := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel := p
+		if r.dir != "." {
+			if !strings.HasPrefix(p, r.dir+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(p, r.dir+"/")
+		}
+		if Match(r.pattern, rel) {
+			ignore = !r.negate
+		}
+	}
+	return ignore
+}
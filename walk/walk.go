@@ -0,0 +1,238 @@
+// Package walk lists the files of a file tree, filtered by glob patterns,
+// .gitignore files, depth, size and modification time. It works on any
+// fs.FS, e.g. os.DirFS(".") or an embed.FS:
+//
+//	err := walk.Walk(os.DirFS("."), ".", walk.Options{
+//		Include:   []string{"**/*.go"},
+//		Exclude:   []string{"vendor"},
+//		GitIgnore: true,
+//	}, func(e walk.Entry) error {
+//		fmt.Println(e.Path, e.Size)
+//		return nil
+//	})
+//
+// Patterns use the syntax of path.Match, plus "**", which matches any
+// number of directories. As in .gitignore files, a pattern without a slash
+// matches the name of a file or directory at any depth ("*.json"), while a
+// pattern with a slash matches the whole path from the root of the walk
+// ("/go.mod", "csv_data/*.csv", "**/testdata/**").
+package walk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Options selects the files of a walk. The zero value selects all files.
+type Options struct {
+	// Include lists patterns of the files to report. If it is empty, all
+	// files are reported.
+	Include []string
+	// Exclude lists patterns of files and directories to skip. The files
+	// in a skipped directory are not read at all.
+	Exclude []string
+	// GitIgnore skips the files ignored by the .gitignore files in the
+	// tree, and the .git directory.
+	GitIgnore bool
+	// MaxDepth limits how deep the walk goes. 1 only reports the files
+	// directly in the root, 0 means no limit.
+	MaxDepth int
+	// MinSize and MaxSize limit the size of the files in bytes. A MaxSize
+	// of 0 means no limit.
+	MinSize, MaxSize int64
+	// ModifiedAfter and ModifiedBefore limit the modification time of the
+	// files, unless they are zero.
+	ModifiedAfter, ModifiedBefore time.Time
+	// Hash computes the SHA-256 digest of every reported file.
+	Hash bool
+}
+
+// Entry is a file found by Walk.
+type Entry struct {
+	// Path is the slash-separated path of the file, relative to the file
+	// system (not to the root of the walk).
+	Path    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	// SHA256 is the hex-encoded digest of the content, if Options.Hash is
+	// set.
+	SHA256 string
+}
+
+// SkipAll can be returned by the callback of Walk to end the walk early,
+// without an error.
+var SkipAll = fs.SkipAll
+
+// Walk calls fn for every file below root that matches the options, in
+// lexical order. Errors of fn end the walk and are returned.
+func Walk(fsys fs.FS, root string, opts Options, fn func(Entry) error) error {
+	var ignores []ignoreRule
+	if opts.GitIgnore {
+		rules, err := readIgnoreFile(fsys, root)
+		if err != nil {
+			return err
+		}
+		ignores = rules
+	}
+
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel := strings.TrimPrefix(p, root+"/")
+		if root == "." {
+			rel = p
+		}
+		depth := strings.Count(rel, "/") + 1
+
+		if d.IsDir() {
+			if (opts.GitIgnore && d.Name() == ".git") ||
+				matchAny(opts.Exclude, rel) ||
+				ignored(ignores, p, true) ||
+				(opts.MaxDepth > 0 && depth >= opts.MaxDepth) {
+				return fs.SkipDir
+			}
+			// Rules of nested .gitignore files apply after those of
+			// the parent directories, so they can override them. The
+			// walk is depth-first, so rules of other directories are
+			// harmless: they only match paths below their directory.
+			if opts.GitIgnore {
+				rules, err := readIgnoreFile(fsys, p)
+				if err != nil {
+					return err
+				}
+				ignores = append(ignores, rules...)
+			}
+			return nil
+		}
+
+		if matchAny(opts.Exclude, rel) || ignored(ignores, p, false) {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchAny(opts.Include, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !opts.keep(info) {
+			return nil
+		}
+
+		e := Entry{Path: p, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+		if opts.Hash && info.Mode().IsRegular() {
+			if e.SHA256, err = hashFile(fsys, p); err != nil {
+				return err
+			}
+		}
+		return fn(e)
+	})
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// keep applies the size and time filters.
+func (o Options) keep(info fs.FileInfo) bool {
+	if info.Size() < o.MinSize || (o.MaxSize > 0 && info.Size() > o.MaxSize) {
+		return false
+	}
+	if !o.ModifiedAfter.IsZero() && !info.ModTime().After(o.ModifiedAfter) {
+		return false
+	}
+	if !o.ModifiedBefore.IsZero() && !info.ModTime().Before(o.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// hashFile returns the hex-encoded SHA-256 digest of a file.
+func hashFile(fsys fs.FS, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Hash(f)
+}
+
+// Hash returns the hex-encoded SHA-256 digest of the content of r, as in
+// Entry.SHA256.
+func Hash(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Match reports whether a slash-separated path matches a pattern. A
+// pattern without a slash matches the last element of the path, any other
+// pattern the whole path, with "**" matching any number of elements. A
+// leading slash only anchors the pattern ("/logs" matches "logs", but not
+// "a/logs"). A malformed pattern does not match anything.
+func Match(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// CheckPattern returns path.ErrBadPattern if the pattern is malformed.
+func CheckPattern(pattern string) error {
+	for _, elem := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchElems matches the elements of a path against those of a pattern.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to match the rest of the pattern after skipping 0, 1,
+			// 2, ... elements of the name.
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchAny reports whether name matches any of the patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
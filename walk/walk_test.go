@@ -0,0 +1,332 @@
+package walk
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// modTime is the modification time of the files of the test trees.
+var modTime = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+// walkPaths runs Walk and returns the reported paths, separated by spaces.
+func walkPaths(t *testing.T, fsys fs.FS, root string, opts Options) string {
+	t.Helper()
+	var paths []string
+	err := Walk(fsys, root, opts, func(e Entry) error {
+		paths = append(paths, e.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		// Without a slash, the name matches at any depth.
+		{"*.go", "main.go", true},
+		{"*.go", "a/b/main.go", true},
+		{"*.go", "main.go.bak", false},
+		{"logs", "a/logs", true},
+		// With a slash, the whole path must match.
+		{"csv_data/*.csv", "csv_data/a.csv", true},
+		{"csv_data/*.csv", "x/csv_data/a.csv", false},
+		{"csv_data/*.csv", "csv_data/sub/a.csv", false},
+		// A leading slash only anchors the pattern.
+		{"/go.mod", "go.mod", true},
+		{"/go.mod", "sub/go.mod", false},
+		{"/logs", "logs", true},
+		{"/logs", "a/logs", false},
+		// ** matches any number of elements, none included.
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/main.go", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/c", false},
+		{"**/testdata/**", "testdata/a", true},
+		{"**/testdata/**", "a/testdata/b/c", true},
+		{"**/testdata/**", "a/test/b", false},
+		// A * does not cross slashes.
+		{"a/*", "a/b/c", false},
+		// A malformed pattern matches nothing.
+		{"[", "[", false},
+		{"a/[", "a/[", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPattern(t *testing.T) {
+	for _, p := range []string{"*.go", "/go.mod", "**/testdata/**", "[a-z]*"} {
+		if err := CheckPattern(p); err != nil {
+			t.Errorf("CheckPattern(%q) = %v", p, err)
+		}
+	}
+	for _, p := range []string{"[", "a/[/b"} {
+		if err := CheckPattern(p); err == nil {
+			t.Errorf("CheckPattern(%q) accepted a malformed pattern", p)
+		}
+	}
+}
+
+// tree is a small project with files at three levels.
+func tree() fstest.MapFS {
+	file := func(size int) *fstest.MapFile {
+		return &fstest.MapFile{Data: make([]byte, size), Mode: 0644, ModTime: modTime}
+	}
+	return fstest.MapFS{
+		"go.mod":          file(10),
+		"main.go":         file(200),
+		"cmd/tool.go":     file(300),
+		"cmd/go.mod":      file(10),
+		"cmd/sub/deep.go": file(400),
+		"vendor/lib.go":   file(500),
+		"docs/guide.md":   file(1000),
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		name string
+		root string
+		opts Options
+		want string
+	}{
+		{"all", ".", Options{}, "cmd/go.mod cmd/sub/deep.go cmd/tool.go docs/guide.md go.mod main.go vendor/lib.go"},
+		{"include without a slash", ".", Options{Include: []string{"*.go"}}, "cmd/sub/deep.go cmd/tool.go main.go vendor/lib.go"},
+		{"include with a leading slash", ".", Options{Include: []string{"/go.mod"}}, "go.mod"},
+		{"include with **", ".", Options{Include: []string{"cmd/**/*.go"}}, "cmd/sub/deep.go cmd/tool.go"},
+		{"exclude", ".", Options{Include: []string{"*.go"}, Exclude: []string{"vendor", "deep.go"}}, "cmd/tool.go main.go"},
+		{"max depth 1", ".", Options{MaxDepth: 1}, "go.mod main.go"},
+		{"max depth 2", ".", Options{MaxDepth: 2}, "cmd/go.mod cmd/tool.go docs/guide.md go.mod main.go vendor/lib.go"},
+		// Patterns and the depth are relative to the root, paths are not.
+		{"root", "cmd", Options{Include: []string{"/go.mod"}}, "cmd/go.mod"},
+		{"max depth below the root", "cmd", Options{MaxDepth: 1}, "cmd/go.mod cmd/tool.go"},
+		{"min size", ".", Options{MinSize: 400}, "cmd/sub/deep.go docs/guide.md vendor/lib.go"},
+		{"max size", ".", Options{MaxSize: 200}, "cmd/go.mod go.mod main.go"},
+		{"size range", ".", Options{MinSize: 300, MaxSize: 400}, "cmd/sub/deep.go cmd/tool.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := walkPaths(t, tree(), tt.root, tt.opts); got != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkModTime(t *testing.T) {
+	fsys := tree()
+	fsys["main.go"].ModTime = modTime.Add(-time.Hour)
+	fsys["docs/guide.md"].ModTime = modTime.Add(time.Hour)
+	opts := Options{Include: []string{"main.go", "go.mod", "guide.md"}}
+
+	// Both limits are exclusive.
+	opts.ModifiedAfter = modTime
+	if got := walkPaths(t, fsys, ".", opts); got != "docs/guide.md" {
+		t.Errorf("modified after: got %s", got)
+	}
+	opts.ModifiedAfter, opts.ModifiedBefore = time.Time{}, modTime
+	if got := walkPaths(t, fsys, ".", opts); got != "main.go" {
+		t.Errorf("modified before: got %s", got)
+	}
+	opts.ModifiedAfter, opts.ModifiedBefore = modTime.Add(-2*time.Hour), modTime.Add(time.Minute)
+	if got := walkPaths(t, fsys, ".", opts); got != "cmd/go.mod go.mod main.go" {
+		t.Errorf("modified between: got %s", got)
+	}
+}
+
+// unreadableFS fails to open one directory.
+type unreadableFS struct {
+	fs.FS
+	dir string
+}
+
+func (u unreadableFS) Open(name string) (fs.File, error) {
+	if name == u.dir {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return u.FS.Open(name)
+}
+
+func TestExcludePrunes(t *testing.T) {
+	fsys := unreadableFS{FS: tree(), dir: "vendor"}
+	if err := Walk(fsys, ".", Options{}, func(Entry) error { return nil }); !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("the walk did not read vendor: %v", err)
+	}
+	// An excluded directory is not read at all.
+	if got := walkPaths(t, fsys, ".", Options{Exclude: []string{"vendor"}}); strings.Contains(got, "vendor") {
+		t.Errorf("got %s", got)
+	}
+	// Neither is a directory below the maximum depth.
+	fsys.dir = "cmd/sub"
+	if got := walkPaths(t, fsys, ".", Options{MaxDepth: 2}); strings.Contains(got, "deep.go") {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+	file := func(data string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(data), Mode: 0644, ModTime: modTime}
+	}
+	fsys := fstest.MapFS{
+		".gitignore": file("# logs\n*.log\n!keep.log\nbuild/\n/secret.txt\n\\#hash\n"),
+		".git/HEAD":  file("ref"),
+		"app.log":    file(""),
+		"keep.log":   file(""),
+		"secret.txt": file(""),
+		"#hash":      file(""),
+		"build/out":  file(""),
+		"main.go":    file(""),
+		// The rules of a nested .gitignore only apply below it, and
+		// after those of the parent.
+		"sub/.gitignore": file("!debug.log\n*.tmp\n"),
+		"sub/app.log":    file(""),
+		"sub/debug.log":  file(""),
+		"sub/secret.txt": file(""),
+		"sub/x.tmp":      file(""),
+		// build/ only matches directories.
+		"sub/build": file(""),
+		"x.tmp":     file(""),
+	}
+
+	want := ".gitignore keep.log main.go sub/.gitignore sub/build sub/debug.log sub/secret.txt x.tmp"
+	if got := walkPaths(t, fsys, ".", Options{GitIgnore: true}); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	// Without GitIgnore, the rules are ordinary files.
+	if got := walkPaths(t, fsys, ".", Options{Include: []string{"*.log"}}); got != "app.log keep.log sub/app.log sub/debug.log" {
+		t.Errorf("without GitIgnore: got %s", got)
+	}
+	// A walk of a subdirectory still applies its own .gitignore.
+	if got := walkPaths(t, fsys, "sub", Options{GitIgnore: true}); got != "sub/.gitignore sub/app.log sub/build sub/debug.log sub/secret.txt" {
+		t.Errorf("walk of sub: got %s", got)
+	}
+}
+
+func TestIgnoredDirectoryPrunes(t *testing.T) {
+	fsys := unreadableFS{
+		FS: fstest.MapFS{
+			".gitignore": {Data: []byte("build/\n")},
+			"build/out":  {},
+			"main.go":    {},
+		},
+		dir: "build",
+	}
+	if got := walkPaths(t, fsys, ".", Options{GitIgnore: true}); got != ".gitignore main.go" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWalkStops(t *testing.T) {
+	var n int
+	err := Walk(tree(), ".", Options{}, func(Entry) error {
+		n++
+		if n == 2 {
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("SkipAll: %v after %d files", err, n)
+	}
+
+	stop := errors.New("stop")
+	if err := Walk(tree(), ".", Options{}, func(Entry) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("got error %v, want the error of the callback", err)
+	}
+}
+
+func TestWalkHash(t *testing.T) {
+	fsys := fstest.MapFS{"a": {Data: []byte("hello\n")}}
+	var e Entry
+	if err := Walk(fsys, ".", Options{Hash: true}, func(got Entry) error { e = got; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if want := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"; e.SHA256 != want {
+		t.Errorf("SHA256 = %s, want %s", e.SHA256, want)
+	}
+	if err := Walk(fsys, ".", Options{}, func(got Entry) error { e = got; return nil }); err != nil || e.SHA256 != "" {
+		t.Errorf("a walk without Hash returned %q, %v", e.SHA256, err)
+	}
+}
+
+func TestWriters(t *testing.T) {
+	entries := []Entry{
+		{Path: "a.txt", Size: 5, Mode: 0644, ModTime: modTime, SHA256: "aaaa"},
+		{Path: "sub/b, c.txt", Size: 1234, Mode: 0600, ModTime: modTime, SHA256: "bbbb"},
+	}
+	tests := []struct {
+		format   string
+		withHash bool
+		want     string
+	}{
+		// The columns are right-aligned, except for the path.
+		{"text", false, "" +
+			"  -rw-r--r--     5  2024-05-06 07:08:09 a.txt\n" +
+			"  -rw-------  1234  2024-05-06 07:08:09 sub/b, c.txt\n"},
+		{"text", true, "" +
+			"  -rw-r--r--     5  2024-05-06 07:08:09  aaaa a.txt\n" +
+			"  -rw-------  1234  2024-05-06 07:08:09  bbbb sub/b, c.txt\n"},
+		{"json", false, `[
+  {"path":"a.txt","size":5,"mode":"-rw-r--r--","modTime":"2024-05-06T07:08:09Z","sha256":"aaaa"},
+  {"path":"sub/b, c.txt","size":1234,"mode":"-rw-------","modTime":"2024-05-06T07:08:09Z","sha256":"bbbb"}
+]
+`},
+		{"csv", false, "" +
+			"path,size,mode,modTime\n" +
+			"a.txt,5,-rw-r--r--,2024-05-06T07:08:09Z\n" +
+			"\"sub/b, c.txt\",1234,-rw-------,2024-05-06T07:08:09Z\n"},
+		{"csv", true, "" +
+			"path,size,mode,modTime,sha256\n" +
+			"a.txt,5,-rw-r--r--,2024-05-06T07:08:09Z,aaaa\n" +
+			"\"sub/b, c.txt\",1234,-rw-------,2024-05-06T07:08:09Z,bbbb\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, tt.format, tt.withHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if err := w.Write(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s (hash %v):\n%s\nwant\n%s", tt.format, tt.withHash, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestWritersWithoutEntries(t *testing.T) {
+	want := map[string]string{"text": "", "json": "[]\n", "csv": ""}
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil || buf.String() != want[format] {
+			t.Errorf("%s: %q, %v, want %q", format, buf.String(), err, want[format])
+		}
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, "xml", false); err == nil {
+		t.Error("NewWriter accepted an unknown format")
+	}
+}
@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Notify calls fn for every file that is closed after writing or moved into
+// dir, until ctx is cancelled. Files that are in dir when Notify starts are
+// reported first.
+func Notify(ctx context.Context, dir string, fn func(path string)) error {
+	// A non-blocking descriptor lets os.File use the runtime poller, so
+	// closing the file interrupts a Read that waits for events.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), "inotify")
+	defer file.Close()
+	stop := context.AfterFunc(ctx, func() { file.Close() })
+	defer stop()
+
+	// IN_CLOSE_WRITE: a file opened for writing was closed.
+	// IN_MOVED_TO: a file was renamed into the directory.
+	// IN_DELETE_SELF, IN_MOVE_SELF: the directory itself is gone.
+	mask := uint32(syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		return fmt.Errorf("inotify: watching %s: %w", dir, err)
+	}
+
+	// Report the files that were there before the watch was added. A file
+	// written in the meantime may be reported twice.
+	if err := scan(dir, fn); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := file.Read(buf)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("inotify: %w", err)
+		}
+
+		// The buffer holds a sequence of events, each followed by the
+		// file name, padded with NUL bytes.
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			switch {
+			case ev.Mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+				return fmt.Errorf("%s was removed or moved", dir)
+			case ev.Mask&syscall.IN_Q_OVERFLOW != 0:
+				// Events were lost, so look at the whole directory.
+				if err := scan(dir, fn); err != nil {
+					return err
+				}
+			case name == "" || ignored(name):
+				// An event of the directory itself, or an ignored file.
+			default:
+				path := filepath.Join(dir, name)
+				if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+					fn(path)
+				} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+	}
+}
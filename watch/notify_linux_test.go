@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "old.csv"), "x")
+
+	names := start(t, dir, Notify)
+	// The files already there are reported first, after the watch is
+	// added, so the events of the files below are not missed.
+	if name := next(t, names); name != "old.csv" {
+		t.Fatalf("reported %s, want old.csv", name)
+	}
+
+	// IN_CLOSE_WRITE: a file is reported when its writer closes it.
+	f, err := os.Create(filepath.Join(dir, "a.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("x")
+	none(t, names)
+	f.Close()
+	if name := next(t, names); name != "a.csv" {
+		t.Errorf("reported %s, want a.csv", name)
+	}
+
+	// IN_MOVED_TO: a file written under a temporary name is reported when
+	// it is renamed.
+	write(t, filepath.Join(dir, "b.csv.tmp"), "x")
+	write(t, filepath.Join(dir, ".hidden"), "x")
+	none(t, names)
+	if err := os.Rename(filepath.Join(dir, "b.csv.tmp"), filepath.Join(dir, "b.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if name := next(t, names); name != "b.csv" {
+		t.Errorf("reported %s, want b.csv", name)
+	}
+	// So is a file moved in from another directory.
+	other := filepath.Join(t.TempDir(), "c.csv")
+	write(t, other, "x")
+	if err := os.Rename(other, filepath.Join(dir, "c.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if name := next(t, names); name != "c.csv" {
+		t.Errorf("reported %s, want c.csv", name)
+	}
+	// Directories are not reported.
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	none(t, names)
+}
+
+func TestNotifyDirRemoved(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inbox")
+	os.Mkdir(dir, 0755)
+	done := make(chan error, 1)
+	// a.csv is reported either by the first scan or by its event, and
+	// maybe by both.
+	names := make(chan string, 2)
+	go func() {
+		done <- Notify(context.Background(), dir, func(path string) { names <- path })
+	}()
+	write(t, filepath.Join(dir, "a.csv"), "x")
+	next(t, names)
+	os.RemoveAll(dir)
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "removed") {
+			t.Errorf("got error %v, want the directory removed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Notify did not return")
+	}
+}
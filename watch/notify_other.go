@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "context"
+
+// Notify returns ErrNotSupported. Use Poll instead.
+func Notify(ctx context.Context, dir string, fn func(path string)) error {
+	return ErrNotSupported
+}
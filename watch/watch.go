@@ -0,0 +1,126 @@
+// Package watch reports files that are dropped into a directory, e.g. an
+// inbox that other programs or users copy files into.
+//
+// Notify uses the file system notifications of the operating system
+// (inotify on Linux), so files are reported as soon as they are written.
+// Poll lists the directory at an interval instead, which works everywhere,
+// including network file systems that do not send notifications:
+//
+//	err := watch.Notify(ctx, "inbox", handle)
+//	if errors.Is(err, watch.ErrNotSupported) {
+//		err = watch.Poll(ctx, "inbox", time.Second, handle)
+//	}
+//
+// Both report a file only once it is complete, i.e. when the program that
+// wrote it has closed it (Notify) or when it has stopped changing (Poll).
+// Files are reported one at a time, and a file can be reported again, e.g.
+// if it is still in the directory after a rename was missed, so the
+// callback must tolerate files that no longer exist.
+//
+// Only regular files directly in the directory are reported, except for
+// hidden files (".name") and files that are still being written by
+// convention ("name.tmp", "name.part"), so writers can create a file under
+// a temporary name and rename it when it is done.
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotSupported is returned by Notify if the platform has no file system
+// notifications.
+var ErrNotSupported = errors.New("file system notifications are not supported on this platform")
+
+// ignored reports whether a file name is skipped.
+func ignored(name string) bool {
+	return strings.HasPrefix(name, ".") ||
+		strings.HasSuffix(name, ".tmp") ||
+		strings.HasSuffix(name, ".part")
+}
+
+// scan calls fn for every regular file in dir that is not ignored, in the
+// order of the names.
+func scan(dir string, fn func(path string)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() && !ignored(e.Name()) {
+			fn(filepath.Join(dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+// Poll lists dir every interval until ctx is cancelled, and calls fn for
+// every file whose size and modification time did not change between two
+// listings.
+func Poll(ctx context.Context, dir string, interval time.Duration, fn func(path string)) error {
+	type state struct {
+		size     int64
+		modTime  time.Time
+		reported bool
+	}
+	files := map[string]*state{}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		var ready []string
+		present := map[string]bool{}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || ignored(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				// Removed since the listing.
+				continue
+			}
+			name := e.Name()
+			present[name] = true
+
+			s, ok := files[name]
+			switch {
+			case !ok:
+				files[name] = &state{size: info.Size(), modTime: info.ModTime()}
+			case s.size != info.Size() || !s.modTime.Equal(info.ModTime()):
+				// Still being written, or replaced.
+				*s = state{size: info.Size(), modTime: info.ModTime()}
+			case !s.reported:
+				s.reported = true
+				ready = append(ready, name)
+			}
+		}
+		// Forget removed files, so a new file with the same name is
+		// reported again.
+		for name := range files {
+			if !present[name] {
+				delete(files, name)
+			}
+		}
+
+		sort.Strings(ready)
+		for _, name := range ready {
+			fn(filepath.Join(dir, name))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// interval is the polling interval of the tests.
+const interval = 20 * time.Millisecond
+
+// start runs a watcher on dir until the test ends, and returns a channel
+// with the names of the reported files.
+func start(t *testing.T, dir string, run func(ctx context.Context, dir string, fn func(string)) error) <-chan string {
+	t.Helper()
+	names := make(chan string, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, dir, func(path string) { names <- filepath.Base(path) })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("the watcher returned %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("the watcher did not stop")
+		}
+	})
+	return names
+}
+
+// next returns the next reported name.
+func next(t *testing.T, names <-chan string) string {
+	t.Helper()
+	select {
+	case name := <-names:
+		return name
+	case <-time.After(2 * time.Second):
+		t.Fatal("no file was reported")
+		return ""
+	}
+}
+
+// none checks that no file is reported for a while.
+func none(t *testing.T, names <-chan string) {
+	t.Helper()
+	select {
+	case name := <-names:
+		t.Errorf("%s was reported", name)
+	case <-time.After(5 * interval):
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func poll(ctx context.Context, dir string, fn func(string)) error {
+	return Poll(ctx, dir, interval, fn)
+}
+
+func TestPollSkips(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".hidden", "a.tmp", "b.part", "c.csv"} {
+		write(t, filepath.Join(dir, name), "x")
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	os.Symlink("c.csv", filepath.Join(dir, "link"))
+
+	names := start(t, dir, poll)
+	if name := next(t, names); name != "c.csv" {
+		t.Errorf("reported %s, want c.csv", name)
+	}
+	// Complete files are only reported once.
+	none(t, names)
+
+	// A temporary file is reported under its final name.
+	if err := os.Rename(filepath.Join(dir, "a.tmp"), filepath.Join(dir, "a.csv")); err != nil {
+		t.Fatal(err)
+	}
+	if name := next(t, names); name != "a.csv" {
+		t.Errorf("reported %s, want a.csv", name)
+	}
+}
+
+func TestPollWaitsForStableFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "growing")
+	write(t, path, "")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	names := start(t, dir, poll)
+	// The file grows between all listings, so it is not reported.
+	stop := time.Now().Add(10 * interval)
+	for time.Now().Before(stop) {
+		f.WriteString("x")
+		select {
+		case name := <-names:
+			t.Fatalf("%s was reported while it was written", name)
+		case <-time.After(interval / 10):
+		}
+	}
+	if name := next(t, names); name != "growing" {
+		t.Errorf("reported %s, want growing", name)
+	}
+}
+
+func TestPollReportsReusedNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	write(t, path, "first")
+
+	names := start(t, dir, poll)
+	if name := next(t, names); name != "a.csv" {
+		t.Fatalf("reported %s, want a.csv", name)
+	}
+	// The file is processed and removed, then a new one arrives.
+	os.Remove(path)
+	none(t, names)
+	write(t, path, "second")
+	if name := next(t, names); name != "a.csv" {
+		t.Errorf("reported %s, want a.csv again", name)
+	}
+}
+
+func TestPollMissingDir(t *testing.T) {
+	err := Poll(context.Background(), filepath.Join(t.TempDir(), "missing"), interval, func(string) {})
+	if !os.IsNotExist(err) {
+		t.Errorf("got error %v, want a missing directory", err)
+	}
+}